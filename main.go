@@ -49,6 +49,7 @@ func main() {
 		for _, err := range errs {
 			logg.Error(err.Error())
 		}
+		objects.RemoveSpool()
 		os.Exit(1)
 	}
 
@@ -64,6 +65,7 @@ func main() {
 
 	// do the work
 	runPipeline(ctx, config, reportChan)
+	objects.RemoveSpool()
 
 	// shutdown Report actor
 	close(reportChan)
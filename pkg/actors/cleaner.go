@@ -22,7 +22,9 @@ type FileInfoForCleaner struct {
 }
 
 // Cleaner is an actor that cleans up unknown objects on the target side (i.e.
-// those objects which do not exist on the source side).
+// those objects which do not exist on the source side). Afterwards, it tells
+// the sources of all jobs that were completed without errors about it (see
+// objects.CompletedRunRecorder).
 type Cleaner struct {
 	Input  <-chan FileInfoForCleaner
 	Report chan<- ReportEvent
@@ -37,16 +39,14 @@ func (c *Cleaner) Run(ctx context.Context) {
 	// (we don't need to check Context.Done in the loop; when the process is
 	// interrupted, main() will close our Input and we will move on)
 	for info := range c.Input {
-		// ignore all files in jobs where no cleanup is configured
 		job := info.Job
+		isJobFailed[job] = isJobFailed[job] || info.Failed
+
+		// ignore all files in jobs where no cleanup is configured
 		if job.Cleanup.Strategy == objects.KeepUnknownFiles {
 			continue
 		}
 
-		if info.Failed {
-			isJobFailed[job] = true
-		}
-
 		m, exists := isFileTransferred[job]
 		if !exists {
 			m = make(map[string]bool)
@@ -64,15 +64,21 @@ func (c *Cleaner) Run(ctx context.Context) {
 	// Job.IsScrapingIncomplete attribute concurrently; at this point the scraper
 	// is definitely done, so these attributes are safe to read without risking a
 	// data race)
-	for job := range isFileTransferred {
+	for job := range isJobFailed {
 		if job.IsScrapingIncomplete {
 			isJobFailed[job] = true
 		}
 	}
-	if len(isJobFailed) > 0 {
+	failedCleanupJobCount := 0
+	for job := range isFileTransferred {
+		if isJobFailed[job] {
+			failedCleanupJobCount++
+		}
+	}
+	if failedCleanupJobCount > 0 {
 		logg.Info(
 			"skipping cleanup phase for %d job(s) because of failed file transfers",
-			len(isJobFailed))
+			failedCleanupJobCount)
 	}
 
 	// perform cleanup if it is safe to do so
@@ -85,6 +91,21 @@ func (c *Cleaner) Run(ctx context.Context) {
 			c.performCleanup(ctx, job, transferred)
 		}
 	}
+
+	// record completed runs for the sources that are interested in them
+	for job, isFailed := range isJobFailed {
+		if ctx.Err() != nil {
+			// interrupt received
+			return
+		}
+		recorder, ok := job.Source.(objects.CompletedRunRecorder)
+		if ok && !isFailed {
+			err := recorder.RecordCompletedRun(ctx)
+			if err != nil {
+				logg.Error("could not record completed run in %s: %s", job.Target.ObjectAtPath("").FullName(), err.Error())
+			}
+		}
+	}
 }
 
 func (c *Cleaner) performCleanup(ctx context.Context, job *objects.Job, isFileTransferred map[string]bool) {
@@ -135,6 +135,10 @@ func (r *Report) Run(ctx context.Context) {
 	gaugeU64("last_run.files_failed", r.stats.FilesFailed)
 	gaugeU64("last_run.files_cleaned_up", r.stats.FilesCleanedUp)
 	gaugeU64("last_run.bytes_transfered", r.stats.BytesTransferred) // cannot be easily renamed as it is publicly exposed
+	githubRateLimitRemaining, hasGithubRateLimit := objects.GithubRateLimitRemaining()
+	if hasGithubRateLimit {
+		gaugeU64("last_run.github_ratelimit_remaining", githubRateLimitRemaining)
+	}
 	if r.stats.FilesFailed > 0 || r.stats.DirectoriesFailed > 0 {
 		gaugeU64("last_run.success", 0)
 		r.ExitCode = 1
@@ -156,6 +160,9 @@ func (r *Report) Run(ctx context.Context) {
 		logg.Info("%d old files cleaned up", r.stats.FilesCleanedUp)
 	}
 	logg.Info("%d bytes transferred", r.stats.BytesTransferred)
+	if hasGithubRateLimit {
+		logg.Info("%d GitHub API requests remaining before the rate limit is reached", githubRateLimitRemaining)
+	}
 
 	r.stats.Duration = time.Since(r.StartTime)
 	gaugeI64("last_run.duration_seconds", int64(r.stats.Duration.Seconds()))
@@ -99,7 +99,8 @@ func (s *Scraper) Run(ctx context.Context) {
 
 		// if listing failed, maybe retry later
 		if err != nil {
-			if err.Message == objects.ErrMessageGPGVerificationFailed {
+			if err.Message == objects.ErrMessageGPGVerificationFailed || err.Message == objects.ErrMessageStaleMetadata ||
+				err.Message == objects.ErrMessageRateLimited {
 				logg.Error("skipping job for source %s: %s", err.Location, err.FullMessage())
 				job.IsScrapingIncomplete = true
 				// report that a job was skipped
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"crypto/md5"  //nolint:gosec // only used for verifying checksums that upstream repositories publish in this format
+	"crypto/sha1" //nolint:gosec // same as above
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// Checksum is the expected digest of a file, as advertised by the repository
+// metadata that referenced it (e.g. the "sha256" field in a Conda repodata.json).
+type Checksum struct {
+	// one of "md5", "sha1", "sha256" or "sha512" (case-insensitive)
+	Algorithm string
+	// hex-encoded digest
+	Value string
+}
+
+// String returns a human-readable representation of this checksum.
+func (c Checksum) String() string {
+	return strings.ToLower(c.Algorithm) + ":" + strings.ToLower(c.Value)
+}
+
+// newHash returns a fresh hash.Hash for c.Algorithm.
+func (c Checksum) newHash() (hash.Hash, error) {
+	switch strings.ToLower(c.Algorithm) {
+	case "md5":
+		return md5.New(), nil //nolint:gosec // see import
+	case "sha1", "sha":
+		return sha1.New(), nil //nolint:gosec // see import
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %q", c.Algorithm)
+	}
+}
+
+// Verify checks whether the given contents match this checksum.
+func (c Checksum) Verify(contents []byte) error {
+	h, err := c.newHash()
+	if err != nil {
+		return err
+	}
+	h.Write(contents)
+	return c.compare(h.Sum(nil))
+}
+
+func (c Checksum) compare(actual []byte) error {
+	expected, err := hex.DecodeString(c.Value)
+	if err != nil {
+		return fmt.Errorf("malformed %s checksum %q: %w", c.Algorithm, c.Value, err)
+	}
+	if !bytes.Equal(expected, actual) {
+		return fmt.Errorf("%s checksum mismatch: expected %x, got %x", strings.ToLower(c.Algorithm), expected, actual)
+	}
+	return nil
+}
+
+// errChecksumMismatch wraps all errors returned by verifyingReader.
+var errChecksumMismatch = errors.New("downloaded contents do not match repository metadata")
+
+// verifyingReader is an io.ReadCloser that computes the digest of all data
+// read through it. When the underlying reader reaches EOF, the digest and size
+// are compared to the expected values, and an error is returned instead of
+// io.EOF on mismatch. Since the upload to Swift consumes this reader, a
+// mismatch causes the upload to fail.
+type verifyingReader struct {
+	Base              io.ReadCloser
+	ExpectedChecksum  *Checksum
+	ExpectedSizeBytes *uint64
+	hash              hash.Hash
+	bytesRead         uint64
+}
+
+func newVerifyingReader(base io.ReadCloser, spec FileSpec) (io.ReadCloser, error) {
+	r := &verifyingReader{
+		Base:              base,
+		ExpectedChecksum:  spec.ExpectedChecksum,
+		ExpectedSizeBytes: spec.ExpectedSizeBytes,
+	}
+	if r.ExpectedChecksum != nil {
+		var err error
+		r.hash, err = r.ExpectedChecksum.newHash()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Read implements the io.Reader interface.
+func (r *verifyingReader) Read(buf []byte) (int, error) {
+	n, err := r.Base.Read(buf)
+	if n > 0 {
+		r.bytesRead += uint64(n)
+		if r.hash != nil {
+			r.hash.Write(buf[:n])
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		verr := r.verify()
+		if verr != nil {
+			if reporter, ok := r.Base.(checksumMismatchReporter); ok {
+				reporter.reportChecksumMismatch()
+			}
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+// checksumMismatchReporter can be implemented by the bodies returned by
+// Source.GetFile() to find out when verifyingReader rejects their contents.
+type checksumMismatchReporter interface {
+	reportChecksumMismatch()
+}
+
+func (r *verifyingReader) verify() error {
+	if r.ExpectedSizeBytes != nil && *r.ExpectedSizeBytes != r.bytesRead {
+		return fmt.Errorf("%w: expected %d bytes, got %d bytes", errChecksumMismatch, *r.ExpectedSizeBytes, r.bytesRead)
+	}
+	if r.hash != nil {
+		err := r.ExpectedChecksum.compare(r.hash.Sum(nil))
+		if err != nil {
+			return fmt.Errorf("%w: %w", errChecksumMismatch, err)
+		}
+	}
+	return nil
+}
+
+// Close implements the io.Closer interface.
+func (r *verifyingReader) Close() error {
+	return r.Base.Close()
+}
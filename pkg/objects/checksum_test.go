@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/go-bits/must"
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	// sha256sum of "hello world"
+	const helloWorldSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+	tt := []struct {
+		name          string
+		checksum      *Checksum
+		sizeBytes     *uint64
+		expectSuccess bool
+	}{
+		{"correct checksum", &Checksum{Algorithm: "sha256", Value: helloWorldSHA256}, nil, true},
+		{"correct checksum in upper case", &Checksum{Algorithm: "SHA256", Value: strings.ToUpper(helloWorldSHA256)}, nil, true},
+		{"correct checksum and size", &Checksum{Algorithm: "sha256", Value: helloWorldSHA256}, new(uint64(11)), true},
+		{"correct size", nil, new(uint64(11)), true},
+		{"wrong checksum", &Checksum{Algorithm: "sha256", Value: strings.Repeat("0", 64)}, nil, false},
+		{"wrong size", &Checksum{Algorithm: "sha256", Value: helloWorldSHA256}, new(uint64(12)), false},
+		{"checksum for other algorithm", &Checksum{Algorithm: "md5", Value: helloWorldSHA256}, nil, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := FileSpec{ExpectedChecksum: tc.checksum, ExpectedSizeBytes: tc.sizeBytes}
+			r := must.ReturnT(newVerifyingReader(io.NopCloser(strings.NewReader("hello world")), spec))(t)
+			_, err := io.ReadAll(r)
+			assert.Equal(t, err == nil, tc.expectSuccess)
+			if err != nil {
+				assert.Equal(t, errors.Is(err, errChecksumMismatch), true)
+			}
+		})
+	}
+}
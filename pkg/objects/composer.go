@@ -0,0 +1,354 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"go.xyrillian.de/schwift/v2"
+)
+
+// ComposerSource is a URLSource containing a Composer repository (e.g.
+// Packagist). This type reuses the Validate() and Connect() logic of
+// URLSource, but adds a custom scraping implementation that reads the
+// repository metadata instead of relying on directory listings.
+//
+// Only the configured packages are transferred. Their dist archives are
+// written into the target below "dists/", and a Composer v2 repository
+// (packages.json plus metadata files below "p2/") is generated that refers to
+// these dist archives via the configured public URL.
+type ComposerSource struct {
+	// options from config file
+	URLString                string        `yaml:"url"`
+	ClientCertificatePath    string        `yaml:"cert"`
+	ClientCertificateKeyPath string        `yaml:"key"`
+	ServerCAPath             string        `yaml:"ca"`
+	Packages                 []PackageSpec `yaml:"packages"`
+	PublicURLString          string        `yaml:"public_url"`
+	// compiled configuration
+	urlSource *URLSource `yaml:"-"`
+}
+
+// Validate implements the Source interface.
+func (s *ComposerSource) Validate(name string) []error {
+	s.urlSource = &URLSource{
+		URLString:                s.URLString,
+		ClientCertificatePath:    s.ClientCertificatePath,
+		ClientCertificateKeyPath: s.ClientCertificateKeyPath,
+		ServerCAPath:             s.ServerCAPath,
+	}
+	errs := s.urlSource.Validate(name)
+	errs = append(errs, validatePackageSpecs(s.Packages, name+".packages")...)
+
+	// dist URLs in Composer metadata must be absolute, so we need to know
+	// where the target will be reachable
+	if s.PublicURLString == "" {
+		errs = append(errs, fmt.Errorf("missing value for %s.public_url", name))
+	} else if !strings.HasSuffix(s.PublicURLString, "/") {
+		errs = append(errs, fmt.Errorf("invalid value for %s.public_url: must end with a slash", name))
+	}
+	for idx, pkg := range s.Packages {
+		if pkg.Name != "" && strings.Count(pkg.Name, "/") != 1 {
+			errs = append(errs, fmt.Errorf("invalid value for %s.packages[%d].name: expected \"vendor/package\", got %q", name, idx, pkg.Name))
+		}
+	}
+
+	return errs
+}
+
+// Connect implements the Source interface.
+func (s *ComposerSource) Connect(ctx context.Context, name string) error {
+	return s.urlSource.Connect(ctx, name)
+}
+
+// ListEntries implements the Source interface.
+func (s *ComposerSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+// GetFile implements the Source interface.
+func (s *ComposerSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	// all files are listed with a DownloadPath that is the full URL of a dist archive
+	return s.urlSource.getFileFromURL(ctx, path, requestHeaders)
+}
+
+// composerRoot is the structure of a Composer repository's packages.json.
+// Each repository uses one of several mechanisms for locating package metadata:
+//
+//   - Composer v2 repositories have a "metadata-url" template.
+//   - Composer v1 repositories have a "providers-url" template, with the
+//     required hashes being listed in the "provider-includes" files.
+//   - Small repositories have all metadata inline in "packages" or in files
+//     listed in "includes".
+type composerRoot struct {
+	Packages         map[string]map[string]composerVersion `json:"packages"`
+	MetadataURL      string                                `json:"metadata-url"`
+	ProvidersURL     string                                `json:"providers-url"`
+	ProviderIncludes map[string]struct {
+		SHA256 string `json:"sha256"`
+	} `json:"provider-includes"`
+	Includes map[string]struct {
+		SHA1 string `json:"sha1"`
+	} `json:"includes"`
+}
+
+// composerVersion is the metadata for a single version of a package. We only
+// look at some of the fields, but keep all of them to pass them through to
+// the generated metadata.
+type composerVersion map[string]json.RawMessage
+
+type composerDist struct {
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Reference string `json:"reference"`
+	SHA1      string `json:"shasum"`
+}
+
+// ListAllFiles implements the Source interface.
+func (s *ComposerSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	var root composerRoot
+	lerr := s.downloadAndParseJSON(ctx, "packages.json", nil, &root)
+	if lerr != nil {
+		return lerr
+	}
+
+	// the repository metadata is transferred at the very end, when all dist
+	// archives have already been uploaded (to avoid situations where a client
+	// might see repository metadata without being able to see the referenced
+	// archives)
+	var metadataFiles []FileSpec
+	var availablePackages []string
+
+	for _, pkg := range s.Packages {
+		versions, lerr := s.getPackageVersions(ctx, root, pkg.Name)
+		if lerr != nil {
+			return lerr
+		}
+
+		var selectedVersions []composerVersion
+		for _, version := range versions {
+			versionString := version.getString("version")
+			normalizedVersion := version.getString("version_normalized")
+			if normalizedVersion == "" {
+				normalizedVersion = versionString
+			}
+			// development versions point to branches, so there is no stable archive to mirror
+			if strings.HasPrefix(normalizedVersion, "dev-") || strings.HasSuffix(normalizedVersion, "-dev") {
+				continue
+			}
+			if rx, ok := pkg.Versions.Unpack(); ok && !rx.MatchString(versionString) {
+				continue
+			}
+
+			var dist composerDist
+			err := json.Unmarshal(version["dist"], &dist)
+			if err != nil || dist.URL == "" {
+				// versions without a dist archive cannot be mirrored
+				continue
+			}
+
+			fileName := normalizedVersion
+			if dist.Reference != "" {
+				fileName += "-" + dist.Reference
+			}
+			spec := FileSpec{
+				Path:         path.Join("dists", pkg.Name, fileName+"."+dist.Type),
+				DownloadPath: dist.URL,
+			}
+			if dist.SHA1 != "" {
+				spec.ExpectedChecksum = &Checksum{Algorithm: "sha1", Value: dist.SHA1}
+			}
+			out <- spec
+
+			// rewrite the dist URL to refer to the transferred archive
+			err = version.setDistURL(s.PublicURLString + spec.Path)
+			if err != nil {
+				return &ListEntriesError{Location: s.URLString, Message: "cannot rewrite dist URL for " + pkg.Name, Inner: err}
+			}
+			selectedVersions = append(selectedVersions, version)
+		}
+
+		buf, err := json.Marshal(map[string]any{
+			"packages": map[string][]composerVersion{pkg.Name: selectedVersions},
+		})
+		if err != nil {
+			return &ListEntriesError{Location: s.URLString, Message: "cannot render metadata for " + pkg.Name, Inner: err}
+		}
+		metadataFiles = append(metadataFiles, generatedFileSpec(path.Join("p2", pkg.Name+".json"), buf, "application/json"))
+		availablePackages = append(availablePackages, pkg.Name)
+	}
+
+	buf, err := json.Marshal(map[string]any{
+		"packages":           []string{},
+		"metadata-url":       s.PublicURLString + "p2/%package%.json",
+		"available-packages": availablePackages,
+	})
+	if err != nil {
+		return &ListEntriesError{Location: s.URLString, Message: "cannot render packages.json", Inner: err}
+	}
+	metadataFiles = append(metadataFiles, generatedFileSpec("packages.json", buf, "application/json"))
+
+	for _, file := range metadataFiles {
+		out <- file
+	}
+	return nil
+}
+
+// Helper function for ComposerSource.ListAllFiles(). Returns the empty string
+// if the field is missing or not a string.
+func (v composerVersion) getString(key string) string {
+	var result string
+	err := json.Unmarshal(v[key], &result)
+	if err != nil {
+		return ""
+	}
+	return result
+}
+
+// Helper function for ComposerSource.ListAllFiles().
+func (v composerVersion) setDistURL(distURL string) error {
+	var dist map[string]any
+	err := json.Unmarshal(v["dist"], &dist)
+	if err != nil {
+		return err
+	}
+	dist["url"] = distURL
+	v["dist"], err = json.Marshal(dist)
+	return err
+}
+
+// Helper function for ComposerSource.ListAllFiles().
+func (s *ComposerSource) getPackageVersions(ctx context.Context, root composerRoot, packageName string) ([]composerVersion, *ListEntriesError) {
+	// Composer v2 repository
+	if root.MetadataURL != "" {
+		var data struct {
+			Packages map[string][]composerVersion `json:"packages"`
+			Minified string                       `json:"minified"`
+		}
+		metadataPath := strings.ReplaceAll(root.MetadataURL, "%package%", packageName)
+		lerr := s.downloadAndParseJSON(ctx, metadataPath, nil, &data)
+		if lerr != nil {
+			return nil, lerr
+		}
+		if data.Minified == "composer/2.0" {
+			return expandComposerVersions(data.Packages[packageName]), nil
+		}
+		return data.Packages[packageName], nil
+	}
+
+	// Composer v1 repository with providers
+	if root.ProvidersURL != "" {
+		for includePathTemplate, include := range root.ProviderIncludes {
+			var data struct {
+				Providers map[string]struct {
+					SHA256 string `json:"sha256"`
+				} `json:"providers"`
+			}
+			includePath := strings.ReplaceAll(includePathTemplate, "%hash%", include.SHA256)
+			lerr := s.downloadAndParseJSON(ctx, includePath, &Checksum{Algorithm: "sha256", Value: include.SHA256}, &data)
+			if lerr != nil {
+				return nil, lerr
+			}
+			provider, exists := data.Providers[packageName]
+			if !exists {
+				continue
+			}
+
+			var pkgData composerRoot
+			packagePath := strings.ReplaceAll(root.ProvidersURL, "%package%", packageName)
+			packagePath = strings.ReplaceAll(packagePath, "%hash%", provider.SHA256)
+			lerr = s.downloadAndParseJSON(ctx, packagePath, &Checksum{Algorithm: "sha256", Value: provider.SHA256}, &pkgData)
+			if lerr != nil {
+				return nil, lerr
+			}
+			return flattenComposerVersions(pkgData.Packages[packageName]), nil
+		}
+		return nil, &ListEntriesError{Location: s.URLString, Message: fmt.Sprintf("package %q not found in any provider-includes", packageName)}
+	}
+
+	// repository with inline metadata
+	versions := flattenComposerVersions(root.Packages[packageName])
+	for _, includePath := range slices.Sorted(maps.Keys(root.Includes)) {
+		var data composerRoot
+		checksum := Checksum{Algorithm: "sha1", Value: root.Includes[includePath].SHA1}
+		lerr := s.downloadAndParseJSON(ctx, includePath, &checksum, &data)
+		if lerr != nil {
+			return nil, lerr
+		}
+		versions = append(versions, flattenComposerVersions(data.Packages[packageName])...)
+	}
+	if len(versions) == 0 {
+		return nil, &ListEntriesError{Location: s.URLString, Message: fmt.Sprintf("package %q not found", packageName)}
+	}
+	return versions, nil
+}
+
+// flattenComposerVersions converts the Composer v1 metadata format (a map
+// from version string to version metadata) into the v2 format (a list).
+func flattenComposerVersions(versions map[string]composerVersion) []composerVersion {
+	result := make([]composerVersion, 0, len(versions))
+	// sort to ensure that the generated metadata is stable across runs
+	for _, key := range slices.Sorted(maps.Keys(versions)) {
+		result = append(result, versions[key])
+	}
+	return result
+}
+
+// expandComposerVersions expands the minified Composer v2 metadata format,
+// where each version only lists those fields that differ from the previous
+// version, with the special value "__unset" marking fields that are absent.
+func expandComposerVersions(minified []composerVersion) []composerVersion {
+	result := make([]composerVersion, 0, len(minified))
+	var previous composerVersion
+	for _, entry := range minified {
+		expanded := make(composerVersion, len(previous)+len(entry))
+		maps.Copy(expanded, previous)
+		for key, value := range entry {
+			if string(value) == `"__unset"` {
+				delete(expanded, key)
+			} else {
+				expanded[key] = value
+			}
+		}
+		result = append(result, expanded)
+		previous = expanded
+	}
+	return result
+}
+
+// Helper function for ComposerSource.ListAllFiles().
+//
+// The given path may be relative to the repository URL, or relative to the
+// server root (with a leading slash), or a full URL.
+func (s *ComposerSource) downloadAndParseJSON(ctx context.Context, filePath string, checksum *Checksum, data any) *ListEntriesError {
+	ref, err := url.Parse(filePath)
+	if err != nil {
+		return &ListEntriesError{Location: s.URLString, Message: "invalid path in repository metadata: " + filePath, Inner: err}
+	}
+	uri := s.urlSource.URL.ResolveReference(ref).String()
+
+	buf, _, lerr := s.urlSource.getURLContents(ctx, uri)
+	if lerr != nil {
+		return lerr
+	}
+	if checksum != nil {
+		err := checksum.Verify(buf)
+		if err != nil {
+			return &ListEntriesError{Location: uri, Message: "file does not match repository metadata", Inner: err}
+		}
+	}
+	err = json.Unmarshal(buf, data)
+	if err != nil {
+		return &ListEntriesError{Location: uri, Message: "error while parsing JSON", Inner: err}
+	}
+	return nil
+}
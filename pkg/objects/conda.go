@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/regexpext"
+	. "go.xyrillian.de/gg/option"
+	"go.xyrillian.de/schwift/v2"
+)
+
+// CondaSource is a URLSource containing a Conda channel. This type reuses the
+// Validate() and Connect() logic of URLSource, but adds a custom scraping
+// implementation that reads the repodata.json of each subdir instead of
+// relying on directory listings.
+//
+// Since only a subset of the channel is usually mirrored, the repodata.json
+// files are not transferred verbatim. Instead, they are rewritten to only
+// contain the packages that were selected by the configured filters.
+type CondaSource struct {
+	// options from config file
+	URLString                string               `yaml:"url"`
+	ClientCertificatePath    string               `yaml:"cert"`
+	ClientCertificateKeyPath string               `yaml:"key"`
+	ServerCAPath             string               `yaml:"ca"`
+	Subdirs                  []string             `yaml:"subdir"`
+	Packages                 []CondaPackageFilter `yaml:"packages"`
+	// compiled configuration
+	urlSource *URLSource `yaml:"-"`
+}
+
+// CondaPackageFilter appears in the CondaSource configuration. A package is
+// selected if its name matches and, if given, its version and build string
+// also match.
+type CondaPackageFilter struct {
+	Name    regexpext.BoundedRegexp         `yaml:"name"`
+	Version Option[regexpext.BoundedRegexp] `yaml:"version"`
+	Build   Option[regexpext.BoundedRegexp] `yaml:"build"`
+}
+
+// Validate implements the Source interface.
+func (s *CondaSource) Validate(name string) []error {
+	s.urlSource = &URLSource{
+		URLString:                s.URLString,
+		ClientCertificatePath:    s.ClientCertificatePath,
+		ClientCertificateKeyPath: s.ClientCertificateKeyPath,
+		ServerCAPath:             s.ServerCAPath,
+	}
+	errs := s.urlSource.Validate(name)
+
+	if len(s.Subdirs) == 0 {
+		errs = append(errs, fmt.Errorf("missing value for %s.subdir", name))
+	}
+	for idx, subdir := range s.Subdirs {
+		if subdir == "" || strings.Contains(subdir, "/") {
+			errs = append(errs, fmt.Errorf("invalid value for %s.subdir[%d]: %q", name, idx, subdir))
+		}
+	}
+	for idx, filter := range s.Packages {
+		if filter.Name == "" {
+			errs = append(errs, fmt.Errorf("missing value for %s.packages[%d].name", name, idx))
+		}
+	}
+
+	return errs
+}
+
+// Connect implements the Source interface.
+func (s *CondaSource) Connect(ctx context.Context, name string) error {
+	return s.urlSource.Connect(ctx, name)
+}
+
+// ListEntries implements the Source interface.
+func (s *CondaSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+// GetFile implements the Source interface.
+func (s *CondaSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	return s.urlSource.GetFile(ctx, path, requestHeaders)
+}
+
+// condaPackageRecord contains the fields of a package record in a
+// repodata.json that we are interested in. All other fields are passed
+// through unchanged when the repodata.json is rewritten.
+type condaPackageRecord struct {
+	Name      string  `json:"name"`
+	Version   string  `json:"version"`
+	Build     string  `json:"build"`
+	MD5       string  `json:"md5"`
+	SHA256    string  `json:"sha256"`
+	SizeBytes *uint64 `json:"size"`
+}
+
+// The keys in repodata.json that contain package records.
+var condaPackageKeys = []string{"packages", "packages.conda"}
+
+// ListAllFiles implements the Source interface.
+func (s *CondaSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	cache := make(map[string]FileSpec)
+
+	// the rewritten repodata files are transferred at the very end, when all
+	// packages have already been uploaded (to avoid situations where a client
+	// might see repository metadata without being able to see the referenced
+	// packages)
+	var metadataFiles []FileSpec
+
+	// since current_repodata.json is a subset of repodata.json, a record of
+	// unique files is kept in order to avoid duplicates
+	transferred := make(map[string]bool)
+
+	for _, subdir := range s.Subdirs {
+		// current_repodata.json is optional and only contains the latest
+		// version of each package, so it is always a subset of repodata.json
+		for _, fileName := range []string{"repodata.json", "current_repodata.json"} {
+			repodataPath := path.Join(subdir, fileName)
+			buf, uri, lerr := s.urlSource.getFileContents(ctx, repodataPath, cache)
+			if lerr != nil {
+				if fileName == "current_repodata.json" && lerr.isNotFound() {
+					continue
+				}
+				return lerr
+			}
+
+			filtered, packages, err := s.filterRepodata(buf)
+			if err != nil {
+				return &ListEntriesError{
+					Location: uri,
+					Message:  "error while parsing repodata",
+					Inner:    err,
+				}
+			}
+
+			for _, pkg := range packages {
+				pkg.Path = path.Join(subdir, pkg.Path)
+				if !transferred[pkg.Path] {
+					out <- pkg
+					transferred[pkg.Path] = true
+				}
+			}
+			metadataFiles = append(metadataFiles, generatedFileSpec(repodataPath, filtered, "application/json"))
+		}
+	}
+
+	for _, file := range metadataFiles {
+		out <- file
+	}
+
+	return nil
+}
+
+// Helper function for CondaSource.ListAllFiles().
+//
+// Returns the rewritten repodata.json, and the FileSpecs for all selected
+// packages (with paths relative to the subdir).
+func (s *CondaSource) filterRepodata(buf []byte) (filtered []byte, packages []FileSpec, err error) {
+	var repodata map[string]json.RawMessage
+	err = json.Unmarshal(buf, &repodata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range condaPackageKeys {
+		rawRecords, exists := repodata[key]
+		if !exists {
+			continue
+		}
+		var records map[string]json.RawMessage
+		err = json.Unmarshal(rawRecords, &records)
+		if err != nil {
+			return nil, nil, fmt.Errorf("while parsing %q: %w", key, err)
+		}
+
+		selectedRecords := make(map[string]json.RawMessage)
+		for fileName, rawRecord := range records {
+			var record condaPackageRecord
+			err = json.Unmarshal(rawRecord, &record)
+			if err != nil {
+				return nil, nil, fmt.Errorf("while parsing %q.%q: %w", key, fileName, err)
+			}
+			if !s.selectsPackage(record) {
+				continue
+			}
+			selectedRecords[fileName] = rawRecord
+
+			spec := FileSpec{
+				Path:              fileName,
+				ExpectedSizeBytes: record.SizeBytes,
+			}
+			switch {
+			case record.SHA256 != "":
+				spec.ExpectedChecksum = &Checksum{Algorithm: "sha256", Value: record.SHA256}
+			case record.MD5 != "":
+				spec.ExpectedChecksum = &Checksum{Algorithm: "md5", Value: record.MD5}
+			}
+			packages = append(packages, spec)
+		}
+
+		repodata[key], err = json.Marshal(selectedRecords)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// make the order of transfers deterministic
+	slices.SortFunc(packages, func(lhs, rhs FileSpec) int {
+		return strings.Compare(lhs.Path, rhs.Path)
+	})
+
+	filtered, err = json.Marshal(repodata)
+	return filtered, packages, err
+}
+
+// Helper function for CondaSource.ListAllFiles().
+func (s *CondaSource) selectsPackage(record condaPackageRecord) bool {
+	if len(s.Packages) == 0 {
+		return true
+	}
+	for _, filter := range s.Packages {
+		if !filter.Name.MatchString(record.Name) {
+			continue
+		}
+		if rx, ok := filter.Version.Unpack(); ok && !rx.MatchString(record.Version) {
+			continue
+		}
+		if rx, ok := filter.Build.Unpack(); ok && !rx.MatchString(record.Build) {
+			continue
+		}
+		return true
+	}
+	return false
+}
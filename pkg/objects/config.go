@@ -5,6 +5,8 @@ package objects
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
@@ -26,6 +28,7 @@ type Configuration struct {
 	} `yaml:"workers"`
 	Statsd     StatsdConfiguration `yaml:"statsd"`
 	GPG        GPGConfiguration    `yaml:"gpg"`
+	Spool      SpoolConfiguration  `yaml:"spool"`
 	JobConfigs []JobConfiguration  `yaml:"jobs"`
 	Jobs       []*Job              `yaml:"-"`
 }
@@ -57,8 +60,13 @@ func ReadConfiguration(ctx context.Context, path string) (*Configuration, []erro
 	cfg.Swift.ValidateIgnoreEmptyContainer = true
 	errors := cfg.Swift.Validate("swift")
 
+	err = cfg.Spool.open()
+	if err != nil {
+		errors = append(errors, err)
+	}
+
 	// gpgKeyRing is used to cache GPG public keys. It is passed on and shared
-	// across all Debian/Yum jobs.
+	// across all Debian/Yum/GitHub jobs.
 	var gpgCacheContainer *schwift.Container
 	if cfg.GPG.CacheContainerName != nil && *cfg.GPG.CacheContainerName != "" {
 		cntrName := *cfg.GPG.CacheContainerName
@@ -174,7 +182,8 @@ func (u *SourceUnmarshaler) UnmarshalYAML(unmarshal func(any) error) error {
 	}
 
 	// look at keys to determine whether this is a URLSource or a SwiftSource
-	if probe.URL == "" {
+	// (custom source types may discover their URL in other ways)
+	if probe.URL == "" && probe.Type == "" {
 		u.Source = &SwiftLocation{}
 	} else {
 		switch probe.Type {
@@ -184,8 +193,24 @@ func (u *SourceUnmarshaler) UnmarshalYAML(unmarshal func(any) error) error {
 			u.Source = &YumSource{}
 		case "debian":
 			u.Source = &DebianSource{}
+		case "suse-service":
+			u.Source = &SUSEServiceSource{}
 		case "github-releases":
 			u.Source = &GithubReleaseSource{}
+		case "github-tags":
+			u.Source = &GithubTagSource{}
+		case "conda":
+			u.Source = &CondaSource{}
+		case "nuget":
+			u.Source = &NuGetSource{}
+		case "rubygems":
+			u.Source = &RubyGemsSource{}
+		case "composer":
+			u.Source = &ComposerSource{}
+		case "cran":
+			u.Source = &CRANSource{}
+		case "ostree":
+			u.Source = &OSTreeSource{}
 		default:
 			return fmt.Errorf("unexpected value: type = %q", probe.Type)
 		}
@@ -249,10 +274,16 @@ func (cfg JobConfiguration) Compile(ctx context.Context, name string, swift Swif
 	_, isYumSource := jobSrc.(*YumSource)
 	if isYumSource {
 		jobSrc.(*YumSource).gpgKeyRing = cfg.gpgKeyRing
+		jobSrc.(*YumSource).target = cfg.Target
+	}
+	if suseSrc, ok := jobSrc.(*SUSEServiceSource); ok {
+		suseSrc.gpgKeyRing = cfg.gpgKeyRing
+		suseSrc.target = cfg.Target
 	}
 	_, isDebianSource := jobSrc.(*DebianSource)
 	if isDebianSource {
 		jobSrc.(*DebianSource).gpgKeyRing = cfg.gpgKeyRing
+		jobSrc.(*DebianSource).target = cfg.Target
 	}
 
 	if cfg.Segmenting != nil {
@@ -298,6 +329,17 @@ func (cfg JobConfiguration) Compile(ctx context.Context, name string, swift Swif
 	}
 	if githubSrc, ok := jobSrc.(*GithubReleaseSource); ok {
 		githubSrc.notOlderThan = job.Matcher.NotOlderThan
+		githubSrc.target = cfg.Target
+		githubSrc.gpgKeyRing = cfg.gpgKeyRing
+	}
+	if yumSrc, ok := jobSrc.(*YumSource); ok {
+		yumSrc.runFingerprint = cfg.runFingerprint(yumSrc.fingerprintOptions())
+	}
+	if suseSrc, ok := jobSrc.(*SUSEServiceSource); ok {
+		suseSrc.runFingerprint = cfg.runFingerprint(suseSrc.fingerprintOptions())
+	}
+	if debianSrc, ok := jobSrc.(*DebianSource); ok {
+		debianSrc.runFingerprint = cfg.runFingerprint(debianSrc.fingerprintOptions())
 	}
 
 	// do not try connecting to Swift if credentials are invalid etc.
@@ -328,3 +370,25 @@ func (cfg JobConfiguration) Compile(ctx context.Context, name string, swift Swif
 
 	return
 }
+
+// Helper function for JobConfiguration.Compile().
+//
+// Returns a digest of the given source options and of the job options that
+// affect which files are transferred. Sources that skip unchanged
+// repositories only do so if the previous run was completed with the same
+// fingerprint (see CompletedRunRecorder).
+func (cfg JobConfiguration) runFingerprint(sourceOptions any) string {
+	buf, err := json.Marshal([]any{
+		sourceOptions,
+		cfg.ExcludePattern,
+		cfg.IncludePattern,
+		cfg.ImmutableFilePattern,
+		cfg.Cleanup.Strategy,
+	})
+	if err != nil {
+		// cannot happen since all inputs are plain data; but if it does, no
+		// run will ever be considered complete, which is safe
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(buf))
+}
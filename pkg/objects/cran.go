@@ -0,0 +1,261 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/logg"
+	"go.xyrillian.de/schwift/v2"
+	"pault.ag/go/debian/control"
+)
+
+// CRANSource is a URLSource containing a CRAN-style repository of R packages.
+// This type reuses the Validate() and Connect() logic of URLSource, but adds a
+// custom scraping implementation that reads the PACKAGES index of each
+// package tree instead of relying on directory listings.
+//
+// If only a subset of the packages is selected, the PACKAGES indices are
+// rewritten to only contain the selected packages and their dependencies.
+type CRANSource struct {
+	// options from config file
+	URLString                string   `yaml:"url"`
+	ClientCertificatePath    string   `yaml:"cert"`
+	ClientCertificateKeyPath string   `yaml:"key"`
+	ServerCAPath             string   `yaml:"ca"`
+	Trees                    []string `yaml:"trees"`
+	Packages                 []string `yaml:"packages"`
+	// compiled configuration
+	urlSource *URLSource `yaml:"-"`
+}
+
+// Validate implements the Source interface.
+func (s *CRANSource) Validate(name string) []error {
+	s.urlSource = &URLSource{
+		URLString:                s.URLString,
+		ClientCertificatePath:    s.ClientCertificatePath,
+		ClientCertificateKeyPath: s.ClientCertificateKeyPath,
+		ServerCAPath:             s.ServerCAPath,
+	}
+	errs := s.urlSource.Validate(name)
+
+	if len(s.Trees) == 0 {
+		s.Trees = []string{"src/contrib"}
+	}
+	for idx, tree := range s.Trees {
+		if tree == "" || strings.HasPrefix(tree, "/") || strings.HasSuffix(tree, "/") {
+			errs = append(errs, fmt.Errorf("invalid value for %s.trees[%d]: %q", name, idx, tree))
+		}
+	}
+	for idx, pkgName := range s.Packages {
+		if pkgName == "" {
+			errs = append(errs, fmt.Errorf("missing value for %s.packages[%d]", name, idx))
+		}
+	}
+
+	return errs
+}
+
+// Connect implements the Source interface.
+func (s *CRANSource) Connect(ctx context.Context, name string) error {
+	return s.urlSource.Connect(ctx, name)
+}
+
+// ListEntries implements the Source interface.
+func (s *CRANSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+// GetFile implements the Source interface.
+func (s *CRANSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	return s.urlSource.GetFile(ctx, path, requestHeaders)
+}
+
+// cranPackage is an entry in a PACKAGES index.
+type cranPackage struct {
+	Package   string `control:"Package"`
+	Version   string `control:"Version"`
+	Depends   string `control:"Depends"`
+	Imports   string `control:"Imports"`
+	LinkingTo string `control:"LinkingTo"`
+	MD5sum    string `control:"MD5sum"`
+	File      string `control:"File"`
+	Path      string `control:"Path"`
+	// the original paragraph from the PACKAGES index (without the trailing
+	// blank line), which is used when the index is rewritten
+	raw string
+}
+
+// ListAllFiles implements the Source interface.
+func (s *CRANSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	cache := make(map[string]FileSpec)
+
+	// the rewritten PACKAGES indices are transferred at the very end, when all
+	// packages have already been uploaded (to avoid situations where a client
+	// might see repository metadata without being able to see the referenced
+	// packages)
+	var metadataFiles []FileSpec
+
+	for _, tree := range s.Trees {
+		// prefer the compressed index, but some repos only have the uncompressed one
+		buf, uri, lerr := s.urlSource.getFileContents(ctx, path.Join(tree, "PACKAGES.gz"), cache)
+		if lerr != nil {
+			buf, uri, lerr = s.urlSource.getFileContents(ctx, path.Join(tree, "PACKAGES"), cache)
+			if lerr != nil {
+				return lerr
+			}
+		}
+		if bytes.HasPrefix(buf, gzipMagicNumber) {
+			var err error
+			buf, err = decompressGZipArchive(buf)
+			if err != nil {
+				return &ListEntriesError{Location: uri, Message: "cannot decompress gzip stream", Inner: err}
+			}
+		}
+
+		packages, err := parseCRANPackages(buf)
+		if err != nil {
+			return &ListEntriesError{Location: uri, Message: "error while parsing PACKAGES index", Inner: err}
+		}
+		selected, err := selectCRANPackages(packages, s.Packages)
+		if err != nil {
+			return &ListEntriesError{Location: uri, Message: "cannot select packages", Inner: err}
+		}
+
+		var index bytes.Buffer
+		for _, pkg := range selected {
+			spec := FileSpec{Path: path.Join(tree, pkg.Path, pkg.FileName(tree))}
+			if pkg.MD5sum != "" {
+				spec.ExpectedChecksum = &Checksum{Algorithm: "md5", Value: pkg.MD5sum}
+			}
+			out <- spec
+
+			index.WriteString(pkg.raw)
+			index.WriteString("\n\n")
+		}
+
+		indexGZ, err := compressGZipArchive(index.Bytes())
+		if err != nil {
+			return &ListEntriesError{Location: uri, Message: "cannot compress PACKAGES index", Inner: err}
+		}
+		metadataFiles = append(metadataFiles,
+			generatedFileSpec(path.Join(tree, "PACKAGES"), index.Bytes(), "text/plain; charset=utf-8"),
+			generatedFileSpec(path.Join(tree, "PACKAGES.gz"), indexGZ, "application/gzip"),
+		)
+	}
+
+	for _, file := range metadataFiles {
+		out <- file
+	}
+
+	return nil
+}
+
+// FileName returns the name of the package archive. The file extension
+// depends on the type of tree that the package is in.
+func (p cranPackage) FileName(tree string) string {
+	if p.File != "" {
+		return p.File
+	}
+	ext := ".tar.gz"
+	switch {
+	case strings.HasPrefix(tree, "bin/windows/"):
+		ext = ".zip"
+	case strings.HasPrefix(tree, "bin/macosx/"):
+		ext = ".tgz"
+	}
+	return p.Package + "_" + p.Version + ext
+}
+
+// DependencyNames returns the names of all packages that this package
+// requires for installation.
+func (p cranPackage) DependencyNames() []string {
+	var result []string
+	for _, field := range []string{p.Depends, p.Imports, p.LinkingTo} {
+		for dep := range strings.SplitSeq(field, ",") {
+			// strip version constraints, e.g. "Rcpp (>= 1.0.0)" -> "Rcpp"
+			name, _, _ := strings.Cut(strings.TrimSpace(dep), "(")
+			name = strings.TrimSpace(name)
+			// "R" refers to the R version itself, not to a package
+			if name != "" && name != "R" {
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// parseCRANPackages parses a PACKAGES index.
+func parseCRANPackages(buf []byte) ([]cranPackage, error) {
+	var result []cranPackage
+	for _, paragraph := range splitDebianParagraphs(buf) {
+		var pkg cranPackage
+		err := control.Unmarshal(&pkg, strings.NewReader(paragraph))
+		if err != nil {
+			return nil, err
+		}
+		if pkg.Package == "" || pkg.Version == "" {
+			return nil, fmt.Errorf("missing Package or Version field in paragraph: %q", paragraph)
+		}
+		pkg.raw = paragraph
+		result = append(result, pkg)
+	}
+	return result, nil
+}
+
+// selectCRANPackages returns the packages with the given names and all
+// their transitive dependencies, in the order in which they appear in the
+// index. If no names are given, all packages are selected.
+//
+// Dependencies that are not in the index are ignored since they usually
+// refer to base packages that are shipped with R itself (e.g. "methods" or
+// "utils"), or to packages from other repositories.
+func selectCRANPackages(packages []cranPackage, names []string) ([]cranPackage, error) {
+	if len(names) == 0 {
+		return packages, nil
+	}
+
+	byName := make(map[string]cranPackage, len(packages))
+	for _, pkg := range packages {
+		byName[pkg.Package] = pkg
+	}
+	for _, name := range names {
+		if _, exists := byName[name]; !exists {
+			return nil, fmt.Errorf("package %q not found", name)
+		}
+	}
+
+	isSelected := make(map[string]bool)
+	queue := slices.Clone(names)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if isSelected[name] {
+			continue
+		}
+		pkg, exists := byName[name]
+		if !exists {
+			logg.Debug("ignoring CRAN dependency %q that is not in the index", name)
+			continue
+		}
+		isSelected[name] = true
+		queue = append(queue, pkg.DependencyNames()...)
+	}
+
+	var result []cranPackage
+	for _, pkg := range packages {
+		if isSelected[pkg.Package] {
+			result = append(result, pkg)
+			// in case of duplicate entries, only the first one is used
+			delete(isSelected, pkg.Package)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"testing"
+
+	"github.com/sapcc/go-bits/must"
+	"go.xyrillian.de/gg/assert"
+)
+
+const testCRANPackages = `Package: A3
+Version: 1.0.0
+Depends: R (>= 2.15.0), xtable, pbapply
+Suggests: randomForest, e1071
+License: GPL (>= 2)
+MD5sum: 027ebdd8affce8f0effaecfcd5f5ade2
+NeedsCompilation: no
+
+Package: pbapply
+Version: 1.7-2
+Depends: R (>= 3.2.0)
+Imports: parallel
+License: GPL (>= 2)
+MD5sum: 0ba1f4ac8d5e0e4a5a1fa6a3c4b9d111
+
+Package: xtable
+Version: 1.8-4
+Depends: R (>= 2.10.0)
+Imports: stats,
+        utils
+License: GPL (>= 2)
+MD5sum: ebb22e9c3c5e1a9f1f2e2e3c4d5e6f70
+
+Package: zoo
+Version: 1.8-12
+Depends: R (>= 3.1.0), stats
+License: GPL-2 | GPL-3
+MD5sum: 2b8d4f3a4e5f6a7b8c9d0e1f2a3b4c5d
+`
+
+func TestSelectCRANPackages(t *testing.T) {
+	packages := must.ReturnT(parseCRANPackages([]byte(testCRANPackages)))(t)
+	assert.Equal(t, len(packages), 4)
+	assert.Equal(t, packages[2].DependencyNames(), []string{"stats", "utils"})
+	assert.Equal(t, packages[0].FileName("src/contrib"), "A3_1.0.0.tar.gz")
+	assert.Equal(t, packages[0].FileName("bin/windows/contrib/4.4"), "A3_1.0.0.zip")
+
+	// selecting A3 pulls in its dependencies (but not its suggestions, and not
+	// base packages like "stats" that are not in the index)
+	selected := must.ReturnT(selectCRANPackages(packages, []string{"A3"}))(t)
+	var names []string
+	for _, pkg := range selected {
+		names = append(names, pkg.Package)
+	}
+	assert.Equal(t, names, []string{"A3", "pbapply", "xtable"})
+	assert.Equal(t, selected[2].raw, "Package: xtable\nVersion: 1.8-4\nDepends: R (>= 2.10.0)\nImports: stats,\n        utils\nLicense: GPL (>= 2)\nMD5sum: ebb22e9c3c5e1a9f1f2e2e3c4d5e6f70")
+
+	// selecting nothing selects everything
+	selected = must.ReturnT(selectCRANPackages(packages, nil))(t)
+	assert.Equal(t, len(selected), 4)
+
+	// selecting an unknown package is an error
+	_, err := selectCRANPackages(packages, []string{"doesnotexist"})
+	assert.Equal(t, err != nil, true)
+}
@@ -4,6 +4,7 @@
 package objects
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"fmt"
@@ -90,38 +91,73 @@ func decompressGZipArchive(buf []byte) ([]byte, error) {
 	return decompBuf, nil
 }
 
-var xzMagicNumber = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
-
-// decompressXZArchive decompresses and returns the contents of a slice of xz
-// compressed bytes.
-func decompressXZArchive(buf []byte) ([]byte, error) {
-	reader, err := xz.NewReader(bytes.NewReader(buf))
+// compressGZipArchive compresses a slice of bytes with gzip. The gzip header
+// does not contain a timestamp, so the result only depends on the input.
+// Otherwise generated files would be re-uploaded on every run.
+func compressGZipArchive(buf []byte) ([]byte, error) {
+	var result bytes.Buffer
+	w := gzip.NewWriter(&result)
+	_, err := w.Write(buf)
 	if err != nil {
-		return nil, fmt.Errorf("while decompressing XZ archive: %w", err)
+		return nil, err
 	}
+	err = w.Close()
+	return result.Bytes(), err
+}
 
-	decompBuf, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, fmt.Errorf("while decompressing XZ archive: %w", err)
-	}
+var (
+	xzMagicNumber   = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
+	zstdMagicNumber = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
 
-	return decompBuf, nil
+// newDecompressingReader returns a reader for the contents of the given
+// buffer. If the buffer starts with the magic number for gzip, xz or zstd, the
+// contents are decompressed on the fly, so that large indices can be parsed
+// without holding their decompressed contents in memory.
+func newDecompressingReader(buf []byte) (io.ReadCloser, error) {
+	return newDecompressingStream(bytes.NewReader(buf))
 }
 
-var zstdMagicNumber = []byte{0x28, 0xb5, 0x2f, 0xfd}
-
-// decompressZSTDArchive decompresses and returns the contents of a slice of
-// zstd compressed bytes.
-func decompressZSTDArchive(buf []byte) ([]byte, error) {
-	reader, err := zstd.NewReader(bytes.NewReader(buf))
-	if err != nil {
-		return nil, fmt.Errorf("while decompressing zstd archive: %w", err)
+// newDecompressingStream is like newDecompressingReader, but reads the
+// (possibly compressed) contents from the given reader, so that neither the
+// compressed nor the decompressed contents need to be held in memory.
+func newDecompressingStream(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	// (read errors are ignored here since they will be reported by the next
+	// Read(); a short prefix just does not match any of the magic numbers)
+	prefix, _ := br.Peek(len(xzMagicNumber))
+
+	switch {
+	case bytes.HasPrefix(prefix, gzipMagicNumber):
+		reader, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("while decompressing GZip archive: %w", err)
+		}
+		return reader, nil
+	case bytes.HasPrefix(prefix, xzMagicNumber):
+		reader, err := xz.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("while decompressing XZ archive: %w", err)
+		}
+		return io.NopCloser(reader), nil
+	case bytes.HasPrefix(prefix, zstdMagicNumber):
+		decoder, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("while decompressing zstd archive: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
 	}
+}
 
-	decompBuf, err := io.ReadAll(reader)
+// decompressArchive is like newDecompressingReader, but returns the
+// decompressed contents all at once.
+func decompressArchive(buf []byte) ([]byte, error) {
+	reader, err := newDecompressingReader(buf)
 	if err != nil {
-		return nil, fmt.Errorf("while decompressing zstd archive: %w", err)
+		return nil, err
 	}
-
-	return decompBuf, nil
+	defer reader.Close()
+	return io.ReadAll(reader)
 }
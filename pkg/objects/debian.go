@@ -6,12 +6,22 @@ package objects
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"net/http"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
 	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/regexpext"
+	"github.com/sapcc/go-bits/secrets"
 	"go.xyrillian.de/schwift/v2"
 	"pault.ag/go/debian/control"
 
@@ -28,6 +38,20 @@ import (
 //	matchList[3] = "$ARCH"
 var debReleasePackagesEntryRx = regexp.MustCompile(`^([a-zA-Z]+)/(debian-installer/)?binary-(\w+)/Packages(\.gz|\.xz)$`)
 
+// Entries in a 'Release' file below '$COMP/', other than 'Packages' indices.
+// Reference:
+//
+//	'(Packages|Sources)(.gz|.xz)' in flat repositories (matchList[1] = "Packages" or "Sources")
+//	'(debian-installer/)binary-$ARCH/...' (matchList[1] = "$ARCH")
+//	'i18n/Translation-$LANG(.bz2|.gz|.xz)' (matchList[1] = "$LANG")
+//	'Contents-(udeb-)$ARCH(.gz)' (matchList[1] = "$ARCH"; also appears outside of '$COMP/')
+var (
+	debReleaseFlatIndexEntryRx   = regexp.MustCompile(`^(Packages|Sources)(?:\.gz|\.xz)?$`)
+	debReleaseBinaryEntryRx      = regexp.MustCompile(`^(?:debian-installer/)?binary-([^/]+)/`)
+	debReleaseTranslationEntryRx = regexp.MustCompile(`^i18n/Translation-([^/.]+)(?:\.\w+)?$`)
+	debReleaseContentsEntryRx    = regexp.MustCompile(`^Contents-(?:udeb-)?([^/.]+)(?:\.\w+)?$`)
+)
+
 // DebianSource is a URLSource containing a Debian repository. This type reuses
 // the Validate() and Connect() logic of URLSource, but adds a custom scraping
 // implementation that reads the Debian repository metadata instead of relying
@@ -39,12 +63,37 @@ type DebianSource struct {
 	ClientCertificateKeyPath string   `yaml:"key"`
 	ServerCAPath             string   `yaml:"ca"`
 	Distributions            []string `yaml:"dist"`
+	Components               []string `yaml:"components"`
 	Architectures            []string `yaml:"arch"`
+	Languages                []string `yaml:"languages"`
+	IncludeSources           *bool    `yaml:"include_sources"`
+	IncludeContents          *bool    `yaml:"include_contents"`
+	IncludeDep11             *bool    `yaml:"include_dep11"`
 	VerifySignature          *bool    `yaml:"verify_signature"`
+	ByHashGenerations        *uint    `yaml:"by_hash_generations"`
+	SkipUnchanged            *bool    `yaml:"skip_unchanged"`
+	PackageSigningKeys       []string `yaml:"package_signing_keys"`
+	// options for partial mirrors
+	Packages             []regexpext.BoundedRegexp `yaml:"packages"`
+	ResolveDependencies  bool                      `yaml:"resolve_dependencies"`
+	IncludeRecommends    bool                      `yaml:"include_recommends"`
+	SigningKeyPath       string                    `yaml:"signing_key"`
+	SigningKeyPassphrase secrets.FromEnv           `yaml:"signing_key_passphrase"`
 	// compiled configuration
-	urlSource       *URLSource       `yaml:"-"`
-	gpgVerification bool             `yaml:"-"`
-	gpgKeyRing      *util.GPGKeyRing `yaml:"-"`
+	urlSource         *URLSource          `yaml:"-"`
+	gpgVerification   bool                `yaml:"-"`
+	gpgKeyRing        *util.GPGKeyRing    `yaml:"-"`
+	byHashGenerations uint                `yaml:"-"`
+	signingKey        *util.GPGSigningKey `yaml:"-"`
+	skipUnchanged     bool                `yaml:"-"`
+	includeSources    bool                `yaml:"-"`
+	includeContents   bool                `yaml:"-"`
+	includeDep11      bool                `yaml:"-"`
+	runFingerprint    string              `yaml:"-"`
+	trustedKeys       util.GPGTrustSet    `yaml:"-"`
+	// the target of the job, to find by-hash files and release files from
+	// previous runs
+	target *SwiftLocation `yaml:"-"`
 }
 
 // Validate implements the Source interface.
@@ -59,11 +108,60 @@ func (s *DebianSource) Validate(name string) []error {
 	if s.VerifySignature != nil {
 		s.gpgVerification = *s.VerifySignature
 	}
-	return s.urlSource.Validate(name)
+	s.byHashGenerations = 2
+	if s.ByHashGenerations != nil {
+		s.byHashGenerations = *s.ByHashGenerations
+	}
+	s.skipUnchanged = true
+	if s.SkipUnchanged != nil {
+		s.skipUnchanged = *s.SkipUnchanged
+	}
+	s.includeSources = true
+	if s.IncludeSources != nil {
+		s.includeSources = *s.IncludeSources
+	}
+	s.includeContents = true
+	if s.IncludeContents != nil {
+		s.includeContents = *s.IncludeContents
+	}
+	s.includeDep11 = true
+	if s.IncludeDep11 != nil {
+		s.includeDep11 = *s.IncludeDep11
+	}
+
+	errs := s.urlSource.Validate(name)
+	if len(s.Packages) > 0 && s.SigningKeyPath == "" {
+		errs = append(errs, fmt.Errorf("missing value for %s.signing_key (required when %s.packages is given)", name, name))
+	}
+	if len(s.Packages) == 0 {
+		if s.ResolveDependencies {
+			errs = append(errs, fmt.Errorf("invalid value for %s.resolve_dependencies: this option requires %s.packages", name, name))
+		}
+		if s.IncludeRecommends {
+			errs = append(errs, fmt.Errorf("invalid value for %s.include_recommends: this option requires %s.packages", name, name))
+		}
+	}
+	if s.IncludeRecommends && !s.ResolveDependencies {
+		errs = append(errs, fmt.Errorf("invalid value for %s.include_recommends: this option requires %s.resolve_dependencies", name, name))
+	}
+	var err error
+	s.trustedKeys, err = util.ParseGPGTrustSet(s.PackageSigningKeys)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid value for %s.package_signing_keys: %w", name, err))
+	}
+	return errs
 }
 
 // Connect implements the Source interface.
 func (s *DebianSource) Connect(ctx context.Context, name string) error {
+	if s.SigningKeyPath != "" {
+		var err error
+		s.signingKey, err = util.LoadGPGSigningKey(s.SigningKeyPath, string(s.SigningKeyPassphrase))
+		if err != nil {
+			return fmt.Errorf("cannot load signing key: %w", err)
+		}
+		logg.Debug("signing key %s loaded from %s", s.signingKey.KeyID(), s.SigningKeyPath)
+	}
 	return s.urlSource.Connect(ctx, name)
 }
 
@@ -88,42 +186,181 @@ func (s *DebianSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *L
 
 	cache := make(map[string]FileSpec)
 
+	dists := make([]*debianDist, 0, len(s.Distributions))
+	for _, distName := range s.Distributions {
+		dist, lerr := s.prepareDist(ctx, distName, cache)
+		if lerr != nil {
+			return lerr
+		}
+		dists = append(dists, dist)
+	}
+
+	// if the release files of all distributions are identical to those in the
+	// target, and the previous run with the same configuration was completed
+	// without errors, there is no need to parse any indices (this does not
+	// apply to partial mirrors since their release files are regenerated and
+	// thus never identical)
+	if s.skipUnchanged && len(s.Packages) == 0 && s.target != nil {
+		isUnchanged, lerr := s.isUnchangedSinceCompletedRun(ctx, dists)
+		if lerr != nil {
+			return lerr
+		}
+		if isUnchanged {
+			logg.Info("skipping %s: repository metadata has not changed since the previous run", s.URLString)
+			for _, spec := range s.target.retainExistingFiles() {
+				out <- spec
+			}
+			return nil
+		}
+	}
+
 	// since package and source files for different distributions are kept in
 	// the common '$REPO_ROOT/pool' directory therefore a record of unique files
 	// is kept in order to avoid duplicates.
 	transferred := make(map[string]bool)
+	emit := func(file FileSpec) {
+		if !transferred[file.Path] {
+			out <- file
+			transferred[file.Path] = true
+		}
+	}
 
-	// index files for different distributions as specified in the config file
-	for _, distName := range s.Distributions {
-		distRootPath := filepath.Join("dists", distName)
-		distFiles, lerr := s.listDistFiles(ctx, distRootPath, cache)
+	if len(s.Packages) > 0 {
+		files, lerr := s.listFilteredFiles(ctx, dists, cache)
 		if lerr != nil {
 			return lerr
 		}
+		for _, file := range files {
+			emit(file)
+		}
+		return nil
+	}
+	for _, dist := range dists {
+		lerr := s.listDistFiles(ctx, dist, cache, emit)
+		if lerr != nil {
+			return lerr
+		}
+	}
+	return nil
+}
 
-		for _, file := range distFiles {
-			if !transferred[file] {
-				out <- getFileSpec(file, cache)
-				transferred[file] = true
-			}
+// debianRelease contains the fields of a release file that we are interested in.
+type debianRelease struct {
+	Date          string                   `control:"Date"`
+	ValidUntil    string                   `control:"Valid-Until"`
+	AcquireByHash string                   `control:"Acquire-By-Hash"`
+	Components    []string                 `control:"Components" delim:" " strip:" "`
+	Architectures []string                 `control:"Architectures" delim:" " strip:" "`
+	Entries       []control.SHA256FileHash `control:"SHA256" delim:"\n" strip:"\n\r\t "`
+}
+
+// debianDist describes a distribution whose release file has been downloaded
+// and verified.
+type debianDist struct {
+	// the directory containing the release file
+	RootPath string
+	IsFlat   bool
+	// the contents of the release file (without the signature, if any)
+	ReleaseText []byte
+	ReleaseURI  string
+	ReleasePath string
+	// the components and architectures that we are interested in
+	Components    []string
+	Architectures []string
+	// all files listed in the release file, with their paths relative to the
+	// repository root; every index that we parse, and every file below
+	// '$DIST_ROOT' that we transfer, is verified against these checksums
+	ReleaseFiles map[string]control.FileHash
+	// the files listed in the release file that we are interested in, relative
+	// to RootPath, in the order in which they appear in the release file
+	SelectedEntries []string
+	// some repos offer multiple compression types for the same 'Sources' and
+	// 'Packages' indices. These lists contain the indices without their file
+	// extension. This allows us to choose a compression type at the time of
+	// parsing and avoids parsing the same index multiple times.
+	PackageIndices []string
+	SourceIndices  []string
+	// if supported, indices are downloaded from their by-hash location to
+	// avoid races with updates of the repository (i.e. when the release file
+	// and the indices are updated in between our downloads)
+	ByHash bool
+	// whether the release file is identical to the one in the target
+	IsUnchanged bool
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// If this returns false, the record of the previous completed run is removed
+// from the target, since the target is not known to be complete until this
+// run has completed.
+func (s *DebianSource) isUnchangedSinceCompletedRun(ctx context.Context, dists []*debianDist) (bool, *ListEntriesError) {
+	isUnchanged := true
+	var completedRunPaths []string
+	for _, dist := range dists {
+		completedRun, err := s.target.getCompletedRun(ctx, dist.ReleasePath)
+		if err != nil {
+			return false, &ListEntriesError{Location: s.target.ObjectAtPath(dist.ReleasePath).FullName(), Message: "HEAD failed", Inner: err}
+		}
+		if completedRun != "" {
+			completedRunPaths = append(completedRunPaths, dist.ReleasePath)
 		}
+		if !dist.IsUnchanged || completedRun == "" || completedRun != s.runFingerprint {
+			isUnchanged = false
+		}
+	}
+	if isUnchanged {
+		return true, nil
 	}
 
+	for _, releasePath := range completedRunPaths {
+		err := s.target.recordCompletedRun(ctx, releasePath, "")
+		if err != nil {
+			return false, &ListEntriesError{Location: s.target.ObjectAtPath(releasePath).FullName(), Message: "POST failed", Inner: err}
+		}
+	}
+	return false, nil
+}
+
+// RecordCompletedRun implements the CompletedRunRecorder interface.
+func (s *DebianSource) RecordCompletedRun(ctx context.Context) error {
+	if !s.skipUnchanged || len(s.Packages) > 0 || s.target == nil {
+		return nil
+	}
+	for _, distName := range s.Distributions {
+		distRootPath, _ := debianDistRootPath(distName)
+		err := s.target.recordCompletedRun(ctx, filepath.Join(distRootPath, "InRelease"), s.runFingerprint)
+		if schwift.Is(err, http.StatusNotFound) {
+			// some older distros only have the legacy 'Release' file
+			err = s.target.recordCompletedRun(ctx, filepath.Join(distRootPath, "Release"), s.runFingerprint)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Helper function for JobConfiguration.Compile().
+//
+// Returns the options that affect which files are transferred, for the run
+// fingerprint.
+func (s *DebianSource) fingerprintOptions() any {
+	return []any{
+		s.URLString, s.Distributions, s.Components, s.Architectures, s.Languages,
+		s.includeSources, s.includeContents, s.includeDep11, s.byHashGenerations, s.PackageSigningKeys,
+	}
+}
+
 // Helper function for DebianSource.ListAllFiles().
-func (s *DebianSource) listDistFiles(ctx context.Context, distRootPath string, cache map[string]FileSpec) ([]string, *ListEntriesError) {
-	var distFiles []string
+//
+// Downloads, verifies and parses the release file of the given distribution.
+func (s *DebianSource) prepareDist(ctx context.Context, distName string, cache map[string]FileSpec) (*debianDist, *ListEntriesError) {
+	distRootPath, isFlat := debianDistRootPath(distName)
 
 	// parse 'inRelease' file to find paths of other control files
 	releasePath := filepath.Join(distRootPath, "InRelease")
 
-	var release struct {
-		Architectures []string                 `control:"Architectures" delim:" " strip:" "`
-		Entries       []control.SHA256FileHash `control:"SHA256" delim:"\n" strip:"\n\r\t "`
-	}
-
+	var release debianRelease
 	releaseBytes, releaseURI, lerr := s.downloadAndParseDCF(ctx, releasePath, &release, cache)
 	if lerr != nil {
 		// some older distros only have the legacy 'Release' file
@@ -162,24 +399,69 @@ func (s *DebianSource) listDistFiles(ctx context.Context, distRootPath string, c
 		logg.Debug("successfully verified GPG signature at %s for file %s", signatureURI, "-"+filepath.Base(releasePath))
 	}
 
-	// the architectures that we are interested in
-	architectures := release.Architectures
+	// refuse release files that are expired, or older than the one in the
+	// target (since these are validly signed, this would otherwise allow a
+	// stale or compromised mirror to roll back the repository)
+	previousBytes, previousDate, lerr := s.getPreviousRelease(ctx, releasePath)
+	if lerr != nil {
+		return nil, lerr
+	}
+	err := checkDebianReleaseDates(release.Date, release.ValidUntil, previousDate, time.Now())
+	if err != nil {
+		return nil, &ListEntriesError{
+			Location: releaseURI,
+			Message:  ErrMessageStaleMetadata,
+			Inner:    err,
+		}
+	}
+
+	dist := &debianDist{
+		RootPath:      distRootPath,
+		IsFlat:        isFlat,
+		ReleaseText:   releaseBytes,
+		ReleaseURI:    releaseURI,
+		ReleasePath:   releasePath,
+		Components:    release.Components,
+		Architectures: release.Architectures,
+		ReleaseFiles:  make(map[string]control.FileHash, len(release.Entries)),
+		ByHash:        release.AcquireByHash == "yes",
+		IsUnchanged:   previousBytes != nil && bytes.Equal(previousBytes, releaseBytes),
+	}
+	if block, _ := clearsign.Decode(releaseBytes); block != nil {
+		dist.ReleaseText = block.Plaintext
+	}
 	if len(s.Architectures) != 0 {
-		architectures = s.Architectures
+		dist.Architectures = s.Architectures
+	}
+	if len(s.Components) != 0 {
+		dist.Components = s.Components
 	}
 
-	// some repos offer multiple compression types for the same 'Sources' and
-	// 'Packages' indices. These maps contain the indices with out their file
-	// extension. This allows us to choose a compression type at the time of
-	// parsing and avoids parsing the same index multiple times.
+	// note control files for transfer
 	sourceIndices := make(map[string]bool)
 	packageIndices := make(map[string]bool)
-
-	// note control files for transfer
 	for _, entry := range release.Entries {
+		dist.ReleaseFiles[filepath.Join(distRootPath, entry.Filename)] = entry.FileHash
+		if !s.selectsReleaseEntry(entry.Filename, isFlat, dist.Components, dist.Architectures) {
+			continue
+		}
+		dist.SelectedEntries = append(dist.SelectedEntries, entry.Filename)
+
 		// entry.Filename is relative to distRootPath therefore
 		fileName := stripFileExtension(filepath.Join(distRootPath, entry.Filename))
 
+		// flat repositories have a single 'Packages' index for all architectures
+		if isFlat {
+			matchList := debReleaseFlatIndexEntryRx.FindStringSubmatch(entry.Filename)
+			if matchList != nil && matchList[1] == "Packages" {
+				packageIndices[fileName] = true
+			}
+			if matchList != nil && matchList[1] == "Sources" {
+				sourceIndices[fileName] = true
+			}
+			continue // to next entry
+		}
+
 		// note all 'Sources' indices as they are architecture independent
 		if strings.HasSuffix(entry.Filename, "Sources.gz") || strings.HasSuffix(entry.Filename, "Sources.xz") {
 			sourceIndices[fileName] = true
@@ -188,146 +470,535 @@ func (s *DebianSource) listDistFiles(ctx context.Context, distRootPath string, c
 
 		// note architecture specific 'Packages' indices
 		matchList := debReleasePackagesEntryRx.FindStringSubmatch(entry.Filename)
-		if matchList != nil {
-			for _, arch := range architectures {
-				if matchList[3] == arch {
-					packageIndices[fileName] = true
-				}
-			}
+		if matchList != nil && slices.Contains(dist.Architectures, matchList[3]) {
+			packageIndices[fileName] = true
 		}
 	}
+	dist.PackageIndices = slices.Sorted(maps.Keys(packageIndices))
+	dist.SourceIndices = slices.Sorted(maps.Keys(sourceIndices))
 
+	return dist, nil
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// Package and source files are passed to `emit` while the indices are being
+// parsed, the files in '$DIST_ROOT' are passed to `emit` afterwards.
+func (s *DebianSource) listDistFiles(ctx context.Context, dist *debianDist, cache map[string]FileSpec, emit func(FileSpec)) *ListEntriesError {
 	// parse 'Packages' indices to find paths for package files (.deb)
-	for pkgIndexPath := range packageIndices {
-		var packageIndex []struct {
-			Filename string `control:"Filename"`
-		}
-		// get package index from 'Packages.xz'
-		_, _, lerr = s.downloadAndParseDCF(ctx, pkgIndexPath+".xz", &packageIndex, cache)
+	for _, pkgIndexPath := range dist.PackageIndices {
+		lerr := streamDebianIndex(ctx, s, pkgIndexPath, dist, cache, func(pkg debianBinaryPackage) {
+			emit(s.debianPoolFileSpec(pkg.Filename, pkg.Size, pkg.SHA256))
+		})
 		if lerr != nil {
-			// some older distros only have 'Packages.gz'
-			_, _, lerr = s.downloadAndParseDCF(ctx, pkgIndexPath+".gz", &packageIndex, cache)
-			if lerr != nil {
-				return nil, lerr
+			return lerr
+		}
+	}
+
+	// parse 'Sources' indices to find paths for source files (.dsc, .tar.gz, etc.)
+	for _, srcIndexPath := range dist.SourceIndices {
+		lerr := streamDebianIndex(ctx, s, srcIndexPath, dist, cache, func(src debianSourcePackage) {
+			for _, file := range src.FileSpecs() {
+				emit(file)
 			}
+		})
+		if lerr != nil {
+			return lerr
 		}
+	}
 
-		for _, pkg := range packageIndex {
-			distFiles = append(distFiles, pkg.Filename)
+	// transfer files in '$DIST_ROOT' at the very end, when package and source
+	// files have already been uploaded (to avoid situations where a client
+	// might see repository metadata without being able to see the referenced
+	// packages); by-hash files come first since they are referenced by the
+	// release file, and the release files themselves come last
+	var distFiles, plainFiles []FileSpec
+	currentByHashFiles := make(map[string]bool)
+	for _, fileName := range dist.SelectedEntries {
+		filePath := filepath.Join(dist.RootPath, fileName)
+		spec, lerr := s.getDistFileSpec(ctx, filePath, dist.ReleaseFiles, cache)
+		if lerr != nil {
+			return lerr
+		}
+		if spec == nil {
+			continue
+		}
+		plainFiles = append(plainFiles, *spec)
+
+		if dist.ByHash {
+			byHashPath := debianByHashPath(filePath, dist.ReleaseFiles[filePath])
+			byHashSpec := getFileSpec(byHashPath, cache)
+			byHashSpec.IsImmutable = true
+			byHashSpec.ExpectedChecksum, byHashSpec.ExpectedSizeBytes = spec.ExpectedChecksum, spec.ExpectedSizeBytes
+			distFiles = append(distFiles, byHashSpec)
+			currentByHashFiles[byHashPath] = true
+		}
+	}
+	if dist.ByHash {
+		previousByHashFiles, lerr := s.listPreviousByHashFiles(ctx, dist.RootPath, currentByHashFiles)
+		if lerr != nil {
+			return lerr
+		}
+		distFiles = append(distFiles, previousByHashFiles...)
+	}
+	distFiles = append(distFiles, plainFiles...)
+	for _, fileName := range []string{"Release", "Release.gpg", "InRelease"} {
+		spec, lerr := s.getDistFileSpec(ctx, filepath.Join(dist.RootPath, fileName), dist.ReleaseFiles, cache)
+		if lerr != nil {
+			return lerr
+		}
+		if spec != nil {
+			distFiles = append(distFiles, *spec)
 		}
 	}
 
-	// parse 'Sources' indices to find paths for source files (.dsc, .tar.gz, etc.)
-	for srcIndexPath := range sourceIndices {
-		var sourceIndex []struct {
-			Directory string                `control:"Directory"`
-			Files     []control.MD5FileHash `control:"Files" delim:"\n" strip:"\n\r\t "`
+	for _, file := range distFiles {
+		emit(file)
+	}
+	return nil
+}
+
+// debianBinaryPackage is a paragraph in a 'Packages' index.
+type debianBinaryPackage struct {
+	Filename string `control:"Filename"`
+	Size     string `control:"Size"`
+	SHA256   string `control:"SHA256"`
+}
+
+// debianSourcePackage is a paragraph in a 'Sources' index.
+type debianSourcePackage struct {
+	Package         string                   `control:"Package"`
+	Directory       string                   `control:"Directory"`
+	Files           []control.MD5FileHash    `control:"Files" delim:"\n" strip:"\n\r\t "`
+	ChecksumsSHA256 []control.SHA256FileHash `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
+}
+
+// FileSpecs returns the files belonging to this source package (.dsc, .tar.gz, etc.).
+func (src debianSourcePackage) FileSpecs() []FileSpec {
+	// prefer SHA256 checksums, but very old repos only have MD5 checksums
+	var files []control.FileHash
+	for _, file := range src.ChecksumsSHA256 {
+		files = append(files, file.FileHash)
+	}
+	if len(files) == 0 {
+		for _, file := range src.Files {
+			files = append(files, file.FileHash)
 		}
+	}
 
-		// get source index from 'Sources.xz'
-		_, _, lerr = s.downloadAndParseDCF(ctx, srcIndexPath+".xz", &sourceIndex, cache)
-		if lerr != nil {
-			// some older distros only have 'Sources.gz'
-			_, _, lerr = s.downloadAndParseDCF(ctx, srcIndexPath+".gz", &sourceIndex, cache)
-			if lerr != nil {
-				return nil, lerr
-			}
+	result := make([]FileSpec, len(files))
+	for idx, file := range files {
+		result[idx] = FileSpec{Path: filepath.Join(src.Directory, file.Filename)}
+		result[idx].ExpectedChecksum, result[idx].ExpectedSizeBytes = checksumFromDebianFileHash(file)
+	}
+	return result
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// Returns the FileSpec for a package file (.deb) listed in a 'Packages' index.
+// If `package_signing_keys` is configured, the signature of the package is
+// verified during the transfer (except for .udeb files, which are never
+// signed).
+func (s *DebianSource) debianPoolFileSpec(fileName, size, sha256sum string) FileSpec {
+	spec := FileSpec{Path: fileName}
+	if len(s.trustedKeys) > 0 && strings.HasSuffix(fileName, ".deb") {
+		spec.SignatureVerifier = debSignatureVerifier{KeyRing: s.gpgKeyRing, TrustedKeys: s.trustedKeys}
+	}
+	if sha256sum != "" {
+		spec.ExpectedChecksum = &Checksum{Algorithm: "sha256", Value: sha256sum}
+	}
+	if sizeBytes, err := strconv.ParseUint(size, 10, 64); err == nil {
+		spec.ExpectedSizeBytes = &sizeBytes
+	}
+	return spec
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// Decides whether a file listed in the release file shall be transferred.
+// Only files that belong to the configured components, architectures and
+// languages are selected.
+func (s *DebianSource) selectsReleaseEntry(fileName string, isFlat bool, components, architectures []string) bool {
+	// flat repositories do not have components or architectures
+	if isFlat {
+		matchList := debReleaseFlatIndexEntryRx.FindStringSubmatch(fileName)
+		return matchList != nil && (matchList[1] == "Packages" || s.includeSources)
+	}
+
+	// find the component that this file belongs to (component names can contain
+	// slashes, e.g. "updates/main" on security.debian.org)
+	var rest string
+	found := false
+	for _, component := range components {
+		var ok bool
+		rest, ok = strings.CutPrefix(fileName, component+"/")
+		if ok {
+			found = true
+			break
 		}
+	}
+	if !found {
+		// some repos have Contents indices outside of the components
+		if strings.Contains(fileName, "/") {
+			return false
+		}
+		rest = fileName
+	}
 
-		for _, src := range sourceIndex {
-			for _, file := range src.Files {
-				distFiles = append(distFiles, filepath.Join(src.Directory, file.Filename))
-			}
+	if strings.HasPrefix(rest, "source/") {
+		return found && s.includeSources
+	}
+	if match := debReleaseBinaryEntryRx.FindStringSubmatch(rest); found && match != nil {
+		return slices.Contains(architectures, match[1])
+	}
+	if match := debReleaseTranslationEntryRx.FindStringSubmatch(rest); found && match != nil {
+		// if no languages are configured, all translations are transferred
+		return s.Languages == nil || slices.Contains(s.Languages, match[1])
+	}
+	if found && rest == "i18n/Index" {
+		return s.Languages == nil || len(s.Languages) > 0
+	}
+	if match := debReleaseContentsEntryRx.FindStringSubmatch(rest); match != nil {
+		if !s.includeContents {
+			return false
 		}
+		if match[1] == "source" {
+			return s.includeSources
+		}
+		return slices.Contains(architectures, match[1])
 	}
 
-	// transfer files in '$DIST_ROOT' at the very end, when package and source
-	// files have already been uploaded (to avoid situations where a client
-	// might see repository metadata without being able to see the referenced
-	// packages)
-	var entries []string
-	entries, lerr = s.recursivelyListEntries(ctx, distRootPath)
-	if lerr != nil {
-		if !strings.Contains(lerr.Message, "GET returned status 404") {
+	if found && strings.HasPrefix(rest, "dep11/") {
+		return s.includeDep11
+	}
+
+	// other metadata of the selected components (e.g. installer images) is
+	// transferred as listed
+	return found
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// Returns nil if the file does not exist (release files often list
+// uncompressed indices that are not actually available).
+func (s *DebianSource) getDistFileSpec(ctx context.Context, filePath string, releaseFiles map[string]control.FileHash, cache map[string]FileSpec) (*FileSpec, *ListEntriesError) {
+	spec, exists := cache[filePath]
+	if !exists {
+		var lerr *ListEntriesError
+		exists, lerr = s.urlSource.fileExists(ctx, filePath)
+		if lerr != nil || !exists {
 			return nil, lerr
 		}
+		spec = FileSpec{Path: filePath}
+	}
+	if file, exists := releaseFiles[filePath]; exists {
+		spec.ExpectedChecksum, spec.ExpectedSizeBytes = checksumFromDebianFileHash(file)
+	}
+	return &spec, nil
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// Downloads the 'Packages' or 'Sources' index at the given path (without file
+// extension), choosing one of the compressed variants that are listed in the
+// release file. Returns a reader for the contents of the index as downloaded
+// (i.e. still compressed), after they have been verified against the release
+// file.
+func (s *DebianSource) downloadIndex(ctx context.Context, indexPath string, dist *debianDist, cache map[string]FileSpec) (contents io.ReadCloser, uri string, e *ListEntriesError) {
+	lerr := &ListEntriesError{
+		Location: s.urlSource.getURLForPath(indexPath).String(),
+		Message:  "no supported compression format is listed in the release file",
 	}
-	distFiles = append(distFiles, entries...)
+	// (flat repositories sometimes only have uncompressed indices)
+	for _, ext := range []string{".xz", ".gz", ""} {
+		file, exists := dist.ReleaseFiles[indexPath+ext]
+		if !exists {
+			continue
+		}
+		if !dist.ByHash {
+			contents, uri, lerr = s.downloadAndVerify(ctx, indexPath+ext, file, cache)
+			if lerr == nil {
+				return contents, uri, nil
+			}
+			continue
+		}
 
-	return distFiles, nil
+		byHashPath := debianByHashPath(indexPath+ext, file)
+		contents, uri, lerr = s.downloadAndVerify(ctx, byHashPath, file, cache)
+		if lerr == nil {
+			// the file at the regular path has the same contents, so we do not
+			// need to download it again
+			spec := cache[byHashPath]
+			spec.Path = indexPath + ext
+			cache[spec.Path] = spec
+			return contents, uri, nil
+		}
+		// some repos list indices that do not exist, so try the next variant
+	}
+	return nil, lerr.Location, lerr
 }
 
 // Helper function for DebianSource.ListAllFiles().
-func (s *DebianSource) downloadAndParseDCF(ctx context.Context, path string, data any, cache map[string]FileSpec) (contents []byte, uri string, e *ListEntriesError) {
-	buf, uri, lerr := s.urlSource.getFileContents(ctx, path, cache)
+//
+// Like DebianSource.downloadIndex(), but each paragraph of the index is
+// decoded and passed to `handle` on its own while the index is being
+// decompressed. This keeps the memory usage flat for huge indices, since the
+// compressed index is only held in memory (in the cache, for the transfer) if
+// it is too small to be spooled to disk.
+func streamDebianIndex[T any](ctx context.Context, s *DebianSource, indexPath string, dist *debianDist, cache map[string]FileSpec, handle func(T)) *ListEntriesError {
+	contents, uri, lerr := s.downloadIndex(ctx, indexPath, dist, cache)
 	if lerr != nil {
-		return nil, uri, lerr
+		return lerr
+	}
+	defer contents.Close()
+	reader, err := newDecompressingStream(contents)
+	if err != nil {
+		return &ListEntriesError{Location: uri, Message: "cannot decompress file", Inner: err}
 	}
+	defer reader.Close()
 
-	// if `buf` has the magic number for XZ, decompress before parsing as DCF
-	if bytes.HasPrefix(buf, xzMagicNumber) {
-		var err error
-		buf, err = decompressXZArchive(buf)
-		if err != nil {
-			return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress xz stream", Inner: err}
+	err = decodeDebianParagraphs(reader, handle)
+	if err != nil {
+		return &ListEntriesError{
+			Location: uri,
+			Message:  "error while parsing Debian Control File",
+			Inner:    err,
 		}
 	}
+	return nil
+}
 
-	// if `buf` has the magic number for GZip, decompress before parsing as DCF
-	if bytes.HasPrefix(buf, gzipMagicNumber) {
-		var err error
-		buf, err = decompressGZipArchive(buf)
+// decodeDebianParagraphs decodes each paragraph of the given Debian Control
+// File into a fresh T, and passes it to `handle`.
+func decodeDebianParagraphs[T any](r io.Reader, handle func(T)) error {
+	decoder, err := control.NewDecoder(r, nil)
+	if err != nil {
+		return err
+	}
+	for {
+		var paragraph T
+		err := decoder.Decode(&paragraph)
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress gzip stream", Inner: err}
+			return err
 		}
+		handle(paragraph)
+	}
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// When by-hash files change, clients that have downloaded the previous release
+// file may still try to download the previous by-hash files. Therefore the
+// previous by-hash files that exist in the target are not removed during
+// cleanup right away. In each by-hash directory, we keep as many of the most
+// recent previous files as there are current files, times the configured
+// number of generations.
+func (s *DebianSource) listPreviousByHashFiles(ctx context.Context, distRootPath string, currentByHashFiles map[string]bool) ([]FileSpec, *ListEntriesError) {
+	if s.byHashGenerations == 0 || s.target == nil || s.target.Container == nil {
+		return nil, nil
 	}
 
-	err := control.Unmarshal(data, bytes.NewReader(buf))
+	existingFiles, err := s.target.listObjectsBelow(ctx, distRootPath)
 	if err != nil {
-		return nil, uri, &ListEntriesError{
-			Location: uri,
-			Message:  "error while parsing Debian Control File",
+		return nil, &ListEntriesError{
+			Location: s.target.ObjectAtPath(distRootPath).FullName(),
+			Message:  "cannot list existing by-hash files in target",
 			Inner:    err,
 		}
 	}
 
-	return buf, uri, nil
+	currentCount := make(map[string]uint)
+	for filePath := range currentByHashFiles {
+		currentCount[filepath.Dir(filePath)]++
+	}
+	previousFiles := make(map[string][]FileSpec)
+	for _, file := range existingFiles {
+		dirPath := filepath.Dir(file.Path)
+		if filepath.Base(dirPath) != "SHA256" || filepath.Base(filepath.Dir(dirPath)) != "by-hash" || currentByHashFiles[file.Path] {
+			continue
+		}
+		previousFiles[dirPath] = append(previousFiles[dirPath], file)
+	}
+
+	var result []FileSpec
+	for dirPath, files := range previousFiles {
+		// keep the most recent files
+		slices.SortFunc(files, func(lhs, rhs FileSpec) int {
+			return rhs.LastModified.Compare(*lhs.LastModified)
+		})
+		keepCount := min(uint(len(files)), currentCount[dirPath]*s.byHashGenerations)
+		for _, file := range files[:keepCount] {
+			result = append(result, FileSpec{Path: file.Path, RetainOnly: true})
+		}
+	}
+
+	// make the order of files deterministic
+	slices.SortFunc(result, func(lhs, rhs FileSpec) int {
+		return strings.Compare(lhs.Path, rhs.Path)
+	})
+	return result, nil
 }
 
 // Helper function for DebianSource.ListAllFiles().
-func stripFileExtension(fileName string) string {
-	ext := filepath.Ext(fileName)
-	if ext == "" {
-		return fileName
+//
+// Returns the contents and the Date field of the release file that is
+// currently stored in the target, or nil and the empty string if there is none.
+func (s *DebianSource) getPreviousRelease(ctx context.Context, releasePath string) (contents []byte, date string, e *ListEntriesError) {
+	if s.target == nil || s.target.Container == nil {
+		return nil, "", nil
+	}
+	object := s.target.ObjectAtPath(releasePath)
+	buf, err := object.Download(ctx, nil).AsByteSlice()
+	if err != nil {
+		if schwift.Is(err, http.StatusNotFound) {
+			return nil, "", nil
+		}
+		return nil, "", &ListEntriesError{Location: object.FullName(), Message: "GET failed", Inner: err}
 	}
 
-	return strings.TrimSuffix(fileName, ext)
+	// the signature does not need to be verified again since the file was
+	// verified before it was uploaded
+	var release struct {
+		Date string `control:"Date"`
+	}
+	err = control.Unmarshal(&release, bytes.NewReader(buf))
+	if err != nil {
+		return nil, "", &ListEntriesError{Location: object.FullName(), Message: "error while parsing Debian Control File", Inner: err}
+	}
+	return buf, release.Date, nil
+}
+
+// The date format used in release files is RFC 1123, but some repos use
+// numeric time zones or do not pad the day of month.
+var debianDateFormats = []string{
+	time.RFC1123,
+	time.RFC1123Z,
+	"Mon, _2 Jan 2006 15:04:05 MST",
+	"Mon, _2 Jan 2006 15:04:05 -0700",
+}
+
+func parseDebianDate(value string) (time.Time, error) {
+	for _, format := range debianDateFormats {
+		t, err := time.Parse(format, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("malformed date: %q", value)
+}
+
+// checkDebianReleaseDates checks the Date and Valid-Until fields of a release
+// file. Release files are rejected if they are expired at the time `now`, or
+// if they are older than the previous release file (whose Date field is given
+// in `previousDate`). Missing fields are not checked.
+func checkDebianReleaseDates(date, validUntil, previousDate string, now time.Time) error {
+	if validUntil != "" {
+		t, err := parseDebianDate(validUntil)
+		if err != nil {
+			return fmt.Errorf("in Valid-Until: %w", err)
+		}
+		if now.After(t) {
+			return fmt.Errorf("release file expired at %s", t.Format(time.RFC3339))
+		}
+	}
+
+	if date == "" || previousDate == "" {
+		return nil
+	}
+	t, err := parseDebianDate(date)
+	if err != nil {
+		return fmt.Errorf("in Date: %w", err)
+	}
+	previous, err := parseDebianDate(previousDate)
+	if err != nil {
+		// the previous release file is not trustworthy, so we do not need to
+		// stick with it
+		logg.Info("ignoring malformed Date in previous release file: %s", err.Error())
+		return nil
+	}
+	if t.Before(previous) {
+		return fmt.Errorf("release file is dated %s, but the release file in the target is dated %s",
+			t.Format(time.RFC3339), previous.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// debianDistRootPath returns the path of the directory containing the
+// release file of the given distribution. As in the sources.list syntax (e.g.
+// "deb https://example.com/repo ./"), a trailing slash denotes a flat
+// repository whose release file is not below 'dists/'.
+func debianDistRootPath(distName string) (distRootPath string, isFlat bool) {
+	if !strings.HasSuffix(distName, "/") {
+		return filepath.Join("dists", distName), false
+	}
+	distRootPath = strings.Trim(filepath.Clean(distName), "/")
+	if distRootPath == "." {
+		distRootPath = ""
+	}
+	return distRootPath, true
+}
+
+// debianByHashPath returns the by-hash path of a file listed in a release
+// file, e.g. "dists/stable/main/binary-amd64/by-hash/SHA256/<hash>" for
+// "dists/stable/main/binary-amd64/Packages.xz".
+func debianByHashPath(filePath string, file control.FileHash) string {
+	return filepath.Join(filepath.Dir(filePath), "by-hash", "SHA256", file.Hash)
 }
 
 // Helper function for DebianSource.ListAllFiles().
-func (s *DebianSource) recursivelyListEntries(ctx context.Context, path string) ([]string, *ListEntriesError) {
-	var files []string
+func checksumFromDebianFileHash(file control.FileHash) (*Checksum, *uint64) {
+	checksum := &Checksum{Algorithm: file.Algorithm, Value: file.Hash}
+	if file.Size < 0 {
+		return checksum, nil
+	}
+	return checksum, new(uint64(file.Size))
+}
 
-	entries, lerr := s.urlSource.ListEntries(ctx, path)
+// Helper function for DebianSource.downloadIndex().
+//
+// The downloaded file must match the checksum and size from the release file.
+func (s *DebianSource) downloadAndVerify(ctx context.Context, path string, expected control.FileHash, cache map[string]FileSpec) (contents io.ReadCloser, uri string, e *ListEntriesError) {
+	var spec FileSpec
+	spec.ExpectedChecksum, spec.ExpectedSizeBytes = checksumFromDebianFileHash(expected)
+	contents, uri, lerr := s.urlSource.openFileContents(ctx, path, spec, cache)
+	if lerr != nil && errors.Is(lerr.Inner, errChecksumMismatch) {
+		lerr.Message = "file does not match the release file"
+	}
+	return contents, uri, lerr
+}
+
+// Helper function for DebianSource.ListAllFiles().
+func (s *DebianSource) downloadAndParseDCF(ctx context.Context, path string, data any, cache map[string]FileSpec) (contents []byte, uri string, e *ListEntriesError) {
+	buf, uri, lerr := s.urlSource.getFileContents(ctx, path, cache)
 	if lerr != nil {
-		return nil, lerr
+		return nil, uri, lerr
+	}
+	buf, err := decompressArchive(buf)
+	if err != nil {
+		return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress file", Inner: err}
 	}
 
-	for _, entry := range entries {
-		if entry.IsDirectory {
-			if filepath.Base(path) == filepath.Base(entry.Path) {
-				logg.Info("skipping directory %s to avoid potential symlink loop", entry.Path)
-			} else {
-				tmpFiles, lerr := s.recursivelyListEntries(ctx, entry.Path)
-				if lerr != nil {
-					return nil, lerr
-				}
-				files = append(files, tmpFiles...)
-			}
-		} else {
-			files = append(files, entry.Path)
+	err = control.Unmarshal(data, bytes.NewReader(buf))
+	if err != nil {
+		return nil, uri, &ListEntriesError{
+			Location: uri,
+			Message:  "error while parsing Debian Control File",
+			Inner:    err,
 		}
 	}
+	return buf, uri, nil
+}
+
+// Helper function for DebianSource.ListAllFiles().
+func stripFileExtension(fileName string) string {
+	ext := filepath.Ext(fileName)
+	if ext == "" {
+		return fileName
+	}
 
-	return files, nil
+	return strings.TrimSuffix(fileName, ext)
 }
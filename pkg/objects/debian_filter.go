@@ -0,0 +1,604 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/regexpext"
+	"pault.ag/go/debian/control"
+	"pault.ag/go/debian/dependency"
+)
+
+// This file contains the implementation of partial Debian mirrors: When
+// `packages` is given in the DebianSource configuration, only the selected
+// packages (and optionally their dependencies) are transferred, and the
+// indices and release files are rewritten to only reference these packages.
+// Since the rewritten release files cannot carry the upstream signature, they
+// are signed with the configured signing key instead.
+
+// debianPackage is a paragraph in a 'Packages' index.
+type debianPackage struct {
+	Package    string `control:"Package"`
+	Source     string `control:"Source"`
+	Filename   string `control:"Filename"`
+	Size       string `control:"Size"`
+	SHA256     string `control:"SHA256"`
+	Depends    string `control:"Depends"`
+	PreDepends string `control:"Pre-Depends"`
+	Recommends string `control:"Recommends"`
+	Provides   string `control:"Provides"`
+	// the paragraph exactly as it appears in the index
+	raw string
+}
+
+// SourceName returns the name of the source package that this package was
+// built from.
+func (p debianPackage) SourceName() string {
+	if p.Source == "" {
+		return p.Package
+	}
+	// strip the source version, e.g. "glibc (2.36-9)" -> "glibc"
+	name, _, _ := strings.Cut(p.Source, " ")
+	return name
+}
+
+// Relations returns the parsed relationship fields that need to be satisfied
+// when installing this package.
+func (p debianPackage) Relations(includeRecommends bool) ([]dependency.Relation, error) {
+	fields := []string{p.PreDepends, p.Depends}
+	if includeRecommends {
+		fields = append(fields, p.Recommends)
+	}
+
+	var result []dependency.Relation
+	for _, field := range fields {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		dep, err := dependency.Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse dependencies of %s: %w", p.Package, err)
+		}
+		result = append(result, dep.Relations...)
+	}
+	return result, nil
+}
+
+// ProvidedNames returns the names of the virtual packages that this package provides.
+func (p debianPackage) ProvidedNames() ([]string, error) {
+	if strings.TrimSpace(p.Provides) == "" {
+		return nil, nil
+	}
+	dep, err := dependency.Parse(p.Provides)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse Provides of %s: %w", p.Package, err)
+	}
+	var result []string
+	for _, rel := range dep.Relations {
+		for _, possibility := range rel.Possibilities {
+			result = append(result, possibility.Name)
+		}
+	}
+	return result, nil
+}
+
+// debianFilteredIndex is a 'Packages' or 'Sources' index whose paragraphs
+// have been parsed individually, so that they can be written back unchanged.
+type debianFilteredIndex struct {
+	// the path of the index without file extension
+	Path     string
+	Packages []debianPackage
+	Sources  []debianFilteredSource
+}
+
+type debianFilteredSource struct {
+	debianSourcePackage
+	raw string
+}
+
+// splitDebianParagraphs splits a file in the Debian control file format into
+// its paragraphs.
+func splitDebianParagraphs(buf []byte) []string {
+	var result []string
+	// (reading from a bytes.Reader cannot fail, and neither can this callback)
+	_ = readDebianParagraphs(bytes.NewReader(buf), func(paragraph string) error {
+		result = append(result, paragraph)
+		return nil
+	})
+	return result
+}
+
+// readDebianParagraphs is like splitDebianParagraphs, but reads the file from
+// the given reader and passes each paragraph to `handle` as soon as it is
+// complete, so that the file does not need to be held in memory as a whole.
+func readDebianParagraphs(r io.Reader, handle func(paragraph string) error) error {
+	reader := bufio.NewReader(r)
+	var lines []string
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		paragraph := strings.Join(lines, "\n")
+		lines = lines[:0]
+		return handle(paragraph)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			ferr := flush()
+			if ferr != nil {
+				return ferr
+			}
+		} else {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			return flush()
+		}
+	}
+}
+
+// Helper function for DebianSource.ListAllFiles().
+func (s *DebianSource) listFilteredFiles(ctx context.Context, dists []*debianDist, cache map[string]FileSpec) ([]FileSpec, *ListEntriesError) {
+	// read all package indices first since dependencies are resolved across all
+	// distributions and architectures
+	packageIndices := make(map[*debianDist][]*debianFilteredIndex, len(dists))
+	var allPackages []debianPackage
+	for _, dist := range dists {
+		for _, indexPath := range dist.PackageIndices {
+			index := &debianFilteredIndex{Path: indexPath}
+			lerr := s.streamFilteredIndex(ctx, indexPath, dist, func(paragraph string) error {
+				pkg, err := parseDebianPackage(paragraph)
+				switch {
+				case err != nil:
+					return err
+				case s.ResolveDependencies:
+					// any package could be selected as a dependency, so all of them
+					// are needed for the selection, but their paragraphs are only
+					// kept once the selection is known (see below)
+					pkg.raw = ""
+					allPackages = append(allPackages, pkg)
+				case s.matchesPackagePattern(pkg.Package):
+					allPackages = append(allPackages, pkg)
+					index.Packages = append(index.Packages, pkg)
+				}
+				return nil
+			})
+			if lerr != nil {
+				return nil, lerr
+			}
+			packageIndices[dist] = append(packageIndices[dist], index)
+		}
+	}
+
+	selected, err := selectDebianPackages(allPackages, s.Packages, s.ResolveDependencies, s.IncludeRecommends)
+	if err != nil {
+		return nil, &ListEntriesError{
+			Location: s.urlSource.getURLForPath("/").String(),
+			Message:  "cannot select packages",
+			Inner:    err,
+		}
+	}
+	selectedSources := make(map[string]bool)
+	for _, pkg := range allPackages {
+		if selected[pkg.Package] {
+			selectedSources[pkg.SourceName()] = true
+		}
+	}
+	logg.Debug("selected %d packages from %s", len(selected), s.URLString)
+
+	// when resolving dependencies, the package indices are read again to
+	// collect the paragraphs of the selected packages; the source indices only
+	// need to be read once since sources are selected through their packages
+	sourceIndices := make(map[*debianDist][]*debianFilteredIndex, len(dists))
+	for _, dist := range dists {
+		if s.ResolveDependencies {
+			for _, index := range packageIndices[dist] {
+				lerr := s.streamFilteredIndex(ctx, index.Path, dist, func(paragraph string) error {
+					pkg, err := parseDebianPackage(paragraph)
+					if err == nil && selected[pkg.Package] {
+						index.Packages = append(index.Packages, pkg)
+					}
+					return err
+				})
+				if lerr != nil {
+					return nil, lerr
+				}
+			}
+		}
+
+		for _, indexPath := range dist.SourceIndices {
+			index := &debianFilteredIndex{Path: indexPath}
+			lerr := s.streamFilteredIndex(ctx, indexPath, dist, func(paragraph string) error {
+				src := debianFilteredSource{raw: paragraph}
+				err := control.Unmarshal(&src.debianSourcePackage, strings.NewReader(paragraph))
+				if err == nil && selectedSources[src.Package] {
+					index.Sources = append(index.Sources, src)
+				}
+				return err
+			})
+			if lerr != nil {
+				return nil, lerr
+			}
+			sourceIndices[dist] = append(sourceIndices[dist], index)
+		}
+	}
+
+	// as in listDistFiles(), the rewritten metadata is transferred at the very
+	// end, when all package and source files have already been uploaded (to
+	// avoid situations where a client might see repository metadata without
+	// being able to see the referenced packages)
+	var (
+		files         []FileSpec
+		metadataFiles []FileSpec
+	)
+	for _, dist := range dists {
+		// the files that will be listed in the rewritten release file
+		var releaseEntries []FileSpec
+
+		for _, index := range packageIndices[dist] {
+			var buf bytes.Buffer
+			for _, pkg := range index.Packages {
+				if !selected[pkg.Package] {
+					continue
+				}
+				files = append(files, s.debianPoolFileSpec(pkg.Filename, pkg.Size, pkg.SHA256))
+				buf.WriteString(pkg.raw)
+				buf.WriteString("\n\n")
+			}
+			generated, err := generateDebianIndexFiles(index.Path, buf.Bytes())
+			if err != nil {
+				return nil, &ListEntriesError{Location: s.urlSource.getURLForPath(index.Path).String(), Message: "cannot generate index", Inner: err}
+			}
+			releaseEntries = append(releaseEntries, generated...)
+		}
+
+		for _, index := range sourceIndices[dist] {
+			var buf bytes.Buffer
+			for _, src := range index.Sources {
+				if !selectedSources[src.Package] {
+					continue
+				}
+				files = append(files, src.FileSpecs()...)
+				buf.WriteString(src.raw)
+				buf.WriteString("\n\n")
+			}
+			generated, err := generateDebianIndexFiles(index.Path, buf.Bytes())
+			if err != nil {
+				return nil, &ListEntriesError{Location: s.urlSource.getURLForPath(index.Path).String(), Message: "cannot generate index", Inner: err}
+			}
+			releaseEntries = append(releaseEntries, generated...)
+		}
+
+		// all other selected files (e.g. translations) are transferred unchanged
+		for _, fileName := range dist.SelectedEntries {
+			filePath := filepath.Join(dist.RootPath, fileName)
+			indexPath := stripFileExtension(filePath)
+			if slices.Contains(dist.PackageIndices, indexPath) || slices.Contains(dist.SourceIndices, indexPath) {
+				continue
+			}
+			spec, lerr := s.getDistFileSpec(ctx, filePath, dist.ReleaseFiles, cache)
+			if lerr != nil {
+				return nil, lerr
+			}
+			if spec != nil {
+				releaseEntries = append(releaseEntries, *spec)
+			}
+		}
+
+		releaseFiles, err := s.generateDebianReleaseFiles(dist, releaseEntries)
+		if err != nil {
+			return nil, &ListEntriesError{Location: dist.ReleaseURI, Message: "cannot generate release file", Inner: err}
+		}
+		metadataFiles = append(metadataFiles, releaseEntries...)
+		metadataFiles = append(metadataFiles, releaseFiles...)
+	}
+
+	return append(files, metadataFiles...), nil
+}
+
+// Helper function for DebianSource.listFilteredFiles().
+func parseDebianPackage(paragraph string) (debianPackage, error) {
+	pkg := debianPackage{raw: paragraph}
+	err := control.Unmarshal(&pkg, strings.NewReader(paragraph))
+	return pkg, err
+}
+
+// Helper function for DebianSource.listFilteredFiles().
+func (s *DebianSource) matchesPackagePattern(name string) bool {
+	return slices.ContainsFunc(s.Packages, func(pattern regexpext.BoundedRegexp) bool {
+		return pattern.MatchString(name)
+	})
+}
+
+// Helper function for DebianSource.listFilteredFiles().
+//
+// Like streamDebianIndex(), but passes the raw paragraphs to `handle`. Since
+// only the rewritten index is transferred, the original index is not put in
+// the cache: It is streamed from the HTTP response through the decompressor,
+// and verified against the release file once it has been read completely.
+func (s *DebianSource) streamFilteredIndex(ctx context.Context, indexPath string, dist *debianDist, handle func(paragraph string) error) *ListEntriesError {
+	lerr := &ListEntriesError{
+		Location: s.urlSource.getURLForPath(indexPath).String(),
+		Message:  "no supported compression format is listed in the release file",
+	}
+	// (flat repositories sometimes only have uncompressed indices)
+	for _, ext := range []string{".xz", ".gz", ""} {
+		file, exists := dist.ReleaseFiles[indexPath+ext]
+		if !exists {
+			continue
+		}
+		filePath := indexPath + ext
+		if dist.ByHash {
+			filePath = debianByHashPath(filePath, file)
+		}
+
+		uri := s.urlSource.getURLForPath(filePath).String()
+		var body io.ReadCloser
+		body, _, lerr = s.urlSource.openURL(ctx, uri)
+		if lerr != nil {
+			// some repos list indices that do not exist, so try the next variant
+			continue
+		}
+		return readVerifiedDebianIndex(uri, body, file, handle)
+	}
+	return lerr
+}
+
+// Helper function for DebianSource.streamFilteredIndex().
+func readVerifiedDebianIndex(uri string, body io.ReadCloser, file control.FileHash, handle func(paragraph string) error) *ListEntriesError {
+	defer body.Close()
+	checksum, sizeBytes := checksumFromDebianFileHash(file)
+	verifier, err := newVerifyingReader(body, FileSpec{ExpectedChecksum: checksum, ExpectedSizeBytes: sizeBytes})
+	if err != nil {
+		return &ListEntriesError{Location: uri, Message: "file does not match the release file", Inner: err}
+	}
+
+	var parseErr error
+	reader, err := newDecompressingStream(verifier)
+	if err == nil {
+		defer reader.Close()
+		err = readDebianParagraphs(reader, func(paragraph string) error {
+			parseErr = handle(paragraph)
+			return parseErr
+		})
+	}
+	if err == nil {
+		// the checksum covers the whole file, even if the decompressor does not
+		// read it until the end
+		_, err = io.Copy(io.Discard, verifier)
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errChecksumMismatch):
+		return &ListEntriesError{Location: uri, Message: "file does not match the release file", Inner: err}
+	case parseErr != nil:
+		return &ListEntriesError{Location: uri, Message: "error while parsing Debian Control File", Inner: err}
+	default:
+		return &ListEntriesError{Location: uri, Message: "cannot decompress file", Inner: err}
+	}
+}
+
+// selectDebianPackages returns the names of all packages whose name matches
+// one of the given patterns. If `resolveDependencies` is true, the packages
+// that these packages depend on are selected as well (recursively).
+//
+// For each dependency with alternatives ("foo | bar"), the first alternative
+// that is available is selected, unless another alternative is already
+// selected. Virtual packages are resolved to one of the packages providing
+// them. Dependencies that cannot be satisfied from the given packages are
+// ignored since they are usually satisfied by other repositories.
+func selectDebianPackages(packages []debianPackage, patterns []regexpext.BoundedRegexp, resolveDependencies, includeRecommends bool) (map[string]bool, error) {
+	packagesByName := make(map[string][]debianPackage)
+	providers := make(map[string][]string)
+	for _, pkg := range packages {
+		packagesByName[pkg.Package] = append(packagesByName[pkg.Package], pkg)
+		providedNames, err := pkg.ProvidedNames()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range providedNames {
+			if !slices.Contains(providers[name], pkg.Package) {
+				providers[name] = append(providers[name], pkg.Package)
+			}
+		}
+	}
+	for _, names := range providers {
+		slices.Sort(names)
+	}
+
+	selected := make(map[string]bool)
+	var queue []string
+	for _, pattern := range patterns {
+		found := false
+		for _, name := range slices.Sorted(maps.Keys(packagesByName)) {
+			if pattern.MatchString(name) {
+				found = true
+				if !selected[name] {
+					selected[name] = true
+					queue = append(queue, name)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no package matches %q", string(pattern))
+		}
+	}
+	if !resolveDependencies {
+		return selected, nil
+	}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, pkg := range packagesByName[name] {
+			relations, err := pkg.Relations(includeRecommends)
+			if err != nil {
+				return nil, err
+			}
+			for _, rel := range relations {
+				chosen := chooseDebianAlternative(rel.Possibilities, packagesByName, providers, selected)
+				if chosen == "" {
+					logg.Debug("ignoring unsatisfiable dependency of %s: %s", pkg.Package, rel.String())
+					continue
+				}
+				if !selected[chosen] {
+					selected[chosen] = true
+					queue = append(queue, chosen)
+				}
+			}
+		}
+	}
+	return selected, nil
+}
+
+// Helper function for selectDebianPackages().
+func chooseDebianAlternative(possibilities []dependency.Possibility, packagesByName map[string][]debianPackage, providers map[string][]string, selected map[string]bool) string {
+	// prefer alternatives that are already selected
+	for _, possibility := range possibilities {
+		if selected[possibility.Name] {
+			return possibility.Name
+		}
+		for _, name := range providers[possibility.Name] {
+			if selected[name] {
+				return name
+			}
+		}
+	}
+	for _, possibility := range possibilities {
+		if len(packagesByName[possibility.Name]) > 0 {
+			return possibility.Name
+		}
+	}
+	for _, possibility := range possibilities {
+		if names := providers[possibility.Name]; len(names) > 0 {
+			return names[0]
+		}
+	}
+	return ""
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// Returns the uncompressed and the gzip-compressed variant of the given index.
+func generateDebianIndexFiles(indexPath string, contents []byte) ([]FileSpec, error) {
+	// (an empty index is still a generated file)
+	if contents == nil {
+		contents = []byte{}
+	}
+	compressed, err := compressGZipArchive(contents)
+	if err != nil {
+		return nil, err
+	}
+	return []FileSpec{
+		generatedFileSpec(indexPath, contents, "text/plain; charset=utf-8"),
+		generatedFileSpec(indexPath+".gz", compressed, "application/gzip"),
+	}, nil
+}
+
+// These fields are removed from rewritten release files. (The checksum lists
+// are replaced, and the by-hash files are not transferred for partial mirrors.)
+var debianReleaseRemovedFields = []string{
+	"Acquire-By-Hash", "Architectures", "Components", "MD5Sum", "SHA1", "SHA256", "SHA512", "Signed-By",
+}
+
+// Helper function for DebianSource.ListAllFiles().
+//
+// Returns the rewritten Release file, and its signed variants Release.gpg and
+// InRelease (in this order).
+func (s *DebianSource) generateDebianReleaseFiles(dist *debianDist, entries []FileSpec) ([]FileSpec, error) {
+	release, err := rewriteDebianRelease(dist, entries)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.signingKey.DetachSign(release)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign release file: %w", err)
+	}
+	inRelease, err := s.signingKey.ClearSign(release)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign release file: %w", err)
+	}
+	return []FileSpec{
+		generatedFileSpec(filepath.Join(dist.RootPath, "Release"), release, "text/plain; charset=utf-8"),
+		generatedFileSpec(filepath.Join(dist.RootPath, "Release.gpg"), signature, "application/pgp-signature"),
+		generatedFileSpec(filepath.Join(dist.RootPath, "InRelease"), inRelease, "text/plain; charset=utf-8"),
+	}, nil
+}
+
+// rewriteDebianRelease returns the release file for a partial mirror of the
+// given distribution. All fields from the upstream release file are kept
+// (including the Date and Valid-Until fields), except for the ones that
+// describe the contents of the distribution, which are replaced to match the
+// given entries.
+func rewriteDebianRelease(dist *debianDist, entries []FileSpec) ([]byte, error) {
+	paragraphs := splitDebianParagraphs(dist.ReleaseText)
+	if len(paragraphs) == 0 {
+		return nil, fmt.Errorf("empty release file at %s", dist.ReleaseURI)
+	}
+
+	var buf bytes.Buffer
+	skipping := false
+	for line := range strings.SplitSeq(paragraphs[0], "\n") {
+		// continuation lines belong to the previous field
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if !skipping {
+				buf.WriteString(line + "\n")
+			}
+			continue
+		}
+		fieldName, _, _ := strings.Cut(line, ":")
+		skipping = slices.ContainsFunc(debianReleaseRemovedFields, func(name string) bool {
+			return strings.EqualFold(name, fieldName)
+		})
+		if !skipping {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	// flat repositories do not have components and architectures
+	if !dist.IsFlat {
+		fmt.Fprintf(&buf, "Architectures: %s\n", strings.Join(dist.Architectures, " "))
+		fmt.Fprintf(&buf, "Components: %s\n", strings.Join(dist.Components, " "))
+	}
+
+	buf.WriteString("SHA256:\n")
+	for _, entry := range entries {
+		fileName, err := filepath.Rel(dist.RootPath, entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		// generated files (and unchanged files that we have downloaded) are
+		// hashed directly, otherwise we use the checksum from the upstream
+		// release file
+		if entry.Contents != nil {
+			fmt.Fprintf(&buf, " %x %d %s\n", sha256.Sum256(entry.Contents), len(entry.Contents), fileName)
+			continue
+		}
+		if entry.ExpectedChecksum == nil || entry.ExpectedChecksum.Algorithm != "sha256" || entry.ExpectedSizeBytes == nil {
+			return nil, fmt.Errorf("no SHA256 checksum known for %s", entry.Path)
+		}
+		fmt.Fprintf(&buf, " %s %d %s\n", entry.ExpectedChecksum.Value, *entry.ExpectedSizeBytes, fileName)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/sapcc/go-bits/regexpext"
+	"go.xyrillian.de/gg/assert"
+	"pault.ag/go/debian/control"
+
+	"github.com/sapcc/swift-http-import/pkg/util"
+)
+
+func TestSelectDebianPackages(t *testing.T) {
+	packages := []debianPackage{
+		{Package: "app", Depends: "libfoo (>= 1.0), mail-transport-agent | exim4", Recommends: "app-doc"},
+		{Package: "app-doc"},
+		{Package: "app-plugin", Depends: "app"},
+		{Package: "libfoo", PreDepends: "libc6:any (>= 2.36)"},
+		{Package: "libfoo", PreDepends: "libc6:any (>= 2.36)", Depends: "libbar [i386]"},
+		{Package: "libc6"},
+		{Package: "nullmailer", Provides: "mail-transport-agent"},
+		{Package: "postfix", Provides: "mail-transport-agent (= 3.7)"},
+		{Package: "unrelated"},
+	}
+	patterns := []regexpext.BoundedRegexp{"app"}
+
+	selectedNames := func(selected map[string]bool, err error) []string {
+		t.Helper()
+		assert.ErrEqual(t, err, nil)
+		var result []string
+		for name := range selected {
+			result = append(result, name)
+		}
+		slices.Sort(result)
+		return result
+	}
+
+	// without dependency resolution, only the name patterns are considered
+	// (and they must match the full name)
+	assert.Equal(t, selectedNames(selectDebianPackages(packages, patterns, false, false)),
+		[]string{"app"})
+	assert.Equal(t, selectedNames(selectDebianPackages(packages, []regexpext.BoundedRegexp{"app.*"}, false, false)),
+		[]string{"app", "app-doc", "app-plugin"})
+
+	// with dependency resolution, virtual packages are resolved to the first
+	// provider, and missing dependencies are ignored
+	assert.Equal(t, selectedNames(selectDebianPackages(packages, patterns, true, false)),
+		[]string{"app", "libc6", "libfoo", "nullmailer"})
+	assert.Equal(t, selectedNames(selectDebianPackages(packages, patterns, true, true)),
+		[]string{"app", "app-doc", "libc6", "libfoo", "nullmailer"})
+
+	// providers that are already selected are preferred
+	assert.Equal(t, selectedNames(selectDebianPackages(packages, []regexpext.BoundedRegexp{"app", "postfix"}, true, false)),
+		[]string{"app", "libc6", "libfoo", "postfix"})
+
+	// patterns that do not match anything are probably typos
+	_, err := selectDebianPackages(packages, []regexpext.BoundedRegexp{"ap"}, false, false)
+	assert.ErrEqual(t, err, `no package matches "ap"`)
+}
+
+func TestSplitDebianParagraphs(t *testing.T) {
+	input := "Package: foo\nDescription: Foo\n Long description.\n .\n More.\n\n\n\r\nPackage: bar\r\n\n"
+	assert.Equal(t, splitDebianParagraphs([]byte(input)), []string{
+		"Package: foo\nDescription: Foo\n Long description.\n .\n More.",
+		"Package: bar",
+	})
+}
+
+func TestReadVerifiedDebianIndex(t *testing.T) {
+	contents := []byte("Package: foo\n\nPackage: bar\n")
+	compressed, err := compressGZipArchive(contents)
+	assert.ErrEqual(t, err, nil)
+	file := control.FileHash{
+		Algorithm: "sha256",
+		Hash:      fmt.Sprintf("%x", sha256.Sum256(compressed)),
+		Size:      int64(len(compressed)),
+	}
+
+	// the compressed index is decompressed on the fly
+	var paragraphs []string
+	handle := func(paragraph string) error {
+		paragraphs = append(paragraphs, paragraph)
+		return nil
+	}
+	lerr := readVerifiedDebianIndex("Packages.gz", io.NopCloser(bytes.NewReader(compressed)), file, handle)
+	assert.Equal(t, lerr, (*ListEntriesError)(nil))
+	assert.Equal(t, paragraphs, []string{"Package: foo", "Package: bar"})
+
+	// the index is rejected when it does not match the release file
+	file.Hash = strings.Repeat("0", 64)
+	lerr = readVerifiedDebianIndex("Packages.gz", io.NopCloser(bytes.NewReader(compressed)), file, handle)
+	assert.Equal(t, lerr.Message, "file does not match the release file")
+}
+
+func TestGenerateDebianReleaseFiles(t *testing.T) {
+	// generate a signing key
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	assert.ErrEqual(t, err, nil)
+	keyPath := filepath.Join(t.TempDir(), "key.asc")
+	file, err := os.Create(keyPath)
+	assert.ErrEqual(t, err, nil)
+	w, err := armor.Encode(file, openpgp.PrivateKeyType, nil)
+	assert.ErrEqual(t, err, nil)
+	assert.ErrEqual(t, entity.SerializePrivate(w, nil), nil)
+	assert.ErrEqual(t, w.Close(), nil)
+	assert.ErrEqual(t, file.Close(), nil)
+
+	signingKey, err := util.LoadGPGSigningKey(keyPath, "")
+	assert.ErrEqual(t, err, nil)
+	s := &DebianSource{signingKey: signingKey}
+
+	dist := &debianDist{
+		RootPath:      "dists/stable",
+		ReleaseURI:    "https://example.com/debian/dists/stable/InRelease",
+		Components:    []string{"main"},
+		Architectures: []string{"amd64"},
+		ReleaseText: []byte(`Origin: Example
+Label: Example
+Suite: stable
+Date: Sat, 10 Oct 2026 09:00:00 UTC
+Valid-Until: Sat, 17 Oct 2026 09:00:00 UTC
+Acquire-By-Hash: yes
+Architectures: amd64 arm64
+Components: main contrib
+Description: Example
+ Repository
+MD5Sum:
+ d41d8cd98f00b204e9800998ecf8427e 0 main/binary-amd64/Packages
+SHA256:
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 main/binary-amd64/Packages
+`),
+	}
+	entries := []FileSpec{
+		generatedFileSpec("dists/stable/main/binary-amd64/Packages", []byte("Package: foo\n\n"), "text/plain"),
+		{
+			Path:              "dists/stable/main/i18n/Translation-en.bz2",
+			ExpectedChecksum:  &Checksum{Algorithm: "sha256", Value: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+			ExpectedSizeBytes: new(uint64(42)),
+		},
+	}
+
+	files, err := s.generateDebianReleaseFiles(dist, entries)
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, len(files), 3)
+	assert.Equal(t, files[0].Path, "dists/stable/Release")
+	assert.Equal(t, string(files[0].Contents), `Origin: Example
+Label: Example
+Suite: stable
+Date: Sat, 10 Oct 2026 09:00:00 UTC
+Valid-Until: Sat, 17 Oct 2026 09:00:00 UTC
+Description: Example
+ Repository
+Architectures: amd64
+Components: main
+SHA256:
+ 56f72a06223076f17d4dd0fd6018fa2dd607846d2f53d7e64eae61f407ca52fa 14 main/binary-amd64/Packages
+ 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef 42 main/i18n/Translation-en.bz2
+`)
+
+	// the signatures can be verified with the public key
+	keyRing := &util.GPGKeyRing{EntityList: openpgp.EntityList{entity}}
+	assert.Equal(t, files[1].Path, "dists/stable/Release.gpg")
+	assert.ErrEqual(t, keyRing.VerifyDetachedGPGSignature(t.Context(), files[0].Contents, files[1].Contents), nil)
+	assert.Equal(t, files[2].Path, "dists/stable/InRelease")
+	assert.ErrEqual(t, keyRing.VerifyClearSignedGPGSignature(t.Context(), files[2].Contents), nil)
+
+	// the clear-signed release file can be parsed like the upstream one
+	var release debianRelease
+	assert.ErrEqual(t, control.Unmarshal(&release, bytes.NewReader(files[2].Contents)), nil)
+	assert.Equal(t, release.Architectures, []string{"amd64"})
+	assert.Equal(t, len(release.Entries), 2)
+}
@@ -4,8 +4,11 @@
 package objects
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
+	"github.com/ulikunitz/xz"
 	"go.xyrillian.de/gg/assert"
 )
 
@@ -56,3 +59,162 @@ func TestDebianReleasePackagesEntryRx(t *testing.T) {
 		})
 	}
 }
+
+// TestDebianSelectsReleaseEntry tests which files listed in a 'Release' file
+// are transferred for a given configuration.
+func TestDebianSelectsReleaseEntry(t *testing.T) {
+	s := DebianSource{
+		Languages:       []string{"en"},
+		includeSources:  false,
+		includeContents: true,
+		includeDep11:    true,
+	}
+	components := []string{"main", "updates/main"}
+	architectures := []string{"amd64"}
+
+	tt := []struct {
+		in    string
+		match bool
+	}{
+		{"main/binary-amd64/Packages.xz", true},
+		{"main/binary-amd64/Release", true},
+		{"main/debian-installer/binary-amd64/Packages.gz", true},
+		{"updates/main/binary-amd64/Packages.xz", true},
+		{"main/i18n/Translation-en.bz2", true},
+		{"main/i18n/Index", true},
+		{"main/Contents-amd64.gz", true},
+		{"Contents-amd64.gz", true},
+		{"Contents-udeb-amd64.gz", true},
+		{"main/dep11/Components-amd64.yml.gz", true},
+		{"main/cnf/Commands-amd64.xz", true},
+		{"main/installer-amd64/current/images/SHA256SUMS", true},
+
+		{"main/binary-i386/Packages.xz", false},
+		{"universe/binary-amd64/Packages.xz", false},
+		{"main/source/Sources.xz", false},
+		{"main/Contents-source.gz", false},
+		{"main/i18n/Translation-de.bz2", false},
+		{"universe/dep11/Components-amd64.yml.gz", false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			assert.Equal(t, s.selectsReleaseEntry(tc.in, false, components, architectures), tc.match)
+		})
+	}
+
+	// by default, all translations, Contents indices and AppStream metadata are transferred
+	var defaults DebianSource
+	defaults.Validate("test")
+	for _, fileName := range []string{"main/i18n/Translation-de.bz2", "main/i18n/Index", "main/Contents-amd64.gz", "main/dep11/Components-amd64.yml.gz"} {
+		assert.Equal(t, defaults.selectsReleaseEntry(fileName, false, components, architectures), true)
+	}
+
+	// these can be switched off individually
+	disabled := false
+	optedOut := DebianSource{Languages: []string{}, IncludeContents: &disabled, IncludeDep11: &disabled}
+	optedOut.Validate("test")
+	for _, fileName := range []string{"main/i18n/Translation-en.bz2", "main/i18n/Index", "main/Contents-amd64.gz", "main/dep11/Components-amd64.yml.gz"} {
+		assert.Equal(t, optedOut.selectsReleaseEntry(fileName, false, components, architectures), false)
+	}
+}
+
+func TestDebianFlatRepository(t *testing.T) {
+	tt := []struct {
+		dist         string
+		distRootPath string
+		isFlat       bool
+	}{
+		{"stable", "dists/stable", false},
+		{"./", "", true},
+		{"/", "", true},
+		{"debian/", "debian", true},
+	}
+	for _, tc := range tt {
+		distRootPath, isFlat := debianDistRootPath(tc.dist)
+		assert.Equal(t, distRootPath, tc.distRootPath)
+		assert.Equal(t, isFlat, tc.isFlat)
+	}
+
+	s := DebianSource{includeSources: false}
+	assert.Equal(t, s.selectsReleaseEntry("Packages", true, nil, nil), true)
+	assert.Equal(t, s.selectsReleaseEntry("Packages.gz", true, nil, nil), true)
+	assert.Equal(t, s.selectsReleaseEntry("Sources.xz", true, nil, nil), false)
+	assert.Equal(t, s.selectsReleaseEntry("Contents-amd64.gz", true, nil, nil), false)
+	s.includeSources = true
+	assert.Equal(t, s.selectsReleaseEntry("Sources.xz", true, nil, nil), true)
+}
+
+func TestCheckDebianReleaseDates(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		date, validUntil, previousDate string
+		expectSuccess                  bool
+	}{
+		// no dates at all (e.g. in some third-party repos)
+		{"", "", "", true},
+		// fresh release file
+		{"Sun, 18 Oct 2026 06:00:00 UTC", "Sun, 25 Oct 2026 06:00:00 UTC", "", true},
+		{"Sun, 18 Oct 2026 06:00:00 +0000", "", "Sat, 17 Oct 2026 06:00:00 UTC", true},
+		{"Sun, 18 Oct 2026 06:00:00 UTC", "", "Sun, 18 Oct 2026 06:00:00 UTC", true},
+		{"Thu,  1 Oct 2026 06:00:00 UTC", "", "", true},
+		// expired release file
+		{"Sun, 11 Oct 2026 06:00:00 UTC", "Sun, 18 Oct 2026 06:00:00 UTC", "", false},
+		// replayed release file
+		{"Sat, 17 Oct 2026 06:00:00 UTC", "Sat, 24 Oct 2026 06:00:00 UTC", "Sun, 18 Oct 2026 06:00:00 UTC", false},
+		// malformed dates
+		{"yesterday", "", "Sun, 18 Oct 2026 06:00:00 UTC", false},
+		{"", "tomorrow", "", false},
+	}
+
+	for _, tc := range tt {
+		err := checkDebianReleaseDates(tc.date, tc.validUntil, tc.previousDate, now)
+		assert.Equal(t, err == nil, tc.expectSuccess)
+	}
+}
+
+func TestDecodeDebianParagraphs(t *testing.T) {
+	input := `Package: foo
+Version: 1.0
+Filename: pool/main/f/foo/foo_1.0_amd64.deb
+Size: 1234
+SHA256: 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+Description: Foo
+ Long description.
+
+Package: bar
+Version: 2.0
+Filename: pool/main/b/bar/bar_2.0_all.deb
+Size: 42
+SHA256: fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210
+
+`
+	// the paragraphs are decoded one by one while the index is being decompressed
+	var compressed bytes.Buffer
+	w, err := xz.NewWriter(&compressed)
+	assert.ErrEqual(t, err, nil)
+	_, err = w.Write([]byte(input))
+	assert.ErrEqual(t, err, nil)
+	assert.ErrEqual(t, w.Close(), nil)
+
+	reader, err := newDecompressingReader(compressed.Bytes())
+	assert.ErrEqual(t, err, nil)
+	var packages []debianBinaryPackage
+	err = decodeDebianParagraphs(reader, func(pkg debianBinaryPackage) {
+		packages = append(packages, pkg)
+	})
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, packages, []debianBinaryPackage{
+		{
+			Filename: "pool/main/f/foo/foo_1.0_amd64.deb",
+			Size:     "1234",
+			SHA256:   "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		},
+		{
+			Filename: "pool/main/b/bar/bar_2.0_all.deb",
+			Size:     "42",
+			SHA256:   "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210",
+		},
+	})
+}
@@ -6,8 +6,11 @@ package objects
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/sapcc/go-bits/logg"
@@ -39,6 +42,31 @@ type FileSpec struct {
 	// results of GET on this file
 	Contents []byte
 	Headers  http.Header
+	// only set for files whose results of GET were written into the spool
+	// directory instead of into Contents (see SpoolConfiguration)
+	SpoolPath string
+	// only set for files that are referenced by repository metadata which
+	// declares their checksum and/or size (otherwise nil); the transfer fails if
+	// the downloaded contents do not match
+	ExpectedChecksum  *Checksum
+	ExpectedSizeBytes *uint64
+	// only set for package files whose embedded signature shall be verified
+	// during the transfer (otherwise nil); the transfer fails if the package is
+	// unsigned or not signed by a trusted key
+	SignatureVerifier packageSignatureVerifier
+	// only set for content-addressed files (otherwise false); these are never
+	// transferred again once they exist in the target, as if they matched the
+	// `immutable` regex
+	IsImmutable bool
+	// only set for files that are not transferred, but whose existing object in
+	// the target is still referenced and must therefore not be removed during
+	// cleanup (otherwise false)
+	RetainOnly bool
+	// only set for files that the source refuses to transfer because they could
+	// not be verified (otherwise false); the transfer counts as failed without
+	// touching the existing object in the target, so that the failure shows up
+	// in the report and no cleanup takes place
+	RefuseTransfer bool
 }
 
 // TargetObject returns the object corresponding to this file in the target container.
@@ -67,7 +95,20 @@ func (f File) PerformTransfer(ctx context.Context) (transferResult TransferResul
 	object := f.TargetObject()
 
 	// check if this file needs transfer
+	if f.Spec.RetainOnly {
+		logg.Debug("skipping %s: retained without transfer", object.FullName())
+		return TransferSkipped, 0
+	}
+	if f.Spec.RefuseTransfer {
+		// (the reason was already logged by the source)
+		logg.Debug("not transferring %s: refused by source", object.FullName())
+		return TransferFailed, 0
+	}
+	isImmutable := f.Spec.IsImmutable
 	if rx, ok := f.Job.Matcher.ImmutableFileRx.Unpack(); ok && rx.MatchString(f.Spec.Path) {
+		isImmutable = true
+	}
+	if isImmutable {
 		if f.Job.Target.FileExists[object.Name()] {
 			logg.Debug("skipping %s: already transferred", object.FullName())
 			return TransferSkipped, 0
@@ -141,7 +182,7 @@ func (f File) PerformTransfer(ctx context.Context) (transferResult TransferResul
 		body        io.ReadCloser
 		sourceState FileState
 	)
-	if f.Spec.Contents == nil {
+	if f.Spec.Contents == nil && f.Spec.SpoolPath == "" {
 		path := f.Spec.Path
 		if f.Spec.DownloadPath != "" {
 			path = f.Spec.DownloadPath
@@ -161,6 +202,20 @@ func (f File) PerformTransfer(ctx context.Context) (transferResult TransferResul
 	if sourceState.SkipTransfer { // 304 Not Modified
 		return TransferSkipped, 0
 	}
+	if f.Spec.ExpectedChecksum != nil || f.Spec.ExpectedSizeBytes != nil {
+		body, err = newVerifyingReader(body, f.Spec)
+		if err != nil {
+			logg.Error("cannot verify %s: %s", f.Spec.Path, err.Error())
+			return TransferFailed, 0
+		}
+	}
+
+	if f.Spec.SignatureVerifier != nil {
+		body = newSignatureVerifyingReader(ctx, body, f.Spec.SignatureVerifier)
+		// (this stops the verification if the upload is aborted; closing the
+		// original body a second time is harmless)
+		defer body.Close()
+	}
 
 	if util.LogIndividualTransfers {
 		logg.Info("transferring to %s", object.FullName())
@@ -184,6 +239,14 @@ func (f File) PerformTransfer(ctx context.Context) (transferResult TransferResul
 	// upload file to target
 	var ok bool
 	size := sourceState.SizeBytes
+	// (if the source does not report the size, e.g. for chunked responses, the
+	// size is determined while uploading)
+	var counter *countingReader
+	if size == nil {
+		counter = &countingReader{Base: body}
+		body = counter
+		size = &counter.BytesRead
+	}
 	if f.Job.Segmenting != nil && size != nil && *size > 0 && *size >= f.Job.Segmenting.MinObjectSize {
 		ok = f.uploadLargeObject(ctx, body, uploadHeaders, hdr.IsLargeObject())
 	} else {
@@ -196,6 +259,24 @@ func (f File) PerformTransfer(ctx context.Context) (transferResult TransferResul
 	return TransferFailed, 0
 }
 
+// countingReader is an io.ReadCloser that counts the bytes read through it.
+type countingReader struct {
+	Base      io.ReadCloser
+	BytesRead uint64
+}
+
+// Read implements the io.Reader interface.
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.Base.Read(buf)
+	r.BytesRead += util.AtLeastZero(n)
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (r *countingReader) Close() error {
+	return r.Base.Close()
+}
+
 func (f File) uploadSymlink(ctx context.Context, previousTarget *schwift.Object, cleanupOldSegments bool) TransferResult {
 	object := f.TargetObject()
 	newTarget := f.Job.Target.ObjectAtPath(f.Spec.SymlinkTargetPath)
@@ -216,6 +297,22 @@ func (f File) uploadSymlink(ctx context.Context, previousTarget *schwift.Object,
 	return TransferFailed
 }
 
+// generatedFileSpec returns a FileSpec for a file whose contents were
+// generated by a source (e.g. a filtered repository index) instead of being
+// downloaded verbatim. Since there is no upstream Etag for such contents, the
+// Etag is derived from the contents themselves, so that the file is only
+// re-uploaded when its contents change.
+func generatedFileSpec(path string, contents []byte, contentType string) FileSpec {
+	hdr := make(http.Header)
+	hdr.Set("Etag", fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(contents))))
+	hdr.Set("Content-Type", contentType)
+	return FileSpec{
+		Path:     path,
+		Contents: contents,
+		Headers:  hdr,
+	}
+}
+
 func (s FileSpec) toTransferFormat(requestHeaders schwift.ObjectHeaders) (io.ReadCloser, FileState, error) {
 	targetState := FileState{
 		Etag:         requestHeaders.Get("If-None-Match"),
@@ -223,6 +320,13 @@ func (s FileSpec) toTransferFormat(requestHeaders schwift.ObjectHeaders) (io.Rea
 	}
 
 	sizeBytes := uint64(len(s.Contents))
+	if s.SpoolPath != "" {
+		fi, err := os.Stat(s.SpoolPath)
+		if err != nil {
+			return nil, FileState{}, err
+		}
+		sizeBytes = util.AtLeastZero(fi.Size())
+	}
 
 	sourceState := FileState{
 		Etag:         s.Headers.Get("Etag"),
@@ -247,7 +351,17 @@ func (s FileSpec) toTransferFormat(requestHeaders schwift.ObjectHeaders) (io.Rea
 		sourceState.SkipTransfer = targetMtime.Equal(sourceMtime)
 	}
 
-	return io.NopCloser(bytes.NewReader(s.Contents)), sourceState, nil
+	body, err := s.openContents()
+	return body, sourceState, err
+}
+
+// openContents returns a reader for the contents of a FileSpec that was
+// generated or cached during scraping.
+func (s FileSpec) openContents() (io.ReadCloser, error) {
+	if s.SpoolPath != "" {
+		return os.Open(s.SpoolPath)
+	}
+	return io.NopCloser(bytes.NewReader(s.Contents)), nil
 }
 
 // StatusSwiftRateLimit is the non-standard HTTP status code used by Swift to
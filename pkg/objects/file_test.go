@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"crypto/md5" //nolint:gosec // Swift uses this
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.xyrillian.de/gg/assert"
+	"go.xyrillian.de/schwift/v2"
+)
+
+// testSwiftBackend is a schwift.Backend that sends requests to a test server
+// without authentication.
+type testSwiftBackend struct {
+	endpointURL string
+}
+
+func (b testSwiftBackend) EndpointURL() string { return b.endpointURL }
+
+func (b testSwiftBackend) Clone(newEndpointURL string) schwift.Backend {
+	return testSwiftBackend{newEndpointURL}
+}
+
+func (b testSwiftBackend) Do(req *http.Request) (*http.Response, error) {
+	return http.DefaultClient.Do(req)
+}
+
+func TestTransferWithoutContentLength(t *testing.T) {
+	// the source streams the file without announcing its size, like GitHub
+	// does for source archives
+	contents := strings.Repeat("source archive contents\n", 1000)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(contents[:100])) //nolint:errcheck // not relevant for this test
+		w.(http.Flusher).Flush()        // (forces chunked transfer encoding)
+		w.Write([]byte(contents[100:])) //nolint:errcheck // not relevant for this test
+	}))
+	defer source.Close()
+
+	uploaded := make(map[string]string)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/info":
+			w.Write([]byte(`{"swift":{"version":"2.30.0"}}`)) //nolint:errcheck // not relevant for this test
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			buf, err := io.ReadAll(r.Body)
+			assert.ErrEqual(t, err, nil)
+			uploaded[r.URL.Path] = string(buf)
+			w.Header().Set("Etag", fmt.Sprintf("%x", md5.Sum(buf))) //nolint:gosec // Swift uses this
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer target.Close()
+
+	account, err := schwift.InitializeAccount(testSwiftBackend{target.URL + "/v1/AUTH_test/"})
+	assert.ErrEqual(t, err, nil)
+	sourceURL, err := url.Parse(source.URL + "/")
+	assert.ErrEqual(t, err, nil)
+	job := &Job{
+		Source: &URLSource{URLString: sourceURL.String(), URL: sourceURL, HTTPClient: http.DefaultClient},
+		Target: &SwiftLocation{Account: account, Container: account.Container("mirror")},
+	}
+
+	file := File{Job: job, Spec: FileSpec{Path: "archive.tar.gz"}}
+	result, size := file.PerformTransfer(t.Context())
+	assert.Equal(t, result, TransferSuccess)
+	assert.Equal(t, size, uint64(len(contents)))
+	assert.Equal(t, uploaded["/v1/AUTH_test/mirror/archive.tar.gz"], contents)
+}
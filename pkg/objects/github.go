@@ -6,122 +6,222 @@ package objects
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/sapcc/go-api-declarations/bininfo"
+	"github.com/sapcc/go-bits/logg"
 	"github.com/sapcc/go-bits/regexpext"
-	"github.com/sapcc/go-bits/secrets"
+	. "go.xyrillian.de/gg/option"
 	"go.xyrillian.de/schwift/v2"
 
 	"github.com/sapcc/swift-http-import/pkg/util"
 )
 
+// GithubReleaseSource is a Source that transfers the assets of the releases
+// of a GitHub repository.
 type GithubReleaseSource struct {
+	githubRepository `yaml:",inline"`
+
 	// Options from config file.
-	URLString         string                `yaml:"url"`
-	Token             secrets.FromEnv       `yaml:"token"`
-	TagNamePattern    regexpext.PlainRegexp `yaml:"tag_name_pattern"`
-	IncludeDraft      bool                  `yaml:"include_draft"`
-	IncludePrerelease bool                  `yaml:"include_prerelease"`
+	TagNamePattern          regexpext.PlainRegexp         `yaml:"tag_name_pattern"`
+	AssetNamePattern        regexpext.PlainRegexp         `yaml:"asset_name_pattern"`
+	ExcludeAssetNamePattern Option[regexpext.PlainRegexp] `yaml:"exclude_asset_name_pattern"`
+	IncludeDraft            bool                          `yaml:"include_draft"`
+	IncludePrerelease       bool                          `yaml:"include_prerelease"`
+	LatestReleases          uint                          `yaml:"latest_releases"`
+	OrderReleasesBy         string                        `yaml:"order_releases_by"`
+	LatestAlias             string                        `yaml:"latest_alias"`
+	IncludeReleaseMetadata  bool                          `yaml:"include_release_metadata"`
+	IncludeSourceArchives   bool                          `yaml:"include_source_archives"`
+	VerifyChecksums         *GithubChecksumConfiguration  `yaml:"verify_checksums"`
 
 	// Compiled configuration.
-	repoURL            *url.URL `yaml:"-"`
 	releaseEndpointURL *url.URL `yaml:"-"`
 	// notOlderThan is used to limit release listing to prevent excess API requests.
 	notOlderThan *time.Time `yaml:"-"`
+	// target is used to persist the release pages (with their ETags) between
+	// runs, so that unchanged pages can be requested conditionally.
+	target *SwiftLocation `yaml:"-"`
+	// gpgKeyRing is used to verify GPG signatures of checksum files.
+	gpgKeyRing *util.GPGKeyRing `yaml:"-"`
+	// aliasPaths are the paths below LatestAlias that belong to the newest
+	// release (filled during ListAllFiles, nil if the listing did not complete).
+	aliasPaths map[string]bool `yaml:"-"`
 }
 
-// githubRepoRx is used to extract repository owner and name from a url.URL.Path field.
-//
-// Example:
-//
-//	Input: /sapcc/swift-http-import
-//	Match groups: ["sapcc", "swift-http-import"]
-var githubRepoRx = regexp.MustCompile(`^/([^\s/]+)/([^\s/]+)/?$`)
+// githubCachePath is the path (below the target's object prefix) of the file
+// that persists the release pages and checksum files between runs.
+const githubCachePath = ".github-releases.json"
 
 // Validate implements the Source interface.
 func (s *GithubReleaseSource) Validate(name string) []error {
-	var err error
-	s.repoURL, err = url.Parse(s.URLString)
-	if err != nil {
-		return []error{fmt.Errorf("could not parse %s.url: %w", name, err)}
-	}
-
-	// validate s.repoURL
-	errInvalidURL := fmt.Errorf("invalid value for %s.url: expected a url in the format %q, got: %q",
-		name, "http(s)://<hostname>/<owner>/<repo>", s.URLString)
-	if s.repoURL.Scheme != "http" && s.repoURL.Scheme != "https" {
-		return []error{errInvalidURL}
-	}
-	if s.repoURL.RawQuery != "" || s.repoURL.Fragment != "" {
-		return []error{errInvalidURL}
-	}
-	match := githubRepoRx.FindStringSubmatch(s.repoURL.Path)
-	if match == nil {
-		return []error{errInvalidURL}
-	}
-	ownerName, repoName := match[1], match[2]
-
-	// derive apiBaseURL from s.repoURL
-	var apiBaseURL *url.URL
-	if s.repoURL.Hostname() == "github.com" {
-		apiBaseURL, err = url.Parse("https://api.github.com/")
-		if err != nil {
-			return []error{fmt.Errorf("could not build apiBaseURL: %w", err)}
-		}
-	} else {
-		repoURLCloned := *s.repoURL
-		repoURLCloned.Path = "/api/v3/"
-		repoURLCloned.RawPath = "/api/v3/"
-		apiBaseURL = &repoURLCloned
+	errs := s.githubRepository.validate(name)
+	if len(errs) > 0 {
+		return errs
 	}
 
 	// derive endpoint URL for release listing
 	// (this sets a higher page size than the default of 30 to avoid exceeding the API rate limit)
 	const pageSize = 50
-	endpointPath := fmt.Sprintf("repos/%s/%s/releases?per_page=%d", ownerName, repoName, pageSize)
-	s.releaseEndpointURL, err = apiBaseURL.Parse(endpointPath)
+	var err error
+	s.releaseEndpointURL, err = s.endpointURL(fmt.Sprintf("releases?per_page=%d", pageSize))
 	if err != nil {
-		return []error{fmt.Errorf("could not build URL for releases of %s: %w", s.repoURL.String(), err)}
+		return []error{err}
 	}
 
-	// validate s.Token
-	if s.repoURL.Hostname() != "github.com" {
-		if s.Token == "" {
-			return []error{fmt.Errorf("%s.token is required for repositories hosted on GitHub Enterprise", name)}
+	switch s.OrderReleasesBy {
+	case "", githubOrderByPublishedAt, githubOrderBySemver:
+	default:
+		return []error{fmt.Errorf("invalid value for %s.order_releases_by: expected %q or %q, got %q",
+			name, githubOrderByPublishedAt, githubOrderBySemver, s.OrderReleasesBy)}
+	}
+	if s.LatestAlias != "" {
+		if strings.Contains(s.LatestAlias, "/") || s.LatestAlias == "." || s.LatestAlias == ".." {
+			return []error{fmt.Errorf("invalid value for %s.latest_alias: must be a single path element, got %q", name, s.LatestAlias)}
 		}
 	}
 
+	if s.VerifyChecksums != nil {
+		return s.VerifyChecksums.Validate(name + ".verify_checksums")
+	}
 	return nil
 }
 
 // Connect implements the Source interface.
 func (s *GithubReleaseSource) Connect(ctx context.Context, name string) error {
+	err := s.githubRepository.connect(name)
+	if err != nil {
+		return err
+	}
+	if s.VerifyChecksums != nil {
+		err := s.VerifyChecksums.connect()
+		if err != nil {
+			return fmt.Errorf("cannot load public key for %s.verify_checksums: %w", name, err)
+		}
+	}
 	return nil
 }
 
-// ListEntries implements the Source interface.
-func (s *GithubReleaseSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
-	return nil, ErrListEntriesNotSupported
-}
-
 // ListAllFiles implements the Source interface.
 func (s *GithubReleaseSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
-	releases, err := s.getReleases(ctx)
+	cache, err := s.loadCache(ctx)
 	if err != nil {
+		return &ListEntriesError{
+			Location: s.target.ObjectAtPath(githubCachePath).FullName(),
+			Message:  "GET failed",
+			Inner:    err,
+		}
+	}
+	releases, pages, err := s.getReleases(ctx, cache.Pages)
+	if err != nil {
+		message := "could not list releases"
+		if errors.Is(err, errGithubRateLimited) {
+			message = ErrMessageRateLimited
+		}
 		return &ListEntriesError{
 			Location: s.repoURL.String(),
-			Message:  "could not list releases",
+			Message:  message,
 			Inner:    err,
 		}
 	}
 
+	nextCache := githubCache{Pages: pages, Checksums: make(map[string]githubReleaseChecksums)}
+	aliasPaths := make(map[string]bool)
+
+	for idx, r := range s.selectReleases(releases) {
+		var checksums *githubReleaseChecksums
+		if s.VerifyChecksums != nil {
+			c, err := s.getReleaseChecksums(ctx, r, cache.Checksums, nextCache.Checksums)
+			if err != nil {
+				logg.Error("refusing to transfer assets of release %s in %s: %s", r.TagName, s.repoURL.String(), err.Error())
+			}
+			checksums = &c
+		}
+
+		files, err := s.releaseFiles(r, checksums)
+		if err != nil {
+			return &ListEntriesError{Location: s.repoURL.String(), Message: "could not serialize metadata for release " + r.TagName, Inner: err}
+		}
+		for _, fs := range files {
+			out <- fs
+
+			// the newest release is also made available below the alias (if the
+			// target does not support symlinks, the files are transferred again)
+			if idx == 0 && s.LatestAlias != "" {
+				alias := fs
+				alias.Path = fmt.Sprintf("%s/%s", s.LatestAlias, strings.TrimPrefix(fs.Path, r.TagName+"/"))
+				alias.SymlinkTargetPath = fs.Path
+				aliasPaths[alias.Path] = true
+				out <- alias
+			}
+		}
+	}
+
+	buf, err := json.Marshal(nextCache)
+	if err != nil {
+		return &ListEntriesError{Location: s.repoURL.String(), Message: "could not serialize release pages", Inner: err}
+	}
+	out <- generatedFileSpec(githubCachePath, buf, "application/json")
+	s.aliasPaths = aliasPaths
+	return nil
+}
+
+// RecordCompletedRun implements the CompletedRunRecorder interface.
+//
+// When the latest release changes, the files of the previous latest release
+// that do not exist in the current one would otherwise linger below the
+// alias (or be removed only if the cleanup strategy says so). Since the alias
+// shall always reflect the latest release, these files are deleted once the
+// files of the latest release have been transferred without errors.
+func (s *GithubReleaseSource) RecordCompletedRun(ctx context.Context) error {
+	err := s.removeStaleAliases(ctx, s.aliasPaths)
+	if err != nil {
+		return fmt.Errorf("could not remove stale files below %s: %w", s.LatestAlias, err)
+	}
+	return nil
+}
+
+// Helper function for GithubReleaseSource.RecordCompletedRun().
+func (s *GithubReleaseSource) removeStaleAliases(ctx context.Context, currentPaths map[string]bool) error {
+	if s.LatestAlias == "" || currentPaths == nil || s.target == nil || s.target.Container == nil {
+		return nil
+	}
+	existingFiles, err := s.target.listObjectsBelow(ctx, s.LatestAlias)
+	if err != nil {
+		return err
+	}
+
+	var staleObjects []*schwift.Object
+	for _, file := range existingFiles {
+		if !currentPaths[file.Path] {
+			logg.Info("removing %s since it does not belong to the latest release anymore", file.Path)
+			staleObjects = append(staleObjects, s.target.ObjectAtPath(file.Path))
+		}
+	}
+	if len(staleObjects) == 0 {
+		return nil
+	}
+	_, _, err = s.target.Container.Account().BulkDelete(ctx, staleObjects, nil, nil)
+	return err
+}
+
+const (
+	githubOrderByPublishedAt = "published_at"
+	githubOrderBySemver      = "semver"
+)
+
+// Helper function for GithubReleaseSource.ListAllFiles().
+//
+// Returns the releases that shall be transferred, newest first.
+func (s *GithubReleaseSource) selectReleases(releases []githubRelease) []githubRelease {
+	var result []githubRelease
 	for _, r := range releases {
 		if !s.IncludeDraft && r.IsDraft {
 			continue
@@ -132,167 +232,327 @@ func (s *GithubReleaseSource) ListAllFiles(ctx context.Context, out chan<- FileS
 		if !s.TagNamePattern.MatchString(r.TagName) {
 			continue
 		}
+		result = append(result, r)
+	}
 
-		for _, a := range r.Assets {
-			fs := FileSpec{
-				Path:         fmt.Sprintf("%s/%s", r.TagName, a.Name),
-				DownloadPath: a.DownloadURL,
-				LastModified: new(a.UpdatedAt),
+	if s.OrderReleasesBy == githubOrderBySemver {
+		versions := make(map[string]nugetVersion, len(result))
+		for _, r := range result {
+			v, ok := parseGithubSemver(r.TagName)
+			if ok {
+				versions[r.TagName] = v
+			} else {
+				logg.Debug("tag %q in %s is not a semantic version, so it is ordered after all other releases", r.TagName, s.repoURL.String())
 			}
-			out <- fs
 		}
+		slices.SortStableFunc(result, func(lhs, rhs githubRelease) int {
+			lv, lok := versions[lhs.TagName]
+			rv, rok := versions[rhs.TagName]
+			switch {
+			case lok && rok:
+				if cmp := rv.Compare(lv); cmp != 0 {
+					return cmp
+				}
+			case lok:
+				return -1
+			case rok:
+				return 1
+			}
+			return rhs.PublishedAt.Compare(lhs.PublishedAt)
+		})
+	} else {
+		slices.SortStableFunc(result, func(lhs, rhs githubRelease) int {
+			return rhs.PublishedAt.Compare(lhs.PublishedAt)
+		})
 	}
 
-	return nil
+	if s.LatestReleases > 0 && uint(len(result)) > s.LatestReleases {
+		result = result[:s.LatestReleases]
+	}
+	return result
 }
 
-const (
-	githubHeaderAPIVersion  = "X-Github-Api-Version"
-	githubDefaultAPIVersion = "2022-11-28"
-	githubMediaType         = "application/vnd.github.v3+json"
-)
+// Helper function for GithubReleaseSource.ListAllFiles().
+//
+// Returns the files that shall be transferred for the given release: the
+// selected assets, and optionally the release metadata and source archives.
+// If checksums are given, assets are verified against them, and assets that
+// are not listed are refused (see FileSpec.RefuseTransfer).
+func (s *GithubReleaseSource) releaseFiles(r githubRelease, checksums *githubReleaseChecksums) ([]FileSpec, error) {
+	var (
+		result   []FileSpec
+		metadata = githubReleaseMetadata{
+			TagName:     r.TagName,
+			Name:        r.Name,
+			Body:        r.Body,
+			Author:      r.Author.Login,
+			URL:         r.HTMLURL,
+			PublishedAt: r.PublishedAt,
+			Assets:      []githubAssetMetadata{},
+		}
+	)
+	for _, a := range r.Assets {
+		if !s.isAssetSelected(a.Name) {
+			continue
+		}
+		fs := FileSpec{
+			Path:         fmt.Sprintf("%s/%s", r.TagName, a.Name),
+			DownloadPath: a.DownloadURL,
+			LastModified: new(a.UpdatedAt),
+		}
+		if checksums != nil && !checksums.isChecksumFile(a.Name) {
+			checksum, exists := checksums.Checksums[a.Name]
+			if exists {
+				fs.ExpectedChecksum = &checksum
+			} else {
+				// (if there is no valid checksum file, this was already logged in ListAllFiles)
+				if checksums.FileName != "" {
+					logg.Error("refusing to transfer %s: not listed in %s", fs.Path, checksums.FileName)
+				}
+				fs.RefuseTransfer = true
+			}
+		}
+		result = append(result, fs)
 
-// GetFile implements the Source interface.
-func (s *GithubReleaseSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (io.ReadCloser, FileState, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, http.NoBody)
-	if err != nil {
-		return nil, FileState{}, fmt.Errorf("skipping: could not create request for %s: %w", path, err)
-	}
-	for key, val := range requestHeaders.Headers {
-		req.Header.Set(key, val)
+		// for older assets, the checksum from a verified checksum file is the
+		// next best thing
+		digest := a.Digest
+		if digest == "" && fs.ExpectedChecksum != nil {
+			digest = fs.ExpectedChecksum.String()
+		}
+		metadata.Assets = append(metadata.Assets, githubAssetMetadata{
+			Name:      a.Name,
+			SizeBytes: a.SizeBytes,
+			Digest:    digest,
+		})
 	}
-	req.Header.Set(githubHeaderAPIVersion, githubDefaultAPIVersion)
-	req.Header.Set("User-Agent", "swift-http-import/"+bininfo.VersionOr("dev"))
-	req.Header.Set("Accept", "application/octet-stream")
-	if s.Token != "" {
-		req.Header.Set("Authorization", "Bearer "+string(s.Token))
+
+	// the source archives are generated by GitHub on request, so they are only
+	// transferred once to avoid downloading them again in every run
+	if s.IncludeSourceArchives {
+		archiveName := fmt.Sprintf("%s-%s", s.repoName, strings.ReplaceAll(r.TagName, "/", "-"))
+		for _, archive := range []struct{ URL, Extension string }{{r.TarballURL, ".tar.gz"}, {r.ZipballURL, ".zip"}} {
+			if archive.URL == "" {
+				continue
+			}
+			result = append(result, FileSpec{
+				Path:         fmt.Sprintf("%s/%s%s", r.TagName, archiveName, archive.Extension),
+				DownloadPath: archive.URL,
+				LastModified: new(r.PublishedAt),
+				IsImmutable:  true,
+			})
+		}
 	}
 
-	// We use http.DefaultClient explicitly instead of retrieving (s.client.Client()) the
-	// same http.Client that was passed to github.Client because that http.Client, when
-	// obtained using oauth2.NewClient(), does not return all headers in the request
-	// response.
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, FileState{}, fmt.Errorf("skipping %s: GET failed: %w", req.URL.String(), err)
+	if s.IncludeReleaseMetadata {
+		buf, err := json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		fs := generatedFileSpec(fmt.Sprintf("%s/%s", r.TagName, githubReleaseMetadataFileName), buf, "application/json")
+		fs.LastModified = new(r.PublishedAt)
+		result = append(result, fs)
 	}
+	return result, nil
+}
+
+// githubReleaseMetadataFileName is the name of the file that describes a
+// release (if `include_release_metadata` is set).
+const githubReleaseMetadataFileName = "release.json"
+
+// githubReleaseMetadata is the contents of the release metadata file.
+type githubReleaseMetadata struct {
+	TagName     string                `json:"tag_name"`
+	Name        string                `json:"name"`
+	Body        string                `json:"body"`
+	Author      string                `json:"author"`
+	URL         string                `json:"html_url"`
+	PublishedAt time.Time             `json:"published_at"`
+	Assets      []githubAssetMetadata `json:"assets"`
+}
+
+// githubAssetMetadata appears in type githubReleaseMetadata.
+type githubAssetMetadata struct {
+	Name      string `json:"name"`
+	SizeBytes uint64 `json:"size"`
+	// Digest is only reported by GitHub for assets that were uploaded since
+	// June 2025. For older assets, it is taken from the verified checksum file
+	// (if any), or omitted.
+	Digest string `json:"digest,omitempty"`
+}
 
-	if resp.StatusCode != http.StatusOK &&
-		resp.StatusCode != http.StatusNotModified {
-		return nil, FileState{}, fmt.Errorf(
-			"skipping %s: GET returned unexpected status code: expected 200 or 304, but got %d",
-			req.URL.String(), resp.StatusCode,
-		)
+// Helper function for GithubReleaseSource.releaseFiles().
+func (s *GithubReleaseSource) isAssetSelected(name string) bool {
+	if !s.AssetNamePattern.MatchString(name) {
+		return false
+	}
+	if rx, ok := s.ExcludeAssetNamePattern.Unpack(); ok && rx.MatchString(name) {
+		return false
 	}
+	return true
+}
 
-	var sizeBytes *uint64
-	if resp.ContentLength < 0 {
-		sizeBytes = nil
-	} else {
-		sizeBytes = new(util.AtLeastZero(resp.ContentLength))
+// githubSemverRx matches a semantic version at the end of a tag name, with an
+// optional prefix like "v" or "server-".
+var githubSemverRx = regexp.MustCompile(`(?:^|[^0-9.])([0-9]+\.[0-9]+\.[0-9]+(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?)$`)
+
+// Helper function for GithubReleaseSource.selectReleases().
+//
+// Versions are compared like NuGet versions, which follow the SemVer 2.0
+// rules for precedence (except that prerelease labels are case-insensitive).
+func parseGithubSemver(tagName string) (nugetVersion, bool) {
+	match := githubSemverRx.FindStringSubmatch(tagName)
+	if match == nil {
+		return nugetVersion{}, false
 	}
+	v, err := parseNuGetVersion(match[1])
+	return v, err == nil
+}
+
+// githubCache is persisted in the target at githubCachePath.
+type githubCache struct {
+	Pages githubPageCache `json:"pages"`
+	// Checksums contains the checksum files of the releases, by the download
+	// URL of the checksum file.
+	Checksums map[string]githubReleaseChecksums `json:"checksums,omitempty"`
+}
 
-	return resp.Body, FileState{
-		Etag:         resp.Header.Get("Etag"),
-		LastModified: resp.Header.Get("Last-Modified"),
-		SizeBytes:    sizeBytes,
-		ExpiryTime:   nil, // no way to get this information via HTTP only
-		SkipTransfer: resp.StatusCode == http.StatusNotModified,
-		ContentType:  resp.Header.Get("Content-Type"),
-	}, nil
+// githubPageCache contains the release pages from the previous run, by their
+// URL.
+type githubPageCache map[string]githubCachedPage
+
+// githubCachedPage is a page of the release listing in a githubPageCache.
+type githubCachedPage struct {
+	Etag     string          `json:"etag"`
+	NextURL  string          `json:"next_url,omitempty"`
+	Releases []githubRelease `json:"releases"`
+}
+
+// Helper function for GithubReleaseSource.ListAllFiles().
+func (s *GithubReleaseSource) loadCache(ctx context.Context) (githubCache, error) {
+	if s.target == nil || s.target.Container == nil {
+		return githubCache{}, nil
+	}
+	buf, err := s.target.ObjectAtPath(githubCachePath).Download(ctx, nil).AsByteSlice()
+	if err != nil {
+		if schwift.Is(err, http.StatusNotFound) {
+			return githubCache{}, nil
+		}
+		return githubCache{}, err
+	}
+	var cache githubCache
+	err = json.Unmarshal(buf, &cache)
+	if err != nil {
+		// not a problem, we will just fetch all pages again
+		logg.Error("ignoring malformed %s: %s", githubCachePath, err.Error())
+		return githubCache{}, nil
+	}
+	return cache, nil
 }
 
 type githubRelease struct {
 	TagName      string    `json:"tag_name"`
+	Name         string    `json:"name"`
+	Body         string    `json:"body"`
+	HTMLURL      string    `json:"html_url"`
 	IsDraft      bool      `json:"draft"`
 	IsPrerelease bool      `json:"prerelease"`
 	PublishedAt  time.Time `json:"published_at"`
-	Assets       []struct {
-		DownloadURL string    `json:"url"`
-		Name        string    `json:"name"`
-		UpdatedAt   time.Time `json:"updated_at"`
-	} `json:"assets"`
+	TarballURL   string    `json:"tarball_url"`
+	ZipballURL   string    `json:"zipball_url"`
+	Author       struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Assets []githubAsset `json:"assets"`
 }
 
-func (s *GithubReleaseSource) getReleases(ctx context.Context) ([]githubRelease, error) {
+type githubAsset struct {
+	DownloadURL string    `json:"url"`
+	Name        string    `json:"name"`
+	SizeBytes   uint64    `json:"size"`
+	Digest      string    `json:"digest"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Helper function for GithubReleaseSource.ListAllFiles().
+//
+// Pages that are in the given cache are requested conditionally (with
+// If-None-Match), so that unchanged pages do not count against the API rate
+// limit. Returns the release pages that were seen in this run, to be used as
+// the cache in the next run.
+func (s *GithubReleaseSource) getReleases(ctx context.Context, previousPages githubPageCache) ([]githubRelease, githubPageCache, error) {
 	var result []githubRelease
+	pages := make(githubPageCache)
 
 	endpointURLString := s.releaseEndpointURL.String()
 	for endpointURLString != "" {
-		// build request
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURLString, http.NoBody)
+		page, err := s.getReleasePage(ctx, endpointURLString, previousPages)
 		if err != nil {
-			return nil, fmt.Errorf("could not create request for %s: %w", endpointURLString, err)
-		}
-		req.Header.Set(githubHeaderAPIVersion, githubDefaultAPIVersion)
-		req.Header.Set("User-Agent", "swift-http-import/"+bininfo.VersionOr("dev"))
-		req.Header.Set("Accept", githubMediaType)
-		if s.Token != "" {
-			req.Header.Set("Authorization", "Bearer "+string(s.Token))
+			return nil, nil, err
 		}
-
-		// execute request
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("could not GET %s: %w", endpointURLString, err)
-		}
-		defer resp.Body.Close()
-
-		// expect status code 200 OK
-		if resp.StatusCode != http.StatusOK {
-			var respBody string
-			buf, err := io.ReadAll(resp.Body)
-			if err == nil {
-				respBody = string(buf)
-			} else {
-				respBody = "could not read body: " + err.Error()
-			}
-			return nil, fmt.Errorf("could not GET %s: expected 200 OK, but got %s (response was: %s)", endpointURLString, resp.Status, respBody)
-		}
-
-		// decode response body
-		var page []githubRelease
-		err = json.NewDecoder(resp.Body).Decode(&page)
-		if err != nil {
-			return nil, fmt.Errorf("could not GET %s: while parsing JSON response body: %w", endpointURLString, err)
-		}
-		result = append(result, page...)
+		pages[endpointURLString] = page
+		result = append(result, page.Releases...)
 
 		// Check if the last release in the result slice is newer than the notOlderThan
 		// time. If not, then we don't need to get further releases.
-		if s.notOlderThan != nil {
+		if s.notOlderThan != nil && len(result) > 0 {
 			lastRelease := result[len(result)-1]
 			if s.notOlderThan.After(lastRelease.PublishedAt) {
 				break
 			}
 		}
+		endpointURLString = page.NextURL
+	}
 
-		// URL for next page is in `Link` header, looking like `<https://...>; rel="next"`
-		endpointURLString = "" // if we do not find one below, we are on the last page and need to break the loop
-		if linkHeader := resp.Header.Get("Link"); linkHeader != "" {
-			for link := range strings.SplitSeq(linkHeader, ",") {
-				href, metadata, ok := strings.Cut(strings.TrimSpace(link), ";")
-				if !ok {
-					continue
-				}
-				if strings.TrimSpace(metadata) != `rel="next"` {
-					continue
-				}
+	return result, pages, nil
+}
 
-				href, ok = strings.CutPrefix(href, "<")
-				if !ok {
-					continue
-				}
-				href, ok = strings.CutSuffix(href, ">")
-				if !ok {
-					continue
-				}
+// Helper function for GithubReleaseSource.getReleases().
+func (s *GithubReleaseSource) getReleasePage(ctx context.Context, endpointURLString string, previousPages githubPageCache) (githubCachedPage, error) {
+	// build request
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURLString, http.NoBody)
+	if err != nil {
+		return githubCachedPage{}, fmt.Errorf("could not create request for %s: %w", endpointURLString, err)
+	}
+	req.Header.Set("Accept", githubMediaType)
+	previousPage, hasPreviousPage := previousPages[endpointURLString]
+	if hasPreviousPage && previousPage.Etag != "" {
+		req.Header.Set("If-None-Match", previousPage.Etag)
+	}
 
-				endpointURLString = href
-				break
-			}
+	// execute request
+	resp, err := s.doRequest(ctx, req)
+	if err != nil {
+		return githubCachedPage{}, fmt.Errorf("could not GET %s: %w", endpointURLString, err)
+	}
+	defer resp.Body.Close()
+
+	// 304 Not Modified means that the page from the previous run can be reused
+	if resp.StatusCode == http.StatusNotModified && hasPreviousPage {
+		return previousPage, nil
+	}
+
+	// expect status code 200 OK
+	if resp.StatusCode != http.StatusOK {
+		var respBody string
+		buf, err := io.ReadAll(resp.Body)
+		if err == nil {
+			respBody = string(buf)
+		} else {
+			respBody = "could not read body: " + err.Error()
 		}
+		return githubCachedPage{}, fmt.Errorf("could not GET %s: expected 200 OK, but got %s (response was: %s)", endpointURLString, resp.Status, respBody)
 	}
 
-	return result, nil
+	// decode response body
+	page := githubCachedPage{Etag: resp.Header.Get("Etag")}
+	err = json.NewDecoder(resp.Body).Decode(&page.Releases)
+	if err != nil {
+		return githubCachedPage{}, fmt.Errorf("could not GET %s: while parsing JSON response body: %w", endpointURLString, err)
+	}
+
+	// URL for next page is in `Link` header, looking like `<https://...>; rel="next"`
+	// (if we do not find one, we are on the last page)
+	page.NextURL = parseGithubNextPageLink(resp.Header.Get("Link"))
+	return page, nil
 }
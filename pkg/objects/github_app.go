@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sapcc/go-api-declarations/bininfo"
+	"github.com/sapcc/go-bits/logg"
+)
+
+// GithubAppConfiguration contains the options for authenticating to the
+// GitHub API as an installation of a GitHub App, instead of with a personal
+// access token.
+type GithubAppConfiguration struct {
+	ID             int64  `yaml:"id"`
+	PrivateKeyPath string `yaml:"private_key"`
+	InstallationID int64  `yaml:"installation_id"`
+}
+
+// Validate returns errors for missing options.
+func (c GithubAppConfiguration) Validate(name string) []error {
+	var errs []error
+	if c.ID == 0 {
+		errs = append(errs, fmt.Errorf("missing value for %s.id", name))
+	}
+	if c.PrivateKeyPath == "" {
+		errs = append(errs, fmt.Errorf("missing value for %s.private_key", name))
+	}
+	if c.InstallationID == 0 {
+		errs = append(errs, fmt.Errorf("missing value for %s.installation_id", name))
+	}
+	return errs
+}
+
+// githubAppAuthenticator obtains installation access tokens for a GitHub App.
+// Tokens are cached, and a new token is obtained shortly before the previous
+// one expires (they are valid for one hour).
+//
+// Reference: <https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/authenticating-as-a-github-app-installation>
+type githubAppAuthenticator struct {
+	AppID      int64
+	PrivateKey *rsa.PrivateKey
+	TokenURL   *url.URL
+	mutex      sync.Mutex
+	token      string
+	expiresAt  time.Time
+}
+
+// Tokens are renewed when they expire within this duration, so that they do
+// not expire while a request is in flight.
+const githubAppTokenRenewalMargin = 5 * time.Minute
+
+// Helper function for githubRepository.connect().
+func newGithubAppAuthenticator(cfg GithubAppConfiguration, apiBaseURL *url.URL) (*githubAppAuthenticator, error) {
+	buf, err := os.ReadFile(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", cfg.PrivateKeyPath)
+	}
+
+	// GitHub issues keys in PKCS#1 format, but PKCS#8 is also accepted in case
+	// the key was converted
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			key, ok = parsed.(*rsa.PrivateKey)
+			if !ok {
+				err = fmt.Errorf("expected an RSA key, but got %T", parsed)
+			}
+		}
+	default:
+		err = fmt.Errorf("unexpected PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key in %s: %w", cfg.PrivateKeyPath, err)
+	}
+
+	tokenURL, err := apiBaseURL.Parse(fmt.Sprintf("app/installations/%d/access_tokens", cfg.InstallationID))
+	if err != nil {
+		return nil, err
+	}
+	return &githubAppAuthenticator{AppID: cfg.ID, PrivateKey: key, TokenURL: tokenURL}, nil
+}
+
+// Token returns an installation access token, obtaining a new one if necessary.
+func (a *githubAppAuthenticator) Token(ctx context.Context) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.token != "" && time.Until(a.expiresAt) > githubAppTokenRenewalMargin {
+		return a.token, nil
+	}
+
+	jwt, err := a.makeJWT(time.Now())
+	if err != nil {
+		return "", fmt.Errorf("cannot sign JWT for GitHub App: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL.String(), http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(githubHeaderAPIVersion, githubDefaultAPIVersion)
+	req.Header.Set("User-Agent", "swift-http-import/"+bininfo.VersionOr("dev"))
+	req.Header.Set("Accept", githubMediaType)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not POST %s: %w", a.TokenURL.String(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		buf, _ := io.ReadAll(resp.Body) //nolint:errcheck // only used for the error message
+		return "", fmt.Errorf("could not POST %s: expected 201 Created, but got %s (response was: %s)", a.TokenURL.String(), resp.Status, string(buf))
+	}
+
+	var data struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if err != nil {
+		return "", fmt.Errorf("could not POST %s: while parsing JSON response body: %w", a.TokenURL.String(), err)
+	}
+	if data.Token == "" {
+		return "", fmt.Errorf("could not POST %s: no token in response", a.TokenURL.String())
+	}
+	logg.Debug("obtained installation access token for GitHub App %d (expires at %s)", a.AppID, data.ExpiresAt.Format(time.RFC3339))
+	a.token, a.expiresAt = data.Token, data.ExpiresAt
+	return a.token, nil
+}
+
+// makeJWT returns a JSON Web Token that authenticates as the GitHub App itself.
+// This is only used to obtain installation access tokens.
+func (a *githubAppAuthenticator) makeJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	// (the issue time is backdated to allow for clock drift, as recommended by GitHub;
+	// the maximum lifetime is 10 minutes)
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestGithubAppAuthentication(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.ErrEqual(t, err, nil)
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	assert.ErrEqual(t, os.WriteFile(keyPath, keyPEM, 0o600), nil)
+
+	var (
+		mintedTokenCount int
+		authHeaders      []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/app/installations/42/access_tokens":
+			// check the JWT
+			jwt, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			parts := strings.Split(jwt, ".")
+			assert.Equal(t, len(parts), 3)
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			assert.ErrEqual(t, err, nil)
+			assert.ErrEqual(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature), nil)
+			claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+			assert.ErrEqual(t, err, nil)
+			var claims map[string]int64
+			assert.ErrEqual(t, json.Unmarshal(claimsJSON, &claims), nil)
+			assert.Equal(t, claims["iss"], int64(23))
+
+			// the second token is about to expire, so that a third one will be requested
+			mintedTokenCount++
+			expiresAt := time.Now().Add(time.Hour)
+			if mintedTokenCount == 2 {
+				expiresAt = time.Now().Add(time.Minute)
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token":"ghs_%d","expires_at":%q}`, mintedTokenCount, expiresAt.Format(time.RFC3339))
+		case "/api/v3/repos/sapcc/swift-http-import/releases":
+			authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+			w.Write([]byte(`[]`)) //nolint:errcheck // not relevant for this test
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// a token is required for GitHub Enterprise, but the app can be used instead
+	s := &GithubReleaseSource{githubRepository: githubRepository{URLString: server.URL + "/sapcc/swift-http-import"}}
+	assert.Equal(t, fmt.Sprint(s.Validate("source")), "[source.token (or source.app) is required for repositories hosted on GitHub Enterprise]")
+	s.App = &GithubAppConfiguration{ID: 23}
+	assert.Equal(t, fmt.Sprint(s.Validate("source")), "[missing value for source.app.private_key missing value for source.app.installation_id]")
+	s.App = &GithubAppConfiguration{ID: 23, PrivateKeyPath: keyPath, InstallationID: 42}
+	assert.Equal(t, len(s.Validate("source")), 0)
+	assert.ErrEqual(t, s.Connect(t.Context(), "source"), nil)
+
+	// installation tokens are reused until they are about to expire
+	for range 4 {
+		_, _, err := s.getReleases(t.Context(), nil)
+		assert.ErrEqual(t, err, nil)
+	}
+	assert.Equal(t, authHeaders, []string{"Bearer ghs_1", "Bearer ghs_1", "Bearer ghs_1", "Bearer ghs_1"})
+	s.appAuthenticator.expiresAt = time.Now()
+	for range 2 {
+		_, _, err := s.getReleases(t.Context(), nil)
+		assert.ErrEqual(t, err, nil)
+	}
+	assert.Equal(t, authHeaders[4:], []string{"Bearer ghs_2", "Bearer ghs_3"})
+}
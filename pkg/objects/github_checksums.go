@@ -0,0 +1,340 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/sapcc/go-bits/regexpext"
+	. "go.xyrillian.de/gg/option"
+
+	"github.com/sapcc/swift-http-import/pkg/util"
+)
+
+// GithubChecksumConfiguration contains the options for verifying release
+// assets against the checksum file that is published with each release.
+type GithubChecksumConfiguration struct {
+	FileNamePattern     Option[regexpext.BoundedRegexp] `yaml:"file_name_pattern"`
+	GPGSigningKeys      []string                        `yaml:"gpg_signing_keys"`
+	CosignPublicKeyPath string                          `yaml:"cosign_public_key"`
+
+	// Compiled configuration.
+	trustedKeys     util.GPGTrustSet `yaml:"-"`
+	cosignPublicKey crypto.PublicKey `yaml:"-"`
+	// identity changes when the set of trusted keys changes, to invalidate
+	// verification results from previous runs.
+	identity string `yaml:"-"`
+}
+
+// githubDefaultChecksumFileNamePattern matches the names of checksum files
+// that are commonly used (including the format used by GoReleaser).
+const githubDefaultChecksumFileNamePattern = `(?i).*checksums\.txt|SHA(256|512)SUMS(\.txt)?`
+
+// Validate returns errors for invalid options.
+func (c *GithubChecksumConfiguration) Validate(name string) []error {
+	var err error
+	c.trustedKeys, err = util.ParseGPGTrustSet(c.GPGSigningKeys)
+	if err != nil {
+		return []error{fmt.Errorf("invalid value for %s.gpg_signing_keys: %w", name, err)}
+	}
+	return nil
+}
+
+// Helper function for GithubReleaseSource.Connect().
+func (c *GithubChecksumConfiguration) connect() error {
+	identity := sha256.New()
+	for _, key := range c.trustedKeys {
+		fmt.Fprintf(identity, "gpg:%s\n", key)
+	}
+	if c.CosignPublicKeyPath != "" {
+		buf, err := os.ReadFile(c.CosignPublicKeyPath)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(buf)
+		if block == nil {
+			return fmt.Errorf("no PEM block found in %s", c.CosignPublicKeyPath)
+		}
+		c.cosignPublicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("cannot parse public key in %s: %w", c.CosignPublicKeyPath, err)
+		}
+		fmt.Fprintf(identity, "cosign:%x\n", sha256.Sum256(block.Bytes))
+	}
+	c.identity = fmt.Sprintf("%x", identity.Sum(nil))
+	return nil
+}
+
+// requiresSignature returns whether the checksum file must be signed.
+func (c *GithubChecksumConfiguration) requiresSignature() bool {
+	return len(c.trustedKeys) > 0 || c.cosignPublicKey != nil
+}
+
+// githubReleaseChecksums contains the verified contents of the checksum file
+// of a release. The checksum files of previous runs are cached in the target
+// (see type githubCache) to avoid downloading them again in every run.
+type githubReleaseChecksums struct {
+	FileName     string              `json:"file_name"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	VerifiedWith string              `json:"verified_with"`
+	Checksums    map[string]Checksum `json:"checksums"`
+}
+
+// isChecksumFile returns whether the given asset is the checksum file, or a
+// signature or certificate for it (e.g. "checksums.txt.sig").
+func (c githubReleaseChecksums) isChecksumFile(assetName string) bool {
+	return c.FileName != "" && (assetName == c.FileName || strings.HasPrefix(assetName, c.FileName+"."))
+}
+
+// Helper function for GithubReleaseSource.ListAllFiles().
+//
+// Finds, verifies and parses the checksum file of the given release. The
+// result is stored in `next`, and reused from `previous` if the checksum file
+// has not changed since then.
+func (s *GithubReleaseSource) getReleaseChecksums(ctx context.Context, r githubRelease, previous, next map[string]githubReleaseChecksums) (githubReleaseChecksums, error) {
+	c := s.VerifyChecksums
+	rx := c.FileNamePattern.UnwrapOr(githubDefaultChecksumFileNamePattern)
+	idx := slices.IndexFunc(r.Assets, func(a githubAsset) bool { return rx.MatchString(a.Name) })
+	if idx == -1 {
+		return githubReleaseChecksums{}, errors.New("no checksum file found")
+	}
+	checksumAsset := r.Assets[idx]
+
+	cached, exists := previous[checksumAsset.DownloadURL]
+	if exists && cached.UpdatedAt.Equal(checksumAsset.UpdatedAt) && cached.VerifiedWith == c.identity {
+		next[checksumAsset.DownloadURL] = cached
+		return cached, nil
+	}
+
+	contents, err := s.downloadAsset(ctx, checksumAsset)
+	if err != nil {
+		return githubReleaseChecksums{}, err
+	}
+	contents, err = s.verifyChecksumFile(ctx, r, checksumAsset.Name, contents)
+	if err != nil {
+		return githubReleaseChecksums{}, fmt.Errorf("could not verify signature of %s: %w", checksumAsset.Name, err)
+	}
+	result := githubReleaseChecksums{
+		FileName:     checksumAsset.Name,
+		UpdatedAt:    checksumAsset.UpdatedAt,
+		VerifiedWith: c.identity,
+		Checksums:    parseChecksumFile(contents),
+	}
+	next[checksumAsset.DownloadURL] = result
+	return result, nil
+}
+
+// Helper function for GithubReleaseSource.getReleaseChecksums().
+//
+// If the checksum file is clear-signed, the signed part is returned.
+// Otherwise, the contents are returned unchanged. The clear signature is only
+// accepted if GPG keys are configured; otherwise a clear-signed checksum file
+// needs a detached signature like any other checksum file (unless no
+// signature is required at all).
+func (s *GithubReleaseSource) verifyChecksumFile(ctx context.Context, r githubRelease, fileName string, contents []byte) ([]byte, error) {
+	c := s.VerifyChecksums
+	isClearSigned := bytes.HasPrefix(contents, []byte("-----BEGIN PGP SIGNED MESSAGE-----"))
+	verified := func() ([]byte, error) {
+		if !isClearSigned {
+			return contents, nil
+		}
+		block, _ := clearsign.Decode(contents)
+		if block == nil {
+			return nil, errors.New("malformed clear-signed message")
+		}
+		return block.Plaintext, nil
+	}
+
+	switch {
+	case isClearSigned && len(c.trustedKeys) > 0:
+		return s.gpgKeyRing.VerifyClearSignedGPGSignatureFrom(ctx, c.trustedKeys, contents)
+	case !c.requiresSignature():
+		return verified()
+	}
+
+	// try all signature files that can be verified with the configured keys
+	// until one of them is valid
+	var errs []string
+	for _, a := range r.Assets {
+		extension, ok := strings.CutPrefix(a.Name, fileName)
+		if !ok {
+			continue
+		}
+		isGPGSignature := len(c.trustedKeys) > 0 && slices.Contains([]string{".asc", ".sig", ".gpg"}, extension)
+		isCosignSignature := c.cosignPublicKey != nil && slices.Contains([]string{".sig", ".bundle", ".sigstore.json"}, extension)
+		if !isGPGSignature && !isCosignSignature {
+			continue
+		}
+
+		signature, err := s.downloadAsset(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		if isGPGSignature {
+			err = s.gpgKeyRing.VerifyDetachedGPGSignatureFrom(ctx, c.trustedKeys, bytes.NewReader(contents), signature)
+			if err == nil {
+				return verified()
+			}
+			errs = append(errs, fmt.Sprintf("%s: %s", a.Name, err.Error()))
+		}
+		if isCosignSignature {
+			err = verifyCosignSignature(c.cosignPublicKey, contents, signature, extension != ".sig")
+			if err == nil {
+				return verified()
+			}
+			errs = append(errs, fmt.Sprintf("%s: %s", a.Name, err.Error()))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no signature found")
+	}
+	return nil, fmt.Errorf("no valid signature by a trusted key: %s", strings.Join(errs, "; "))
+}
+
+// Helper function for GithubReleaseSource.getReleaseChecksums().
+func (s *GithubReleaseSource) downloadAsset(ctx context.Context, a githubAsset) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.DownloadURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request for %s: %w", a.DownloadURL, err)
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	resp, err := s.doRequest(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not GET %s: %w", a.DownloadURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not GET %s: expected 200 OK, but got %s", a.DownloadURL, resp.Status)
+	}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not GET %s: %w", a.DownloadURL, err)
+	}
+	return buf, nil
+}
+
+// verifyCosignSignature verifies a signature that was made with `cosign
+// sign-blob` using a key pair. The signature is either base64-encoded (as in a
+// `.sig` file) or contained in a bundle. Transparency log entries in bundles
+// are not verified, and neither are keyless signatures.
+func verifyCosignSignature(publicKey crypto.PublicKey, message, signature []byte, isBundle bool) error {
+	if isBundle {
+		// both the legacy bundle format of `cosign sign-blob --bundle` and the
+		// Sigstore bundle format are supported
+		var bundle struct {
+			Base64Signature  string `json:"base64Signature"`
+			MessageSignature struct {
+				Signature string `json:"signature"`
+			} `json:"messageSignature"`
+		}
+		err := json.Unmarshal(signature, &bundle)
+		if err != nil {
+			return fmt.Errorf("malformed bundle: %w", err)
+		}
+		switch {
+		case bundle.Base64Signature != "":
+			signature = []byte(bundle.Base64Signature)
+		case bundle.MessageSignature.Signature != "":
+			signature = []byte(bundle.MessageSignature.Signature)
+		default:
+			return errors.New("bundle does not contain a message signature")
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+
+	var isValid bool
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch key.Curve {
+		case elliptic.P384():
+			digest = new(sha512.Sum384(message))[:]
+		case elliptic.P521():
+			digest = new(sha512.Sum512(message))[:]
+		default:
+			digest = new(sha256.Sum256(message))[:]
+		}
+		isValid = ecdsa.VerifyASN1(key, digest, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		isValid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		isValid = ed25519.Verify(key, message, signature)
+	default:
+		return fmt.Errorf("unsupported public key type: %T", publicKey)
+	}
+	if !isValid {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// checksumFileLineRx matches a line in a checksum file in the BSD format, e.g.
+// "SHA256 (example.tar.gz) = 0123...".
+var checksumFileLineRx = regexp.MustCompile(`^(SHA256|SHA512) \((.+)\) = ([0-9a-fA-F]+)$`)
+
+// parseChecksumFile parses a checksum file in the format of sha256sum (or
+// sha512sum), or in the BSD format. Only SHA-256 and SHA-512 checksums are
+// accepted, and lines that cannot be parsed are ignored. File names are
+// reduced to their basename, since the checksum file may refer to the
+// directory in which the assets were built.
+func parseChecksumFile(contents []byte) map[string]Checksum {
+	result := make(map[string]Checksum)
+	for line := range strings.Lines(string(contents)) {
+		line = strings.TrimSpace(line)
+		var fileName string
+		var checksum Checksum
+		if match := checksumFileLineRx.FindStringSubmatch(line); match != nil {
+			fileName = match[2]
+			checksum = Checksum{Algorithm: strings.ToLower(match[1]), Value: strings.ToLower(match[3])}
+		} else {
+			value, rest, ok := strings.Cut(line, " ")
+			if !ok {
+				continue
+			}
+			// (a "*" in front of the file name indicates binary mode)
+			fileName = strings.TrimPrefix(strings.TrimLeft(rest, " "), "*")
+			switch len(value) {
+			case sha256.Size * 2:
+				checksum = Checksum{Algorithm: "sha256", Value: strings.ToLower(value)}
+			case sha512.Size * 2:
+				checksum = Checksum{Algorithm: "sha512", Value: strings.ToLower(value)}
+			default:
+				continue
+			}
+		}
+		if fileName == "" {
+			continue
+		}
+		result[path.Base(fileName)] = checksum
+	}
+	return result
+}
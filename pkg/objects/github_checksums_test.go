@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"go.xyrillian.de/gg/assert"
+
+	"github.com/sapcc/swift-http-import/pkg/util"
+)
+
+func TestParseChecksumFile(t *testing.T) {
+	sha256sum := strings.Repeat("ab", 32)
+	sha512sum := strings.Repeat("CD", 64)
+	contents := strings.Join([]string{
+		sha256sum + "  tool-linux-amd64.tar.gz",
+		sha256sum + " *dist/tool-linux-arm64.tar.gz",
+		sha512sum + "  tool.zip",
+		"SHA256 (tool.deb) = " + sha256sum,
+		strings.Repeat("ef", 16) + "  tool.rpm", // MD5 is not accepted
+		"# this is a comment",
+		"",
+	}, "\n")
+
+	assert.Equal(t, parseChecksumFile([]byte(contents)), map[string]Checksum{
+		"tool-linux-amd64.tar.gz": {Algorithm: "sha256", Value: sha256sum},
+		"tool-linux-arm64.tar.gz": {Algorithm: "sha256", Value: sha256sum},
+		"tool.zip":                {Algorithm: "sha512", Value: strings.ToLower(sha512sum)},
+		"tool.deb":                {Algorithm: "sha256", Value: sha256sum},
+	})
+}
+
+func TestGithubChecksumVerification(t *testing.T) {
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	assert.ErrEqual(t, err, nil)
+	fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+	cosignKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.ErrEqual(t, err, nil)
+	cosignKeyDER, err := x509.MarshalPKIXPublicKey(&cosignKey.PublicKey)
+	assert.ErrEqual(t, err, nil)
+	cosignKeyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	assert.ErrEqual(t, os.WriteFile(cosignKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: cosignKeyDER}), 0o600), nil)
+
+	gpgSign := func(message string) string {
+		var buf bytes.Buffer
+		assert.ErrEqual(t, openpgp.ArmoredDetachSign(&buf, entity, strings.NewReader(message), nil), nil)
+		return buf.String()
+	}
+	cosignSign := func(message string) string {
+		digest := sha256.Sum256([]byte(message))
+		signature, err := ecdsa.SignASN1(rand.Reader, cosignKey, digest[:])
+		assert.ErrEqual(t, err, nil)
+		return base64.StdEncoding.EncodeToString(signature)
+	}
+	cosignBundle := func(message string) string {
+		buf, err := json.Marshal(map[string]any{
+			"mediaType":        "application/vnd.dev.sigstore.bundle.v0.3+json",
+			"messageSignature": map[string]any{"signature": cosignSign(message)},
+		})
+		assert.ErrEqual(t, err, nil)
+		return string(buf)
+	}
+	checksumFile := func(assets map[string]string, names ...string) string {
+		var lines []string
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("%x  %s", sha256.Sum256([]byte(assets[name])), name))
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	// each release is signed in a different way
+	type release struct {
+		TagName string
+		Assets  map[string]string
+	}
+	releases := []release{
+		{"v4.0.0", map[string]string{"tool.tar.gz": "v4", "sbom.json": "{}"}},
+		{"v3.0.0", map[string]string{"tool.tar.gz": "v3"}},
+		{"v2.0.0", map[string]string{"tool.tar.gz": "v2"}},
+		{"v1.0.0", map[string]string{"tool.tar.gz": "v1"}},
+	}
+	v4 := releases[0].Assets
+	v4["checksums.txt"] = checksumFile(v4, "tool.tar.gz")
+	v4["checksums.txt.asc"] = gpgSign(v4["checksums.txt"])
+	v3 := releases[1].Assets
+	v3["SHA256SUMS"] = checksumFile(v3, "tool.tar.gz")
+	v3["SHA256SUMS.bundle"] = cosignBundle(v3["SHA256SUMS"])
+	v2 := releases[2].Assets
+	v2["checksums.txt"] = checksumFile(v2, "tool.tar.gz")
+	v2["checksums.txt.sig"] = cosignSign("something else")
+
+	downloadCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/repos/sapcc/swift-http-import/releases" {
+			var data []map[string]any
+			for _, rel := range releases {
+				var assets []map[string]any
+				for name := range rel.Assets {
+					assets = append(assets, map[string]any{
+						"name":       name,
+						"url":        fmt.Sprintf("http://%s/download/%s/%s", r.Host, rel.TagName, name),
+						"updated_at": "2026-10-01T00:00:00Z",
+					})
+				}
+				data = append(data, map[string]any{"tag_name": rel.TagName, "published_at": "2026-10-01T00:00:00Z", "assets": assets})
+			}
+			buf, err := json.Marshal(data)
+			assert.ErrEqual(t, err, nil)
+			w.Write(buf) //nolint:errcheck // not relevant for this test
+			return
+		}
+
+		for _, rel := range releases {
+			for name, contents := range rel.Assets {
+				if r.URL.Path == fmt.Sprintf("/download/%s/%s", rel.TagName, name) {
+					downloadCount++
+					w.Write([]byte(contents)) //nolint:errcheck // not relevant for this test
+					return
+				}
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	s := &GithubReleaseSource{
+		githubRepository: githubRepository{URLString: server.URL + "/sapcc/swift-http-import", Token: "secret"},
+		VerifyChecksums: &GithubChecksumConfiguration{
+			GPGSigningKeys:      []string{fingerprint},
+			CosignPublicKeyPath: cosignKeyPath,
+		},
+		gpgKeyRing: &util.GPGKeyRing{EntityList: openpgp.EntityList{entity}},
+	}
+	assert.Equal(t, len(s.Validate("source")), 0)
+	assert.ErrEqual(t, s.Connect(t.Context(), "source"), nil)
+
+	out := make(chan FileSpec, 100)
+	lerr := s.ListAllFiles(t.Context(), out)
+	close(out)
+	if lerr != nil {
+		t.Fatalf("%s: %s: %v", lerr.Location, lerr.Message, lerr.Inner)
+	}
+	var actual []string
+	var cacheFile FileSpec
+	for fs := range out {
+		switch {
+		case fs.Path == githubCachePath:
+			cacheFile = fs
+			continue
+		case fs.RefuseTransfer:
+			actual = append(actual, fs.Path+" (refused)")
+		case fs.ExpectedChecksum != nil:
+			actual = append(actual, fs.Path+" "+fs.ExpectedChecksum.String())
+		default:
+			actual = append(actual, fs.Path)
+		}
+	}
+	slices.Sort(actual)
+	assert.Equal(t, actual, []string{
+		// no checksum file
+		"v1.0.0/tool.tar.gz (refused)",
+		// invalid signature
+		"v2.0.0/checksums.txt (refused)",
+		"v2.0.0/checksums.txt.sig (refused)",
+		"v2.0.0/tool.tar.gz (refused)",
+		// valid cosign bundle
+		"v3.0.0/SHA256SUMS",
+		"v3.0.0/SHA256SUMS.bundle",
+		fmt.Sprintf("v3.0.0/tool.tar.gz sha256:%x", sha256.Sum256([]byte("v3"))),
+		// valid GPG signature, but not all assets are listed
+		"v4.0.0/checksums.txt",
+		"v4.0.0/checksums.txt.asc",
+		"v4.0.0/sbom.json (refused)",
+		fmt.Sprintf("v4.0.0/tool.tar.gz sha256:%x", sha256.Sum256([]byte("v4"))),
+	})
+
+	// verified checksum files are not downloaded again in the next run
+	var cache githubCache
+	assert.ErrEqual(t, json.Unmarshal(cacheFile.Contents, &cache), nil)
+	assert.Equal(t, len(cache.Checksums), 2)
+	downloadCount = 0
+	next := make(map[string]githubReleaseChecksums)
+	for _, r := range cache.Pages[s.releaseEndpointURL.String()].Releases {
+		_, err := s.getReleaseChecksums(t.Context(), r, cache.Checksums, next)
+		if r.TagName == "v3.0.0" || r.TagName == "v4.0.0" {
+			assert.ErrEqual(t, err, nil)
+		}
+	}
+	assert.Equal(t, next, cache.Checksums)
+	assert.Equal(t, downloadCount, 2) // only for v2.0.0 (and v1.0.0 has no checksum file)
+
+	// when the trusted keys change, checksum files are verified again
+	s.VerifyChecksums.GPGSigningKeys = []string{strings.Repeat("0", 40)}
+	assert.Equal(t, len(s.Validate("source")), 0)
+	assert.ErrEqual(t, s.Connect(t.Context(), "source"), nil)
+	var v4Release githubRelease
+	for _, r := range cache.Pages[s.releaseEndpointURL.String()].Releases {
+		if r.TagName == "v4.0.0" {
+			v4Release = r
+		}
+	}
+	_, err = s.getReleaseChecksums(t.Context(), v4Release, cache.Checksums, next)
+	assert.ErrEqual(t, err, "could not verify signature of checksums.txt: no valid signature by a trusted key: checksums.txt.asc: signed by untrusted key "+fingerprint)
+
+	// when only a cosign key is configured, a clear-signed checksum file needs a
+	// cosign signature like any other checksum file
+	var clearSigned bytes.Buffer
+	w, err := clearsign.Encode(&clearSigned, entity.PrivateKey, nil)
+	assert.ErrEqual(t, err, nil)
+	_, err = w.Write([]byte(checksumFile(v4, "tool.tar.gz")))
+	assert.ErrEqual(t, err, nil)
+	assert.ErrEqual(t, w.Close(), nil)
+	s.VerifyChecksums.GPGSigningKeys = nil
+	assert.Equal(t, len(s.Validate("source")), 0)
+	assert.ErrEqual(t, s.Connect(t.Context(), "source"), nil)
+	clearSignedRelease := githubRelease{TagName: "v5.0.0", Assets: []githubAsset{{Name: "checksums.txt"}}}
+	_, err = s.verifyChecksumFile(t.Context(), clearSignedRelease, "checksums.txt", clearSigned.Bytes())
+	assert.ErrEqual(t, err, "no signature found")
+
+	releases = append(releases, release{"v5.0.0", map[string]string{"checksums.txt.sig": cosignSign(clearSigned.String())}})
+	clearSignedRelease.Assets = append(clearSignedRelease.Assets, githubAsset{
+		Name:        "checksums.txt.sig",
+		DownloadURL: server.URL + "/download/v5.0.0/checksums.txt.sig",
+	})
+	contents, err := s.verifyChecksumFile(t.Context(), clearSignedRelease, "checksums.txt", clearSigned.Bytes())
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, string(contents), checksumFile(v4, "tool.tar.gz"))
+}
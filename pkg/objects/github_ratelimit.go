@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errGithubRateLimited is returned by githubRepository.doRequest() when the
+// API rate limit is exceeded, and resets too late to wait for it.
+var errGithubRateLimited = errors.New("GitHub API rate limit exceeded")
+
+// githubRateLimitState holds the lowest remaining API quota that was reported
+// by GitHub during this run.
+var githubRateLimitState struct {
+	sync.Mutex
+	remaining uint64
+	isKnown   bool
+}
+
+// GithubRateLimitRemaining returns the lowest number of remaining API requests
+// that GitHub reported during this run (in the X-RateLimit-Remaining header),
+// or false if there were no requests to the GitHub API. Since each token has
+// its own quota, this reports the token that is closest to its rate limit.
+func GithubRateLimitRemaining() (uint64, bool) {
+	githubRateLimitState.Lock()
+	defer githubRateLimitState.Unlock()
+	return githubRateLimitState.remaining, githubRateLimitState.isKnown
+}
+
+// Helper function for githubRepository.doRequest().
+func observeGithubRateLimit(hdr http.Header) {
+	remaining, err := strconv.ParseUint(hdr.Get("X-Ratelimit-Remaining"), 10, 64)
+	if err != nil {
+		return
+	}
+	githubRateLimitState.Lock()
+	defer githubRateLimitState.Unlock()
+	if !githubRateLimitState.isKnown || remaining < githubRateLimitState.remaining {
+		githubRateLimitState.remaining = remaining
+		githubRateLimitState.isKnown = true
+	}
+}
+
+// githubRateLimitDelay returns how long to wait before retrying a request that
+// produced the given response, or false if the response does not indicate
+// that a rate limit was exceeded.
+//
+// Reference: <https://docs.github.com/en/rest/using-the-rest-api/best-practices-for-using-the-rest-api#handle-rate-limit-errors-appropriately>
+func githubRateLimitDelay(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	// secondary rate limits are reported with a Retry-After header
+	if seconds, err := strconv.ParseUint(resp.Header.Get("Retry-After"), 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	// the primary rate limit resets at the given time
+	if resp.Header.Get("X-Ratelimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-Ratelimit-Reset"), 10, 64)
+		if err != nil {
+			return time.Minute, true
+		}
+		// (plus one second to avoid running into the limit again because of clock skew)
+		return max(time.Unix(reset, 0).Sub(now)+time.Second, 0), true
+	}
+
+	// other 403 responses are actual permission errors, but 429 responses
+	// always refer to a secondary rate limit (for which the docs recommend
+	// waiting for at least one minute)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return time.Minute, true
+	}
+	return 0, false
+}
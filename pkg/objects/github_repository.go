@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sapcc/go-api-declarations/bininfo"
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/secrets"
+	"go.xyrillian.de/schwift/v2"
+
+	"github.com/sapcc/swift-http-import/pkg/util"
+)
+
+// githubRepository contains the options and behavior that are shared by all
+// sources that use the GitHub API (GithubReleaseSource and GithubTagSource):
+// locating the repository, authentication and handling of rate limits.
+type githubRepository struct {
+	// Options from config file.
+	URLString        string                  `yaml:"url"`
+	Token            secrets.FromEnv         `yaml:"token"`
+	App              *GithubAppConfiguration `yaml:"app"`
+	RateLimitMaxWait *AgeSpec                `yaml:"rate_limit_max_wait"`
+
+	// Compiled configuration.
+	repoURL          *url.URL                `yaml:"-"`
+	ownerName        string                  `yaml:"-"`
+	repoName         string                  `yaml:"-"`
+	apiBaseURL       *url.URL                `yaml:"-"`
+	appAuthenticator *githubAppAuthenticator `yaml:"-"`
+	rateLimitMaxWait time.Duration           `yaml:"-"`
+}
+
+// githubRepoRx is used to extract repository owner and name from a url.URL.Path field.
+//
+// Example:
+//
+//	Input: /sapcc/swift-http-import
+//	Match groups: ["sapcc", "swift-http-import"]
+var githubRepoRx = regexp.MustCompile(`^/([^\s/]+)/([^\s/]+)/?$`)
+
+// Helper function for the Validate() method of GitHub sources.
+func (s *githubRepository) validate(name string) []error {
+	var err error
+	s.repoURL, err = url.Parse(s.URLString)
+	if err != nil {
+		return []error{fmt.Errorf("could not parse %s.url: %w", name, err)}
+	}
+
+	// validate s.repoURL
+	errInvalidURL := fmt.Errorf("invalid value for %s.url: expected a url in the format %q, got: %q",
+		name, "http(s)://<hostname>/<owner>/<repo>", s.URLString)
+	if s.repoURL.Scheme != "http" && s.repoURL.Scheme != "https" {
+		return []error{errInvalidURL}
+	}
+	if s.repoURL.RawQuery != "" || s.repoURL.Fragment != "" {
+		return []error{errInvalidURL}
+	}
+	match := githubRepoRx.FindStringSubmatch(s.repoURL.Path)
+	if match == nil {
+		return []error{errInvalidURL}
+	}
+	s.ownerName, s.repoName = match[1], match[2]
+
+	// derive apiBaseURL from s.repoURL
+	if s.repoURL.Hostname() == "github.com" {
+		s.apiBaseURL, err = url.Parse("https://api.github.com/")
+		if err != nil {
+			return []error{fmt.Errorf("could not build apiBaseURL: %w", err)}
+		}
+	} else {
+		repoURLCloned := *s.repoURL
+		repoURLCloned.Path = "/api/v3/"
+		repoURLCloned.RawPath = "/api/v3/"
+		s.apiBaseURL = &repoURLCloned
+	}
+
+	s.rateLimitMaxWait = 5 * time.Minute
+	if s.RateLimitMaxWait != nil {
+		s.rateLimitMaxWait = time.Duration(*s.RateLimitMaxWait)
+	}
+
+	// validate s.Token and s.App
+	if s.App != nil {
+		if s.Token != "" {
+			return []error{fmt.Errorf("invalid value for %s.token: cannot be combined with %s.app", name, name)}
+		}
+		return s.App.Validate(name + ".app")
+	}
+	if s.repoURL.Hostname() != "github.com" {
+		if s.Token == "" {
+			return []error{fmt.Errorf("%s.token (or %s.app) is required for repositories hosted on GitHub Enterprise", name, name)}
+		}
+	}
+
+	return nil
+}
+
+// Helper function for the Connect() method of GitHub sources.
+func (s *githubRepository) connect(name string) error {
+	if s.App != nil {
+		var err error
+		s.appAuthenticator, err = newGithubAppAuthenticator(*s.App, s.apiBaseURL)
+		if err != nil {
+			return fmt.Errorf("cannot load private key for %s.app: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// endpointURL returns the URL of an API endpoint below this repository,
+// e.g. endpointURL("releases") for "/repos/<owner>/<repo>/releases".
+func (s *githubRepository) endpointURL(endpointPath string) (*url.URL, error) {
+	u, err := s.apiBaseURL.Parse(fmt.Sprintf("repos/%s/%s/%s", s.ownerName, s.repoName, endpointPath))
+	if err != nil {
+		return nil, fmt.Errorf("could not build URL for %s of %s: %w", endpointPath, s.repoURL.String(), err)
+	}
+	return u, nil
+}
+
+// ListEntries implements the Source interface.
+func (s *githubRepository) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+const (
+	githubHeaderAPIVersion  = "X-Github-Api-Version"
+	githubDefaultAPIVersion = "2022-11-28"
+	githubMediaType         = "application/vnd.github.v3+json"
+)
+
+// GetFile implements the Source interface.
+func (s *githubRepository) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (io.ReadCloser, FileState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, http.NoBody)
+	if err != nil {
+		return nil, FileState{}, fmt.Errorf("skipping: could not create request for %s: %w", path, err)
+	}
+	for key, val := range requestHeaders.Headers {
+		req.Header.Set(key, val)
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+
+	resp, err := s.doRequest(ctx, req)
+	if err != nil {
+		return nil, FileState{}, fmt.Errorf("skipping %s: GET failed: %w", req.URL.String(), err)
+	}
+
+	if resp.StatusCode != http.StatusOK &&
+		resp.StatusCode != http.StatusNotModified {
+		return nil, FileState{}, fmt.Errorf(
+			"skipping %s: GET returned unexpected status code: expected 200 or 304, but got %d",
+			req.URL.String(), resp.StatusCode,
+		)
+	}
+
+	var sizeBytes *uint64
+	if resp.ContentLength < 0 {
+		sizeBytes = nil
+	} else {
+		sizeBytes = new(util.AtLeastZero(resp.ContentLength))
+	}
+
+	return resp.Body, FileState{
+		Etag:         resp.Header.Get("Etag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SizeBytes:    sizeBytes,
+		ExpiryTime:   nil, // no way to get this information via HTTP only
+		SkipTransfer: resp.StatusCode == http.StatusNotModified,
+		ContentType:  resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// doRequest executes a request against the GitHub API (or an asset download).
+// If the API rate limit is exceeded, the request is retried once the rate
+// limit resets, unless that takes longer than `rate_limit_max_wait`.
+func (s *githubRepository) doRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req.Header.Set(githubHeaderAPIVersion, githubDefaultAPIVersion)
+	req.Header.Set("User-Agent", "swift-http-import/"+bininfo.VersionOr("dev"))
+	switch {
+	case s.appAuthenticator != nil:
+		token, err := s.appAuthenticator.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case s.Token != "":
+		req.Header.Set("Authorization", "Bearer "+string(s.Token))
+	}
+
+	for {
+		// We use http.DefaultClient explicitly instead of retrieving (s.client.Client()) the
+		// same http.Client that was passed to github.Client because that http.Client, when
+		// obtained using oauth2.NewClient(), does not return all headers in the request
+		// response.
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		observeGithubRateLimit(resp.Header)
+		delay, isRateLimited := githubRateLimitDelay(resp, time.Now())
+		if !isRateLimited {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if delay > s.rateLimitMaxWait {
+			return nil, fmt.Errorf("%w (resets in %s)", errGithubRateLimited, delay.Round(time.Second))
+		}
+		logg.Info("GitHub API rate limit exceeded for %s, retrying in %s", s.repoURL.String(), delay.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// parseGithubNextPageLink extracts the URL of the next page from the Link
+// header of a paginated API response.
+func parseGithubNextPageLink(linkHeader string) string {
+	for link := range strings.SplitSeq(linkHeader, ",") {
+		href, metadata, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok {
+			continue
+		}
+		if strings.TrimSpace(metadata) != `rel="next"` {
+			continue
+		}
+
+		href, ok = strings.CutPrefix(href, "<")
+		if !ok {
+			continue
+		}
+		href, ok = strings.CutSuffix(href, ">")
+		if !ok {
+			continue
+		}
+		return href
+	}
+	return ""
+}
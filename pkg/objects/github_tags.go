@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/sapcc/go-bits/regexpext"
+	"go.xyrillian.de/schwift/v2"
+)
+
+// GithubTagSource is a Source that transfers the source archives of the tags
+// (and optionally, some branches) of a GitHub repository.
+type GithubTagSource struct {
+	githubRepository `yaml:",inline"`
+
+	// Options from config file.
+	TagNamePattern regexpext.PlainRegexp `yaml:"tag_name_pattern"`
+	Branches       []string              `yaml:"branches"`
+
+	// Compiled configuration.
+	tagEndpointURL *url.URL `yaml:"-"`
+}
+
+// Validate implements the Source interface.
+func (s *GithubTagSource) Validate(name string) []error {
+	errs := s.githubRepository.validate(name)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// (this sets the maximum page size to avoid exceeding the API rate limit)
+	var err error
+	s.tagEndpointURL, err = s.endpointURL("tags?per_page=100")
+	if err != nil {
+		return []error{err}
+	}
+
+	for idx, branch := range s.Branches {
+		if branch == "" {
+			errs = append(errs, fmt.Errorf("missing value for %s.branches[%d]", name, idx))
+		}
+	}
+	return errs
+}
+
+// Connect implements the Source interface.
+func (s *GithubTagSource) Connect(ctx context.Context, name string) error {
+	return s.githubRepository.connect(name)
+}
+
+// githubRef is a tag or branch, as returned by the tag and branch listing
+// endpoints of the GitHub API.
+type githubRef struct {
+	Name   string `json:"name"`
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// ListAllFiles implements the Source interface.
+func (s *GithubTagSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	refs, err := s.getRefs(ctx)
+	if err != nil {
+		message := "could not list tags"
+		if errors.Is(err, errGithubRateLimited) {
+			message = ErrMessageRateLimited
+		}
+		return &ListEntriesError{
+			Location: s.repoURL.String(),
+			Message:  message,
+			Inner:    err,
+		}
+	}
+
+	for _, ref := range refs {
+		// the archive is downloaded by commit SHA instead of by ref name, so that
+		// GetFile() knows which commit it refers to
+		downloadURL, err := s.endpointURL("tarball/" + ref.Commit.SHA)
+		if err != nil {
+			return &ListEntriesError{Location: s.repoURL.String(), Message: "could not build download URL", Inner: err}
+		}
+		out <- FileSpec{
+			Path:         fmt.Sprintf("%s/%s-%s.tar.gz", ref.Name, s.repoName, strings.ReplaceAll(ref.Name, "/", "-")),
+			DownloadPath: downloadURL.String(),
+		}
+	}
+	return nil
+}
+
+// Helper function for GithubTagSource.ListAllFiles().
+//
+// Returns the tags that match the tag_name_pattern, followed by the selected
+// branches.
+func (s *GithubTagSource) getRefs(ctx context.Context) ([]githubRef, error) {
+	var result []githubRef
+	endpointURLString := s.tagEndpointURL.String()
+	for endpointURLString != "" {
+		var tags []githubRef
+		nextURL, err := s.getJSON(ctx, endpointURLString, &tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if s.TagNamePattern.MatchString(tag.Name) {
+				result = append(result, tag)
+			}
+		}
+		endpointURLString = nextURL
+	}
+
+	for _, branchName := range s.Branches {
+		branchURL, err := s.endpointURL("branches/" + url.PathEscape(branchName))
+		if err != nil {
+			return nil, err
+		}
+		var branch githubRef
+		_, err = s.getJSON(ctx, branchURL.String(), &branch)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, branch)
+	}
+	return result, nil
+}
+
+// Helper function for GithubTagSource.getRefs().
+//
+// Returns the URL of the next page, if any.
+func (s *GithubTagSource) getJSON(ctx context.Context, endpointURLString string, data any) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURLString, http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("could not create request for %s: %w", endpointURLString, err)
+	}
+	req.Header.Set("Accept", githubMediaType)
+
+	resp, err := s.doRequest(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("could not GET %s: %w", endpointURLString, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var respBody string
+		buf, err := io.ReadAll(resp.Body)
+		if err == nil {
+			respBody = string(buf)
+		} else {
+			respBody = "could not read body: " + err.Error()
+		}
+		return "", fmt.Errorf("could not GET %s: expected 200 OK, but got %s (response was: %s)", endpointURLString, resp.Status, respBody)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(data)
+	if err != nil {
+		return "", fmt.Errorf("could not GET %s: while parsing JSON response body: %w", endpointURLString, err)
+	}
+	return parseGithubNextPageLink(resp.Header.Get("Link")), nil
+}
+
+// GetFile implements the Source interface.
+//
+// The commit SHA from the download URL is recorded in the object metadata
+// (as the source Etag), so the archive is only downloaded again when the tag
+// (or branch) refers to a different commit.
+func (s *GithubTagSource) GetFile(ctx context.Context, downloadURL string, requestHeaders schwift.ObjectHeaders) (io.ReadCloser, FileState, error) {
+	commitSHA := path.Base(downloadURL)
+	if requestHeaders.Get("If-None-Match") == commitSHA {
+		return nil, FileState{SkipTransfer: true}, nil
+	}
+
+	// (the archives are generated on request, so conditional requests are
+	// not useful and the other request headers are not passed on)
+	body, state, err := s.githubRepository.GetFile(ctx, downloadURL, schwift.NewObjectHeaders())
+	if err != nil {
+		return nil, FileState{}, err
+	}
+	state.Etag = commitSHA
+	state.LastModified = ""
+	return body, state, nil
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.xyrillian.de/gg/assert"
+	"go.xyrillian.de/schwift/v2"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGithubTagSource(t *testing.T) {
+	var tarballRequests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/repos/sapcc/swift-http-import/tags":
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?per_page=100&page=2>; rel="next"`, r.Host, r.URL.Path))
+				w.Write([]byte(`[{"name":"v1.1.0","commit":{"sha":"1111"}},{"name":"nightly","commit":{"sha":"2222"}}]`)) //nolint:errcheck // not relevant for this test
+			} else {
+				w.Write([]byte(`[{"name":"v1.0.0","commit":{"sha":"3333"}}]`)) //nolint:errcheck // not relevant for this test
+			}
+		case "/api/v3/repos/sapcc/swift-http-import/branches/stable/v1":
+			w.Write([]byte(`{"name":"stable/v1","commit":{"sha":"4444"}}`)) //nolint:errcheck // not relevant for this test
+		case "/api/v3/repos/sapcc/swift-http-import/tarball/1111":
+			tarballRequests = append(tarballRequests, r.URL.Path)
+			w.Write([]byte("archive contents")) //nolint:errcheck // not relevant for this test
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	config := fmt.Sprintf(`
+type: github-tags
+url: %s/sapcc/swift-http-import
+token: secret
+tag_name_pattern: '^v'
+branches: [ stable/v1 ]
+`, server.URL)
+	var u SourceUnmarshaler
+	assert.ErrEqual(t, yaml.Unmarshal([]byte(config), &u), nil)
+	s, ok := u.Source.(*GithubTagSource)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, len(s.Validate("source")), 0)
+	// the options of githubRepository are inlined
+	assert.Equal(t, string(s.Token), "secret")
+	assert.ErrEqual(t, s.Connect(t.Context(), "source"), nil)
+
+	// tags are listed from all pages, followed by the branches
+	out := make(chan FileSpec, 100)
+	lerr := s.ListAllFiles(t.Context(), out)
+	close(out)
+	if lerr != nil {
+		t.Fatalf("%s: %s: %v", lerr.Location, lerr.Message, lerr.Inner)
+	}
+	var actual []string
+	for fs := range out {
+		actual = append(actual, fs.Path+" <- "+fs.DownloadPath)
+	}
+	apiURL := server.URL + "/api/v3/repos/sapcc/swift-http-import"
+	assert.Equal(t, actual, []string{
+		"v1.1.0/swift-http-import-v1.1.0.tar.gz <- " + apiURL + "/tarball/1111",
+		"v1.0.0/swift-http-import-v1.0.0.tar.gz <- " + apiURL + "/tarball/3333",
+		"stable/v1/swift-http-import-stable-v1.tar.gz <- " + apiURL + "/tarball/4444",
+	})
+
+	// the commit SHA is recorded as the source Etag
+	body, state, err := s.GetFile(t.Context(), apiURL+"/tarball/1111", schwift.NewObjectHeaders())
+	assert.ErrEqual(t, err, nil)
+	buf, err := io.ReadAll(body)
+	assert.ErrEqual(t, err, nil)
+	assert.ErrEqual(t, body.Close(), nil)
+	assert.Equal(t, string(buf), "archive contents")
+	assert.Equal(t, state.Etag, "1111")
+	assert.Equal(t, len(tarballRequests), 1)
+
+	// when the commit SHA is already recorded, the archive is not downloaded again
+	hdr := schwift.NewObjectHeaders()
+	hdr.Set("If-None-Match", "1111")
+	body, state, err = s.GetFile(t.Context(), apiURL+"/tarball/1111", hdr)
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, body, nil)
+	assert.Equal(t, state.SkipTransfer, true)
+	assert.Equal(t, len(tarballRequests), 1)
+}
@@ -0,0 +1,282 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sapcc/go-bits/regexpext"
+	"go.xyrillian.de/gg/assert"
+	. "go.xyrillian.de/gg/option"
+)
+
+func TestGithubRateLimitDelay(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	check := func(status int, headers map[string]string, expectedDelay time.Duration, expectedOK bool) {
+		t.Helper()
+		resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+		for k, v := range headers {
+			resp.Header.Set(k, v)
+		}
+		delay, ok := githubRateLimitDelay(resp, now)
+		assert.Equal(t, delay, expectedDelay)
+		assert.Equal(t, ok, expectedOK)
+	}
+
+	// successful responses and actual permission errors are not rate limits
+	check(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "0"}, 0, false)
+	check(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "42"}, 0, false)
+
+	// primary rate limit
+	check(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1760000060"}, 61*time.Second, true)
+	check(http.StatusTooManyRequests, map[string]string{"X-RateLimit-Remaining": "0"}, time.Minute, true)
+
+	// secondary rate limits
+	check(http.StatusForbidden, map[string]string{"Retry-After": "30"}, 30*time.Second, true)
+	check(http.StatusTooManyRequests, nil, time.Minute, true)
+}
+
+func TestGithubReleasePages(t *testing.T) {
+	var (
+		requestCount   int
+		rateLimitCount int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page")) //nolint:errcheck // page 0 is the first page
+		etag := fmt.Sprintf(`"page-%d"`, page)
+
+		if rateLimitCount > 0 {
+			rateLimitCount--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(1000-requestCount))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Etag", etag)
+		if page == 0 {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=1>; rel="next", <%s%s?page=1>; rel="last"`, "http://"+r.Host, r.URL.Path, "http://"+r.Host, r.URL.Path))
+		}
+		fmt.Fprintf(w, `[{"tag_name":"v1.%d.0","published_at":"2026-10-01T00:00:00Z","assets":[{"url":"https://example.com/asset","name":"asset.tar.gz"}]}]`, 1-page)
+	}))
+	defer server.Close()
+
+	s := &GithubReleaseSource{githubRepository: githubRepository{URLString: server.URL + "/sapcc/swift-http-import", Token: "secret"}}
+	assert.Equal(t, len(s.Validate("source")), 0)
+
+	// first run: all pages are downloaded
+	releases, pages, err := s.getReleases(t.Context(), nil)
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, len(releases), 2)
+	assert.Equal(t, releases[1].TagName, "v1.0.0")
+	assert.Equal(t, len(pages), 2)
+	assert.Equal(t, requestCount, 2)
+
+	// second run: all pages are reused after a 304 response, even when the first
+	// attempt runs into a secondary rate limit
+	rateLimitCount = 1
+	releases2, pages2, err := s.getReleases(t.Context(), pages)
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, releases2, releases)
+	assert.Equal(t, pages2, pages)
+	assert.Equal(t, requestCount, 5)
+
+	remaining, ok := GithubRateLimitRemaining()
+	assert.Equal(t, ok, true)
+	assert.Equal(t, remaining <= 995, true)
+
+	// if the rate limit does not reset in time, the job is deferred
+	rateLimitCount = 1
+	s.rateLimitMaxWait = -1
+	_, _, err = s.getReleases(t.Context(), pages)
+	assert.Equal(t, errors.Is(err, errGithubRateLimited), true)
+}
+
+func TestGithubReleaseSelection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// releases are listed in order of creation, which need not match the order
+		// of publication or the order of versions
+		w.Write([]byte(`[
+			{"tag_name":"v1.10.0","published_at":"2026-10-01T00:00:00Z","assets":[{"url":"https://example.com/1","name":"tool-linux-amd64.tar.gz"},{"url":"https://example.com/2","name":"tool-linux-arm64.tar.gz"},{"url":"https://example.com/3","name":"tool-linux-amd64.tar.gz.sbom"}]},
+			{"tag_name":"v1.9.1","published_at":"2026-10-05T00:00:00Z","assets":[{"url":"https://example.com/4","name":"tool-linux-amd64.tar.gz"}]},
+			{"tag_name":"v1.11.0-rc.1","published_at":"2026-10-06T00:00:00Z","prerelease":true,"assets":[{"url":"https://example.com/5","name":"tool-linux-amd64.tar.gz"}]},
+			{"tag_name":"v1.9.0","published_at":"2026-09-01T00:00:00Z","assets":[{"url":"https://example.com/6","name":"tool-linux-amd64.tar.gz"}]},
+			{"tag_name":"nightly","published_at":"2026-10-07T00:00:00Z","assets":[{"url":"https://example.com/7","name":"tool-linux-amd64.tar.gz"}]}
+		]`)) //nolint:errcheck // not relevant for this test
+	}))
+	defer server.Close()
+
+	check := func(s *GithubReleaseSource, expected ...string) {
+		t.Helper()
+		s.URLString = server.URL + "/sapcc/swift-http-import"
+		s.Token = "secret"
+		assert.Equal(t, len(s.Validate("source")), 0)
+
+		out := make(chan FileSpec, 100)
+		lerr := s.ListAllFiles(t.Context(), out)
+		close(out)
+		if lerr != nil {
+			t.Fatalf("%s: %s: %v", lerr.Location, lerr.Message, lerr.Inner)
+		}
+		var actual []string
+		for fs := range out {
+			if fs.Path == githubCachePath {
+				continue
+			}
+			desc := fs.Path
+			if fs.SymlinkTargetPath != "" {
+				desc += " -> " + fs.SymlinkTargetPath
+			}
+			actual = append(actual, desc)
+		}
+		assert.Equal(t, actual, expected)
+	}
+
+	// by default, all assets of all releases are transferred (newest first)
+	check(&GithubReleaseSource{},
+		"nightly/tool-linux-amd64.tar.gz",
+		"v1.9.1/tool-linux-amd64.tar.gz",
+		"v1.10.0/tool-linux-amd64.tar.gz",
+		"v1.10.0/tool-linux-arm64.tar.gz",
+		"v1.10.0/tool-linux-amd64.tar.gz.sbom",
+		"v1.9.0/tool-linux-amd64.tar.gz",
+	)
+
+	// select the latest releases by publication date, and a subset of their assets
+	check(&GithubReleaseSource{
+		AssetNamePattern:        "linux-amd64",
+		ExcludeAssetNamePattern: Some[regexpext.PlainRegexp](`\.sbom$`),
+		TagNamePattern:          "^v",
+		LatestReleases:          2,
+		LatestAlias:             "latest",
+	},
+		"v1.9.1/tool-linux-amd64.tar.gz",
+		"latest/tool-linux-amd64.tar.gz -> v1.9.1/tool-linux-amd64.tar.gz",
+		"v1.10.0/tool-linux-amd64.tar.gz",
+	)
+
+	// select the latest releases by version (tags that are not semantic versions come last)
+	check(&GithubReleaseSource{
+		AssetNamePattern:  "linux-amd64.tar.gz$",
+		IncludePrerelease: true,
+		LatestReleases:    3,
+		OrderReleasesBy:   "semver",
+		LatestAlias:       "latest",
+	},
+		"v1.11.0-rc.1/tool-linux-amd64.tar.gz",
+		"latest/tool-linux-amd64.tar.gz -> v1.11.0-rc.1/tool-linux-amd64.tar.gz",
+		"v1.10.0/tool-linux-amd64.tar.gz",
+		"v1.9.1/tool-linux-amd64.tar.gz",
+	)
+
+	// invalid options
+	s := &GithubReleaseSource{githubRepository: githubRepository{URLString: server.URL + "/sapcc/swift-http-import", Token: "secret"}, OrderReleasesBy: "name", LatestAlias: "latest/stable"}
+	assert.Equal(t, fmt.Sprint(s.Validate("source")), `[invalid value for source.order_releases_by: expected "published_at" or "semver", got "name"]`)
+	s.OrderReleasesBy = ""
+	assert.Equal(t, fmt.Sprint(s.Validate("source")), `[invalid value for source.latest_alias: must be a single path element, got "latest/stable"]`)
+}
+
+func TestGithubReleaseMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{
+			"tag_name": "release/v1.0.0",
+			"name": "Version 1.0",
+			"body": "Initial release",
+			"html_url": "https://github.com/sapcc/swift-http-import/releases/tag/release/v1.0.0",
+			"published_at": "2026-10-01T00:00:00Z",
+			"tarball_url": "https://api.github.com/repos/sapcc/swift-http-import/tarball/release/v1.0.0",
+			"zipball_url": "https://api.github.com/repos/sapcc/swift-http-import/zipball/release/v1.0.0",
+			"author": {"login": "octocat"},
+			"assets": [
+				{"url":"https://example.com/1","name":"tool.tar.gz","size":42,"digest":"sha256:abcdef"},
+				{"url":"https://example.com/2","name":"tool.sbom","size":23,"digest":null},
+				{"url":"https://example.com/3","name":"tool.zip","size":17}
+			]
+		}]`)) //nolint:errcheck // not relevant for this test
+	}))
+	defer server.Close()
+
+	s := &GithubReleaseSource{
+		githubRepository:        githubRepository{URLString: server.URL + "/sapcc/swift-http-import", Token: "secret"},
+		ExcludeAssetNamePattern: Some[regexpext.PlainRegexp](`\.sbom$`),
+		LatestAlias:             "latest",
+		IncludeReleaseMetadata:  true,
+		IncludeSourceArchives:   true,
+	}
+	assert.Equal(t, len(s.Validate("source")), 0)
+
+	out := make(chan FileSpec, 100)
+	lerr := s.ListAllFiles(t.Context(), out)
+	close(out)
+	if lerr != nil {
+		t.Fatalf("%s: %s: %v", lerr.Location, lerr.Message, lerr.Inner)
+	}
+	files := make(map[string]FileSpec)
+	var paths []string
+	for fs := range out {
+		files[fs.Path] = fs
+		paths = append(paths, fs.Path)
+	}
+	assert.Equal(t, paths, []string{
+		"release/v1.0.0/tool.tar.gz",
+		"latest/tool.tar.gz",
+		"release/v1.0.0/tool.zip",
+		"latest/tool.zip",
+		"release/v1.0.0/swift-http-import-release-v1.0.0.tar.gz",
+		"latest/swift-http-import-release-v1.0.0.tar.gz",
+		"release/v1.0.0/swift-http-import-release-v1.0.0.zip",
+		"latest/swift-http-import-release-v1.0.0.zip",
+		"release/v1.0.0/release.json",
+		"latest/release.json",
+		githubCachePath,
+	})
+
+	// other objects below the alias are only removed once the run has completed
+	// without errors, so the paths that belong to the alias are remembered
+	assert.Equal(t, s.aliasPaths, map[string]bool{
+		"latest/tool.tar.gz": true,
+		"latest/tool.zip":    true,
+		"latest/swift-http-import-release-v1.0.0.tar.gz": true,
+		"latest/swift-http-import-release-v1.0.0.zip":    true,
+		"latest/release.json":                            true,
+	})
+
+	// source archives are only transferred once
+	archive := files["release/v1.0.0/swift-http-import-release-v1.0.0.tar.gz"]
+	assert.Equal(t, archive.DownloadPath, "https://api.github.com/repos/sapcc/swift-http-import/tarball/release/v1.0.0")
+	assert.Equal(t, archive.IsImmutable, true)
+
+	// release metadata only lists the transferred assets (and omits digests
+	// that GitHub does not report for older assets)
+	assert.Equal(t, files["latest/release.json"].SymlinkTargetPath, "release/v1.0.0/release.json")
+	assert.Equal(t, string(files["release/v1.0.0/release.json"].Contents), `{
+  "tag_name": "release/v1.0.0",
+  "name": "Version 1.0",
+  "body": "Initial release",
+  "author": "octocat",
+  "html_url": "https://github.com/sapcc/swift-http-import/releases/tag/release/v1.0.0",
+  "published_at": "2026-10-01T00:00:00Z",
+  "assets": [
+    {
+      "name": "tool.tar.gz",
+      "size": 42,
+      "digest": "sha256:abcdef"
+    },
+    {
+      "name": "tool.zip",
+      "size": 17
+    }
+  ]
+}`)
+}
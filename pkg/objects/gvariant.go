@@ -0,0 +1,278 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// This file contains a minimal reader for the GVariant serialization format
+// (as specified in <https://developer.gnome.org/documentation/specifications/gvariant-specification-1.0.html>),
+// which is used by OSTree for its metadata objects. Only the parts that are
+// required for walking OSTree repositories are implemented: container types
+// can be split into their members, and strings and byte strings can be read.
+// Maybe types are not supported.
+
+// gvariantType is a parsed GVariant type string.
+type gvariantType struct {
+	// the type character, e.g. 's' for string, 'a' for array, '(' for tuple,
+	// '{' for dictionary entry
+	Kind byte
+	// only set for arrays
+	Element *gvariantType
+	// only set for tuples and dictionary entries
+	Members []*gvariantType
+	// alignment in bytes
+	Alignment int
+	// 0 for variable-size types
+	FixedSize int
+}
+
+// mustParseGVariantType parses a GVariant type string. Since all type strings
+// are compile-time constants, invalid type strings cause a panic.
+func mustParseGVariantType(signature string) *gvariantType {
+	t, rest, err := parseGVariantType(signature)
+	if err == nil && rest != "" {
+		err = fmt.Errorf("trailing characters %q", rest)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("invalid GVariant type string %q: %s", signature, err.Error()))
+	}
+	return t
+}
+
+func parseGVariantType(signature string) (*gvariantType, string, error) {
+	if signature == "" {
+		return nil, "", errors.New("unexpected end of type string")
+	}
+	kind, rest := signature[0], signature[1:]
+
+	switch kind {
+	case 'b', 'y':
+		return &gvariantType{Kind: kind, Alignment: 1, FixedSize: 1}, rest, nil
+	case 'n', 'q':
+		return &gvariantType{Kind: kind, Alignment: 2, FixedSize: 2}, rest, nil
+	case 'i', 'u', 'h':
+		return &gvariantType{Kind: kind, Alignment: 4, FixedSize: 4}, rest, nil
+	case 'x', 't', 'd':
+		return &gvariantType{Kind: kind, Alignment: 8, FixedSize: 8}, rest, nil
+	case 's', 'o', 'g':
+		return &gvariantType{Kind: kind, Alignment: 1}, rest, nil
+	case 'v':
+		return &gvariantType{Kind: kind, Alignment: 8}, rest, nil
+	case 'a':
+		elem, rest, err := parseGVariantType(rest)
+		if err != nil {
+			return nil, "", err
+		}
+		return &gvariantType{Kind: kind, Element: elem, Alignment: elem.Alignment}, rest, nil
+	case '(', '{':
+		closing := byte(')')
+		if kind == '{' {
+			closing = '}'
+		}
+		t := &gvariantType{Kind: kind, Alignment: 1}
+		for rest != "" && rest[0] != closing {
+			var (
+				member *gvariantType
+				err    error
+			)
+			member, rest, err = parseGVariantType(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			t.Members = append(t.Members, member)
+			t.Alignment = max(t.Alignment, member.Alignment)
+		}
+		if rest == "" {
+			return nil, "", fmt.Errorf("missing %q", closing)
+		}
+		if kind == '{' && len(t.Members) != 2 {
+			return nil, "", errors.New("dictionary entry must have exactly two members")
+		}
+
+		// a tuple is fixed-size if all its members are fixed-size
+		size := 0
+		for _, member := range t.Members {
+			if member.FixedSize == 0 {
+				size = -1
+				break
+			}
+			size = alignGVariantOffset(size, member.Alignment) + member.FixedSize
+		}
+		switch {
+		case len(t.Members) == 0:
+			t.FixedSize = 1
+		case size > 0:
+			t.FixedSize = alignGVariantOffset(size, t.Alignment)
+		}
+		return t, rest[1:], nil
+	default:
+		return nil, "", fmt.Errorf("unsupported type character %q", kind)
+	}
+}
+
+func alignGVariantOffset(offset, alignment int) int {
+	return (offset + alignment - 1) / alignment * alignment
+}
+
+// gvariantValue is a serialized GVariant value.
+type gvariantValue struct {
+	Type *gvariantType
+	Data []byte
+}
+
+// String returns the value of a string-like value.
+func (v gvariantValue) String() (string, error) {
+	if v.Type.Kind != 's' && v.Type.Kind != 'o' && v.Type.Kind != 'g' {
+		return "", fmt.Errorf("expected string, but got type %q", v.Type.Kind)
+	}
+	if len(v.Data) == 0 || v.Data[len(v.Data)-1] != 0 {
+		return "", errors.New("string is not NUL-terminated")
+	}
+	return string(v.Data[:len(v.Data)-1]), nil
+}
+
+// Bytes returns the value of a byte string (type "ay").
+func (v gvariantValue) Bytes() ([]byte, error) {
+	if v.Type.Kind != 'a' || v.Type.Element.Kind != 'y' {
+		return nil, errors.New("expected byte string")
+	}
+	return v.Data, nil
+}
+
+// Children returns the members of a tuple or dictionary entry, or the
+// elements of an array.
+func (v gvariantValue) Children() ([]gvariantValue, error) {
+	switch v.Type.Kind {
+	case 'a':
+		return v.arrayElements()
+	case '(', '{':
+		return v.tupleMembers()
+	default:
+		return nil, fmt.Errorf("expected container, but got type %q", v.Type.Kind)
+	}
+}
+
+func (v gvariantValue) arrayElements() ([]gvariantValue, error) {
+	elem := v.Type.Element
+
+	// arrays of fixed-size elements are just the elements back-to-back
+	if elem.FixedSize > 0 {
+		if len(v.Data)%elem.FixedSize != 0 {
+			return nil, errors.New("array size is not a multiple of element size")
+		}
+		result := make([]gvariantValue, len(v.Data)/elem.FixedSize)
+		for idx := range result {
+			offset := idx * elem.FixedSize
+			result[idx] = gvariantValue{elem, v.Data[offset : offset+elem.FixedSize]}
+		}
+		return result, nil
+	}
+
+	// arrays of variable-size elements have a table of element end offsets at
+	// the end; the last offset marks the start of that table
+	if len(v.Data) == 0 {
+		return nil, nil
+	}
+	offsetSize := gvariantOffsetSize(len(v.Data))
+	tableStart, err := v.readOffset(len(v.Data)-offsetSize, offsetSize)
+	if err != nil {
+		return nil, err
+	}
+	if tableStart > len(v.Data) || (len(v.Data)-tableStart)%offsetSize != 0 {
+		return nil, errors.New("invalid framing offset in array")
+	}
+
+	count := (len(v.Data) - tableStart) / offsetSize
+	result := make([]gvariantValue, count)
+	start := 0
+	for idx := range count {
+		end, err := v.readOffset(tableStart+idx*offsetSize, offsetSize)
+		if err != nil {
+			return nil, err
+		}
+		start = alignGVariantOffset(start, elem.Alignment)
+		if start > end || end > tableStart {
+			return nil, errors.New("invalid framing offset in array")
+		}
+		result[idx] = gvariantValue{elem, v.Data[start:end]}
+		start = end
+	}
+	return result, nil
+}
+
+func (v gvariantValue) tupleMembers() ([]gvariantValue, error) {
+	// the end offsets of all variable-size members (except for the last
+	// member) are stored in reverse order at the end of the tuple
+	offsetSize := gvariantOffsetSize(len(v.Data))
+	tableEnd := len(v.Data)
+
+	result := make([]gvariantValue, len(v.Type.Members))
+	start := 0
+	for idx, member := range v.Type.Members {
+		start = alignGVariantOffset(start, member.Alignment)
+
+		var end int
+		switch {
+		case member.FixedSize > 0:
+			end = start + member.FixedSize
+		case idx == len(v.Type.Members)-1:
+			end = tableEnd
+		default:
+			var err error
+			tableEnd -= offsetSize
+			end, err = v.readOffset(tableEnd, offsetSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if start > end || end > tableEnd {
+			return nil, errors.New("invalid framing offset in tuple")
+		}
+		result[idx] = gvariantValue{member, v.Data[start:end]}
+		start = end
+	}
+	return result, nil
+}
+
+func (v gvariantValue) readOffset(position, offsetSize int) (int, error) {
+	if position < 0 || position+offsetSize > len(v.Data) {
+		return 0, errors.New("framing offset out of bounds")
+	}
+	buf := v.Data[position : position+offsetSize]
+	var offset uint64
+	switch offsetSize {
+	case 1:
+		offset = uint64(buf[0])
+	case 2:
+		offset = uint64(binary.LittleEndian.Uint16(buf))
+	case 4:
+		offset = uint64(binary.LittleEndian.Uint32(buf))
+	default:
+		offset = binary.LittleEndian.Uint64(buf)
+	}
+	if offset > uint64(len(v.Data)) {
+		return 0, errors.New("framing offset out of bounds")
+	}
+	return int(offset), nil
+}
+
+// gvariantOffsetSize returns the size of framing offsets in a container of
+// the given size.
+func gvariantOffsetSize(containerSize int) int {
+	switch {
+	case containerSize <= 0xFF:
+		return 1
+	case containerSize <= 0xFFFF:
+		return 2
+	case uint64(containerSize) <= 0xFFFFFFFF:
+		return 4
+	default:
+		return 8
+	}
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/sapcc/go-bits/must"
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestGVariantTypes(t *testing.T) {
+	assert.Equal(t, mustParseGVariantType("(ty)").FixedSize, 16)
+	assert.Equal(t, mustParseGVariantType("(yt)").FixedSize, 16)
+	assert.Equal(t, mustParseGVariantType("(yy)").FixedSize, 2)
+	assert.Equal(t, mustParseGVariantType("()").FixedSize, 1)
+	assert.Equal(t, mustParseGVariantType("(sy)").FixedSize, 0)
+	assert.Equal(t, mustParseGVariantType("a{sv}").Alignment, 8)
+}
+
+func TestGVariantDirTree(t *testing.T) {
+	checksum := bytes.Repeat([]byte{0xab}, 32)
+
+	// build a dirtree object with a single file "a" and no subdirectories
+	var file []byte
+	file = append(file, 'a', 0)      // name
+	file = append(file, checksum...) // checksum
+	file = append(file, 2)           // framing offset: end of name
+	var files []byte
+	files = append(files, file...)
+	files = append(files, byte(len(file))) // framing offset: end of first element
+	var dirtree []byte
+	dirtree = append(dirtree, files...)
+	dirtree = append(dirtree, byte(len(files))) // framing offset: end of files array
+
+	members := must.ReturnT(gvariantValue{ostreeDirTreeType, dirtree}.Children())(t)
+	assert.Equal(t, len(members), 2)
+
+	fileEntries := must.ReturnT(members[0].Children())(t)
+	assert.Equal(t, len(fileEntries), 1)
+	fields := must.ReturnT(fileEntries[0].Children())(t)
+	assert.Equal(t, must.ReturnT(fields[0].String())(t), "a")
+	assert.Equal(t, must.ReturnT(ostreeChecksumOf(fields[1]))(t), hex.EncodeToString(checksum))
+
+	dirEntries := must.ReturnT(members[1].Children())(t)
+	assert.Equal(t, len(dirEntries), 0)
+
+	// truncated objects must not cause a panic
+	for idx := range dirtree {
+		_, _ = gvariantValue{ostreeDirTreeType, dirtree[:idx]}.Children() //nolint:errcheck // only checking for panics
+	}
+}
+
+func TestParseOSTreeRepoMode(t *testing.T) {
+	assert.Equal(t, parseOSTreeRepoMode("[core]\nrepo_version=1\nmode=archive-z2\n"), "archive-z2")
+	assert.Equal(t, parseOSTreeRepoMode("[remote \"foo\"]\nmode=bare\n"), "")
+}
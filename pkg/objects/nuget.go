@@ -0,0 +1,482 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.xyrillian.de/schwift/v2"
+)
+
+// NuGetSource is a source containing a NuGet v3 feed. It uses the service
+// index of the feed to locate the registration and flat container resources,
+// downloads the .nupkg and .nuspec files for the configured packages from the
+// flat container, and writes them into the target in the same layout as a
+// static flat container.
+type NuGetSource struct {
+	// options from config file
+	URLString                string             `yaml:"url"`
+	ClientCertificatePath    string             `yaml:"cert"`
+	ClientCertificateKeyPath string             `yaml:"key"`
+	ServerCAPath             string             `yaml:"ca"`
+	Packages                 []NuGetPackageSpec `yaml:"packages"`
+	IncludePrerelease        bool               `yaml:"include_prerelease"`
+	IncludeUnlisted          bool               `yaml:"include_unlisted"`
+	PublicURLString          string             `yaml:"public_url"`
+	// compiled configuration
+	urlSource       *URLSource `yaml:"-"`
+	serviceIndexURL *url.URL   `yaml:"-"`
+}
+
+// NuGetPackageSpec appears in the NuGetSource configuration.
+type NuGetPackageSpec struct {
+	ID string `yaml:"id"`
+	// in NuGet's version range syntax, e.g. "[1.0,2.0)"; empty means all versions
+	VersionRangeString string            `yaml:"versions"`
+	versionRange       nugetVersionRange `yaml:"-"`
+}
+
+// Validate implements the Source interface.
+func (s *NuGetSource) Validate(name string) (errs []error) {
+	s.urlSource = &URLSource{
+		URLString:                s.URLString,
+		ClientCertificatePath:    s.ClientCertificatePath,
+		ClientCertificateKeyPath: s.ClientCertificateKeyPath,
+		ServerCAPath:             s.ServerCAPath,
+	}
+	// the service index URL refers to a file, not a directory, so the
+	// URLSource is rooted at the directory containing the service index
+	if s.URLString != "" {
+		serviceIndexURL, err := url.Parse(s.URLString)
+		if err == nil {
+			s.serviceIndexURL = serviceIndexURL
+			s.urlSource.URLString = serviceIndexURL.ResolveReference(&url.URL{Path: "./"}).String()
+		}
+	}
+	errs = s.urlSource.Validate(name)
+
+	if len(s.Packages) == 0 {
+		errs = append(errs, fmt.Errorf("missing value for %s.packages", name))
+	}
+	for idx := range s.Packages {
+		pkg := &s.Packages[idx]
+		if pkg.ID == "" {
+			errs = append(errs, fmt.Errorf("missing value for %s.packages[%d].id", name, idx))
+		}
+		var err error
+		pkg.versionRange, err = parseNuGetVersionRange(pkg.VersionRangeString)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %s.packages[%d].versions: %w", name, idx, err))
+		}
+	}
+
+	if s.PublicURLString != "" && !strings.HasSuffix(s.PublicURLString, "/") {
+		errs = append(errs, fmt.Errorf("invalid value for %s.public_url: must end with a slash", name))
+	}
+
+	return errs
+}
+
+// Connect implements the Source interface.
+func (s *NuGetSource) Connect(ctx context.Context, name string) error {
+	return s.urlSource.Connect(ctx, name)
+}
+
+// ListEntries implements the Source interface.
+func (s *NuGetSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+// GetFile implements the Source interface.
+func (s *NuGetSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	// all files are listed with a DownloadPath that is a full URL into the flat container
+	return s.urlSource.getFileFromURL(ctx, path, requestHeaders)
+}
+
+// Resource types in a NuGet service index, in order of preference.
+var (
+	nugetPackageBaseAddressTypes = []string{"PackageBaseAddress/3.0.0"}
+	nugetRegistrationsTypes      = []string{"RegistrationsBaseUrl/3.6.0", "RegistrationsBaseUrl/3.4.0", "RegistrationsBaseUrl/3.0.0-rc", "RegistrationsBaseUrl"}
+)
+
+type nugetServiceIndex struct {
+	Version   string                 `json:"version"`
+	Resources []nugetServiceResource `json:"resources"`
+}
+
+type nugetServiceResource struct {
+	ID   string `json:"@id"`
+	Type string `json:"@type"`
+}
+
+// findResource returns the URL of the first resource matching one of the given types.
+func (idx nugetServiceIndex) findResource(types []string) string {
+	for _, t := range types {
+		for _, res := range idx.Resources {
+			if res.Type == t {
+				if strings.HasSuffix(res.ID, "/") {
+					return res.ID
+				}
+				return res.ID + "/"
+			}
+		}
+	}
+	return ""
+}
+
+// ListAllFiles implements the Source interface.
+func (s *NuGetSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	var serviceIndex nugetServiceIndex
+	lerr := s.downloadAndParseJSON(ctx, s.serviceIndexURL.String(), &serviceIndex)
+	if lerr != nil {
+		return lerr
+	}
+	flatContainerURL := serviceIndex.findResource(nugetPackageBaseAddressTypes)
+	if flatContainerURL == "" {
+		return &ListEntriesError{
+			Location: s.serviceIndexURL.String(),
+			Message:  "cannot find PackageBaseAddress resource in service index",
+		}
+	}
+	registrationsURL := serviceIndex.findResource(nugetRegistrationsTypes)
+
+	// the version lists of the flat container are transferred at the very end,
+	// when all packages have already been uploaded (to avoid situations where a
+	// client might see repository metadata without being able to see the
+	// referenced packages)
+	var metadataFiles []FileSpec
+
+	for _, pkg := range s.Packages {
+		lowerID := strings.ToLower(pkg.ID)
+
+		var versions []nugetVersion
+		if registrationsURL == "" {
+			versions, lerr = s.listVersionsFromFlatContainer(ctx, flatContainerURL+lowerID+"/index.json")
+		} else {
+			versions, lerr = s.listVersionsFromRegistration(ctx, registrationsURL+lowerID+"/index.json")
+		}
+		if lerr != nil {
+			return lerr
+		}
+
+		selectedVersions := []string{}
+		for _, v := range versions {
+			if !pkg.versionRange.Contains(v) {
+				continue
+			}
+			if !s.IncludePrerelease && v.IsPrerelease() {
+				continue
+			}
+			// flat container paths always use the normalized lower-case version
+			version := v.Normalized()
+			selectedVersions = append(selectedVersions, version)
+
+			for _, fileName := range []string{lowerID + "." + version + ".nupkg", lowerID + ".nuspec"} {
+				filePath := lowerID + "/" + version + "/" + fileName
+				out <- FileSpec{
+					Path:         filePath,
+					DownloadPath: flatContainerURL + filePath,
+				}
+			}
+		}
+
+		versionList, err := json.Marshal(map[string][]string{"versions": selectedVersions})
+		if err != nil {
+			return &ListEntriesError{Location: s.URLString, Message: "cannot render version list for " + pkg.ID, Inner: err}
+		}
+		metadataFiles = append(metadataFiles, generatedFileSpec(lowerID+"/index.json", versionList, "application/json"))
+	}
+
+	// if we know where the target will be reachable, we can also generate a
+	// service index that points NuGet clients to the flat container
+	if s.PublicURLString != "" {
+		index := nugetServiceIndex{
+			Version: "3.0.0",
+			Resources: []nugetServiceResource{{
+				ID:   s.PublicURLString,
+				Type: nugetPackageBaseAddressTypes[0],
+			}},
+		}
+		buf, err := json.Marshal(index)
+		if err != nil {
+			return &ListEntriesError{Location: s.URLString, Message: "cannot render service index", Inner: err}
+		}
+		metadataFiles = append(metadataFiles, generatedFileSpec("index.json", buf, "application/json"))
+	}
+
+	for _, file := range metadataFiles {
+		out <- file
+	}
+	return nil
+}
+
+// Helper function for NuGetSource.ListAllFiles().
+func (s *NuGetSource) listVersionsFromFlatContainer(ctx context.Context, uri string) ([]nugetVersion, *ListEntriesError) {
+	var data struct {
+		Versions []string `json:"versions"`
+	}
+	lerr := s.downloadAndParseJSON(ctx, uri, &data)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	result := make([]nugetVersion, 0, len(data.Versions))
+	for _, input := range data.Versions {
+		v, err := parseNuGetVersion(input)
+		if err != nil {
+			return nil, &ListEntriesError{Location: uri, Message: "invalid version in flat container", Inner: err}
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+type nugetRegistrationPage struct {
+	ID     string `json:"@id"`
+	Leaves []struct {
+		CatalogEntry struct {
+			Version string `json:"version"`
+			Listed  *bool  `json:"listed"`
+		} `json:"catalogEntry"`
+	} `json:"items"`
+}
+
+// Helper function for NuGetSource.ListAllFiles().
+func (s *NuGetSource) listVersionsFromRegistration(ctx context.Context, uri string) ([]nugetVersion, *ListEntriesError) {
+	var index struct {
+		Pages []nugetRegistrationPage `json:"items"`
+	}
+	lerr := s.downloadAndParseJSON(ctx, uri, &index)
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	var result []nugetVersion
+	for _, page := range index.Pages {
+		// for packages with many versions, the pages are not inlined into the
+		// index and need to be fetched separately
+		if page.Leaves == nil {
+			lerr := s.downloadAndParseJSON(ctx, page.ID, &page)
+			if lerr != nil {
+				return nil, lerr
+			}
+		}
+
+		for _, leaf := range page.Leaves {
+			entry := leaf.CatalogEntry
+			if !s.IncludeUnlisted && entry.Listed != nil && !*entry.Listed {
+				continue
+			}
+			v, err := parseNuGetVersion(entry.Version)
+			if err != nil {
+				return nil, &ListEntriesError{Location: page.ID, Message: "invalid version in registration", Inner: err}
+			}
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// Helper function for NuGetSource.ListAllFiles().
+func (s *NuGetSource) downloadAndParseJSON(ctx context.Context, uri string, data any) *ListEntriesError {
+	buf, _, lerr := s.urlSource.getURLContents(ctx, uri)
+	if lerr != nil {
+		return lerr
+	}
+	err := json.Unmarshal(buf, data)
+	if err != nil {
+		return &ListEntriesError{
+			Location: uri,
+			Message:  "error while parsing JSON",
+			Inner:    err,
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NuGet versions and version ranges
+
+// nugetVersion is a version number as understood by NuGet: a SemVer 2.0
+// version with an optional fourth numeric component.
+// Reference: <https://learn.microsoft.com/en-us/nuget/concepts/package-versioning>
+type nugetVersion struct {
+	Numbers    [4]uint64
+	Prerelease []string
+}
+
+func parseNuGetVersion(input string) (nugetVersion, error) {
+	var v nugetVersion
+
+	// build metadata is irrelevant for version comparison
+	release, _, _ := strings.Cut(strings.TrimSpace(input), "+")
+	release, prerelease, hasPrerelease := strings.Cut(release, "-")
+
+	fields := strings.Split(release, ".")
+	if len(fields) > len(v.Numbers) {
+		return v, fmt.Errorf("too many components in version %q", input)
+	}
+	for idx, field := range fields {
+		var err error
+		v.Numbers[idx], err = strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q: %w", input, err)
+		}
+	}
+
+	if hasPrerelease {
+		if prerelease == "" {
+			return v, fmt.Errorf("invalid version %q: empty prerelease label", input)
+		}
+		v.Prerelease = strings.Split(prerelease, ".")
+	}
+	return v, nil
+}
+
+// IsPrerelease returns whether this version has a prerelease label.
+func (v nugetVersion) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Normalized returns the normalized string representation of this version,
+// as used in the paths of the flat container.
+func (v nugetVersion) Normalized() string {
+	result := fmt.Sprintf("%d.%d.%d", v.Numbers[0], v.Numbers[1], v.Numbers[2])
+	if v.Numbers[3] != 0 {
+		result += "." + strconv.FormatUint(v.Numbers[3], 10)
+	}
+	if v.IsPrerelease() {
+		result += "-" + strings.Join(v.Prerelease, ".")
+	}
+	return strings.ToLower(result)
+}
+
+// Compare returns -1, 0 or +1 if v is smaller than, equal to or larger than other.
+func (v nugetVersion) Compare(other nugetVersion) int {
+	for idx := range v.Numbers {
+		if c := cmp.Compare(v.Numbers[idx], other.Numbers[idx]); c != 0 {
+			return c
+		}
+	}
+
+	// a release version is larger than all prerelease versions with the same numbers
+	switch {
+	case !v.IsPrerelease() && !other.IsPrerelease():
+		return 0
+	case !v.IsPrerelease():
+		return +1
+	case !other.IsPrerelease():
+		return -1
+	}
+
+	return slices.CompareFunc(v.Prerelease, other.Prerelease, func(lhs, rhs string) int {
+		lhsNum, lhsErr := strconv.ParseUint(lhs, 10, 64)
+		rhsNum, rhsErr := strconv.ParseUint(rhs, 10, 64)
+		switch {
+		case lhsErr == nil && rhsErr == nil:
+			return cmp.Compare(lhsNum, rhsNum)
+		case lhsErr == nil:
+			return -1 // numeric labels sort before alphanumeric labels
+		case rhsErr == nil:
+			return +1
+		default:
+			return strings.Compare(strings.ToLower(lhs), strings.ToLower(rhs))
+		}
+	})
+}
+
+// nugetVersionRange is a version range as understood by NuGet.
+// The zero value matches all versions.
+type nugetVersionRange struct {
+	Min          *nugetVersion
+	MinInclusive bool
+	Max          *nugetVersion
+	MaxInclusive bool
+}
+
+var errInvalidNuGetVersionRange = errors.New(`expected a version range like "1.0", "[1.0]", "[1.0,2.0)" or "(,2.0]"`)
+
+func parseNuGetVersionRange(input string) (nugetVersionRange, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nugetVersionRange{}, nil
+	}
+
+	// a single version is a minimum version
+	if !strings.HasPrefix(input, "[") && !strings.HasPrefix(input, "(") {
+		v, err := parseNuGetVersion(input)
+		if err != nil {
+			return nugetVersionRange{}, err
+		}
+		return nugetVersionRange{Min: &v, MinInclusive: true}, nil
+	}
+
+	if !strings.HasSuffix(input, "]") && !strings.HasSuffix(input, ")") {
+		return nugetVersionRange{}, fmt.Errorf("%w, got %q", errInvalidNuGetVersionRange, input)
+	}
+	r := nugetVersionRange{
+		MinInclusive: strings.HasPrefix(input, "["),
+		MaxInclusive: strings.HasSuffix(input, "]"),
+	}
+	lower, upper, hasComma := strings.Cut(input[1:len(input)-1], ",")
+
+	// "[1.0]" is an exact version
+	if !hasComma {
+		if !r.MinInclusive || !r.MaxInclusive {
+			return nugetVersionRange{}, fmt.Errorf("%w, got %q", errInvalidNuGetVersionRange, input)
+		}
+		v, err := parseNuGetVersion(lower)
+		if err != nil {
+			return nugetVersionRange{}, err
+		}
+		r.Min = &v
+		r.Max = &v
+		return r, nil
+	}
+
+	if strings.TrimSpace(lower) == "" && strings.TrimSpace(upper) == "" {
+		return nugetVersionRange{}, fmt.Errorf("%w, got %q", errInvalidNuGetVersionRange, input)
+	}
+	if strings.TrimSpace(lower) != "" {
+		v, err := parseNuGetVersion(lower)
+		if err != nil {
+			return nugetVersionRange{}, err
+		}
+		r.Min = &v
+	}
+	if strings.TrimSpace(upper) != "" {
+		v, err := parseNuGetVersion(upper)
+		if err != nil {
+			return nugetVersionRange{}, err
+		}
+		r.Max = &v
+	}
+	return r, nil
+}
+
+// Contains checks whether the given version is within this range.
+func (r nugetVersionRange) Contains(v nugetVersion) bool {
+	if r.Min != nil {
+		c := v.Compare(*r.Min)
+		if c < 0 || (c == 0 && !r.MinInclusive) {
+			return false
+		}
+	}
+	if r.Max != nil {
+		c := v.Compare(*r.Max)
+		if c > 0 || (c == 0 && !r.MaxInclusive) {
+			return false
+		}
+	}
+	return true
+}
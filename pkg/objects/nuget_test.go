@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"testing"
+
+	"github.com/sapcc/go-bits/must"
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestNuGetVersionNormalization(t *testing.T) {
+	testcases := map[string]string{
+		"1.0":                 "1.0.0",
+		"1.0.0.0":             "1.0.0",
+		"1.2.3.4":             "1.2.3.4",
+		"1.0.0-Beta.1":        "1.0.0-beta.1",
+		"1.0.0-rc.1+git.abcd": "1.0.0-rc.1",
+	}
+	for input, expected := range testcases {
+		v := must.ReturnT(parseNuGetVersion(input))(t)
+		assert.Equal(t, v.Normalized(), expected)
+	}
+}
+
+func TestNuGetVersionRange(t *testing.T) {
+	tt := []struct {
+		versionRange string
+		version      string
+		contained    bool
+	}{
+		{"", "0.0.1", true},
+		{"1.0", "0.9", false},
+		{"1.0", "1.0", true},
+		{"1.0", "17.4.2", true},
+		{"1.0", "1.0.0-beta", false},
+		{"[1.0]", "1.0.0", true},
+		{"[1.0]", "1.0.1", false},
+		{"[1.0,2.0)", "1.99.99", true},
+		{"[1.0,2.0)", "2.0", false},
+		{"[1.0,2.0)", "2.0.0-alpha", true}, // prereleases are smaller than the release
+		{"(1.0,2.0]", "1.0", false},
+		{"(1.0,2.0]", "2.0", true},
+		{"(,2.0]", "0.1", true},
+		{"[3.0,)", "2.9", false},
+		{"[3.0,)", "4.0", true},
+		{"[1.0.0-alpha.2,1.0.0-alpha.10]", "1.0.0-alpha.9", true},
+		{"[1.0.0-alpha.2,1.0.0-alpha.10]", "1.0.0-alpha.beta", false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.versionRange+" contains "+tc.version, func(t *testing.T) {
+			r := must.ReturnT(parseNuGetVersionRange(tc.versionRange))(t)
+			v := must.ReturnT(parseNuGetVersion(tc.version))(t)
+			assert.Equal(t, r.Contains(v), tc.contained)
+		})
+	}
+
+	for _, input := range []string{"[1.0", "(1.0)", "[,]", "1.0.0.0.0", "[1.0,x]"} {
+		_, err := parseNuGetVersionRange(input)
+		assert.Equal(t, err != nil, true)
+	}
+}
@@ -0,0 +1,374 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/regexpext"
+	"go.xyrillian.de/schwift/v2"
+)
+
+// OSTreeSource is a URLSource containing an OSTree repository (e.g. a Flatpak
+// repository). This type reuses the Validate() and Connect() logic of
+// URLSource, but adds a custom scraping implementation that walks the object
+// graph of the selected refs instead of relying on directory listings.
+type OSTreeSource struct {
+	// options from config file
+	URLString                string                    `yaml:"url"`
+	ClientCertificatePath    string                    `yaml:"cert"`
+	ClientCertificateKeyPath string                    `yaml:"key"`
+	ServerCAPath             string                    `yaml:"ca"`
+	Refs                     []regexpext.BoundedRegexp `yaml:"refs"`
+	// compiled configuration
+	urlSource *URLSource `yaml:"-"`
+}
+
+// Validate implements the Source interface.
+func (s *OSTreeSource) Validate(name string) []error {
+	s.urlSource = &URLSource{
+		URLString:                s.URLString,
+		ClientCertificatePath:    s.ClientCertificatePath,
+		ClientCertificateKeyPath: s.ClientCertificateKeyPath,
+		ServerCAPath:             s.ServerCAPath,
+	}
+	return s.urlSource.Validate(name)
+}
+
+// Connect implements the Source interface.
+func (s *OSTreeSource) Connect(ctx context.Context, name string) error {
+	return s.urlSource.Connect(ctx, name)
+}
+
+// ListEntries implements the Source interface.
+func (s *OSTreeSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+// GetFile implements the Source interface.
+func (s *OSTreeSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	return s.urlSource.GetFile(ctx, path, requestHeaders)
+}
+
+// GVariant types of the OSTree metadata that we need to parse.
+var (
+	ostreeSummaryType = mustParseGVariantType("(a(s(taya{sv}))a{sv})")
+	ostreeCommitType  = mustParseGVariantType("(a{sv}aya(say)sstayay)")
+	ostreeDirTreeType = mustParseGVariantType("(a(say)a(sayay))")
+)
+
+// ostreeWalker holds the state of OSTreeSource.ListAllFiles() while walking
+// the object graph.
+type ostreeWalker struct {
+	source *OSTreeSource
+	cache  map[string]FileSpec
+	out    chan<- FileSpec
+	// since objects are shared between commits (and between refs), a record
+	// of unique objects is kept in order to avoid duplicates
+	visited map[string]bool
+}
+
+// ListAllFiles implements the Source interface.
+func (s *OSTreeSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	cache := make(map[string]FileSpec)
+
+	// only archive repos can be served over HTTP
+	configBuf, configURI, lerr := s.urlSource.getFileContents(ctx, "config", cache)
+	if lerr != nil {
+		return lerr
+	}
+	mode := parseOSTreeRepoMode(string(configBuf))
+	if mode != "archive-z2" && mode != "archive" {
+		return &ListEntriesError{Location: configURI, Message: fmt.Sprintf("unsupported repository mode %q", mode)}
+	}
+
+	// find the selected refs in the summary
+	summaryBuf, summaryURI, lerr := s.urlSource.getFileContents(ctx, "summary", cache)
+	if lerr != nil {
+		return lerr
+	}
+	refs, err := parseOSTreeSummary(summaryBuf)
+	if err != nil {
+		return &ListEntriesError{Location: summaryURI, Message: "error while parsing summary", Inner: err}
+	}
+	selectedRefs := s.selectRefs(refs)
+	if len(selectedRefs) == 0 {
+		return &ListEntriesError{Location: summaryURI, Message: "no refs in summary match the configured refs"}
+	}
+
+	// the objects of each selected ref are transferred in such a way that
+	// objects are only transferred after all objects referenced by them (to
+	// avoid situations where a client might see an object without being able
+	// to see the objects referenced by it)
+	w := ostreeWalker{source: s, cache: cache, out: out, visited: make(map[string]bool)}
+	var metadataFiles []FileSpec
+	for _, ref := range selectedRefs {
+		lerr := w.walkCommit(ctx, refs[ref])
+		if lerr != nil {
+			return lerr
+		}
+
+		// refs/heads/ files are not required when a summary exists, but are
+		// transferred if present since older clients may use them
+		refPath := path.Join("refs/heads", ref)
+		_, _, lerr = s.urlSource.getFileContents(ctx, refPath, cache)
+		switch {
+		case lerr == nil:
+			metadataFiles = append(metadataFiles, getFileSpec(refPath, cache))
+		case !lerr.isNotFound():
+			return lerr
+		}
+	}
+
+	// the repository metadata is transferred at the very end, when all
+	// objects have already been uploaded; the summary itself comes last
+	metadataFiles = append(metadataFiles, getFileSpec("config", cache))
+	_, _, lerr = s.urlSource.getFileContents(ctx, "summary.sig", cache)
+	switch {
+	case lerr == nil:
+		metadataFiles = append(metadataFiles, getFileSpec("summary.sig", cache))
+	case !lerr.isNotFound():
+		return lerr
+	}
+	metadataFiles = append(metadataFiles, getFileSpec("summary", cache))
+
+	for _, file := range metadataFiles {
+		out <- file
+	}
+	return nil
+}
+
+// Helper function for OSTreeSource.ListAllFiles().
+func (s *OSTreeSource) selectRefs(refs map[string]string) []string {
+	var result []string
+	for ref := range refs {
+		if len(s.Refs) == 0 || slices.ContainsFunc(s.Refs, func(rx regexpext.BoundedRegexp) bool { return rx.MatchString(ref) }) {
+			result = append(result, ref)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// Helper function for OSTreeSource.ListAllFiles().
+//
+// Only the commit that the ref points to is transferred, not its parent commits.
+func (w *ostreeWalker) walkCommit(ctx context.Context, checksum string) *ListEntriesError {
+	if w.visited[ostreeObjectPath(checksum, ".commit")] {
+		return nil
+	}
+	children, commitPath, lerr := w.downloadAndParseObject(ctx, checksum, ".commit", ostreeCommitType)
+	if lerr != nil {
+		return lerr
+	}
+	treeChecksum, err := ostreeChecksumOf(children[6])
+	if err != nil {
+		return &ListEntriesError{Location: w.source.urlSource.getURLForPath(commitPath).String(), Message: "error while parsing commit", Inner: err}
+	}
+	metaChecksum, err := ostreeChecksumOf(children[7])
+	if err != nil {
+		return &ListEntriesError{Location: w.source.urlSource.getURLForPath(commitPath).String(), Message: "error while parsing commit", Inner: err}
+	}
+	lerr = w.walkDirTree(ctx, treeChecksum, metaChecksum)
+	if lerr != nil {
+		return lerr
+	}
+
+	// detached metadata (e.g. GPG signatures) is optional and can change
+	// over time, so it is not content-addressed like the other objects
+	commitMetaPath := ostreeObjectPath(checksum, ".commitmeta")
+	_, _, lerr = w.source.urlSource.getFileContents(ctx, commitMetaPath, w.cache)
+	switch {
+	case lerr == nil:
+		w.out <- getFileSpec(commitMetaPath, w.cache)
+	case !lerr.isNotFound():
+		return lerr
+	}
+
+	w.emitObject(commitPath, checksum)
+	return nil
+}
+
+// Helper function for OSTreeSource.ListAllFiles().
+func (w *ostreeWalker) walkDirTree(ctx context.Context, treeChecksum, metaChecksum string) *ListEntriesError {
+	// dirmeta objects do not reference other objects, so they do not need to be downloaded
+	metaPath := ostreeObjectPath(metaChecksum, ".dirmeta")
+	if !w.visited[metaPath] {
+		w.visited[metaPath] = true
+		w.out <- FileSpec{
+			Path:             metaPath,
+			IsImmutable:      true,
+			ExpectedChecksum: &Checksum{Algorithm: "sha256", Value: metaChecksum},
+		}
+	}
+
+	if w.visited[ostreeObjectPath(treeChecksum, ".dirtree")] {
+		return nil
+	}
+	children, treePath, lerr := w.downloadAndParseObject(ctx, treeChecksum, ".dirtree", ostreeDirTreeType)
+	if lerr != nil {
+		return lerr
+	}
+	treeURI := w.source.urlSource.getURLForPath(treePath).String()
+
+	files, err := children[0].Children()
+	if err != nil {
+		return &ListEntriesError{Location: treeURI, Message: "error while parsing dirtree", Inner: err}
+	}
+	for _, file := range files {
+		fields, err := file.Children()
+		var fileChecksum string
+		if err == nil {
+			fileChecksum, err = ostreeChecksumOf(fields[1])
+		}
+		if err != nil {
+			return &ListEntriesError{Location: treeURI, Message: "error while parsing dirtree", Inner: err}
+		}
+
+		// file objects are compressed, and their checksum refers to the
+		// uncompressed contents, so they cannot be verified here
+		filePath := ostreeObjectPath(fileChecksum, ".filez")
+		if !w.visited[filePath] {
+			w.visited[filePath] = true
+			w.out <- FileSpec{Path: filePath, IsImmutable: true}
+		}
+	}
+
+	dirs, err := children[1].Children()
+	if err != nil {
+		return &ListEntriesError{Location: treeURI, Message: "error while parsing dirtree", Inner: err}
+	}
+	for _, dir := range dirs {
+		fields, err := dir.Children()
+		var subtreeChecksum, submetaChecksum string
+		if err == nil {
+			subtreeChecksum, err = ostreeChecksumOf(fields[1])
+		}
+		if err == nil {
+			submetaChecksum, err = ostreeChecksumOf(fields[2])
+		}
+		if err != nil {
+			return &ListEntriesError{Location: treeURI, Message: "error while parsing dirtree", Inner: err}
+		}
+		lerr := w.walkDirTree(ctx, subtreeChecksum, submetaChecksum)
+		if lerr != nil {
+			return lerr
+		}
+	}
+
+	w.emitObject(treePath, treeChecksum)
+	return nil
+}
+
+// Helper function for OSTreeSource.ListAllFiles().
+//
+// Downloads a metadata object, verifies that its contents match its checksum,
+// and splits it into its top-level members.
+func (w *ostreeWalker) downloadAndParseObject(ctx context.Context, checksum, extension string, t *gvariantType) ([]gvariantValue, string, *ListEntriesError) {
+	objectPath := ostreeObjectPath(checksum, extension)
+	buf, uri, lerr := w.source.urlSource.getFileContents(ctx, objectPath, w.cache)
+	if lerr != nil {
+		return nil, objectPath, lerr
+	}
+	err := (Checksum{Algorithm: "sha256", Value: checksum}).Verify(buf)
+	if err != nil {
+		return nil, objectPath, &ListEntriesError{Location: uri, Message: "object does not match its checksum", Inner: err}
+	}
+	children, err := gvariantValue{t, buf}.Children()
+	if err != nil {
+		return nil, objectPath, &ListEntriesError{Location: uri, Message: "error while parsing " + strings.TrimPrefix(extension, "."), Inner: err}
+	}
+	return children, objectPath, nil
+}
+
+// Helper function for OSTreeSource.ListAllFiles().
+func (w *ostreeWalker) emitObject(objectPath, checksum string) {
+	w.visited[objectPath] = true
+	spec := getFileSpec(objectPath, w.cache)
+	spec.IsImmutable = true
+	spec.ExpectedChecksum = &Checksum{Algorithm: "sha256", Value: checksum}
+	w.out <- spec
+}
+
+// ostreeObjectPath returns the path of an object in an OSTree repository,
+// e.g. "objects/ab/cdef...0123.dirtree".
+func ostreeObjectPath(checksum, extension string) string {
+	return path.Join("objects", checksum[:2], checksum[2:]+extension)
+}
+
+// ostreeChecksumOf decodes a binary SHA-256 checksum (type "ay") into its hex form.
+func ostreeChecksumOf(v gvariantValue) (string, error) {
+	buf, err := v.Bytes()
+	if err != nil {
+		return "", err
+	}
+	if len(buf) != 32 {
+		return "", fmt.Errorf("expected checksum of 32 bytes, but got %d bytes", len(buf))
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// parseOSTreeRepoMode returns the value of core.mode from the config file of
+// an OSTree repository.
+func parseOSTreeRepoMode(config string) string {
+	section := ""
+	for line := range strings.SplitSeq(config, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && section == "core" && strings.TrimSpace(key) == "mode" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// parseOSTreeSummary returns a mapping of ref names to commit checksums from
+// the summary file of an OSTree repository.
+func parseOSTreeSummary(buf []byte) (map[string]string, error) {
+	members, err := gvariantValue{ostreeSummaryType, buf}.Children()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := members[0].Children()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		// each entry is (ref name, (commit size, commit checksum, metadata))
+		fields, err := entry.Children()
+		if err != nil {
+			return nil, err
+		}
+		ref, err := fields[0].String()
+		if err != nil {
+			return nil, err
+		}
+		commitFields, err := fields[1].Children()
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := ostreeChecksumOf(commitFields[1])
+		if err != nil {
+			return nil, fmt.Errorf("in ref %q: %w", ref, err)
+		}
+		if ref == "" {
+			return nil, errors.New("empty ref name")
+		}
+		result[ref] = checksum
+	}
+	return result, nil
+}
@@ -0,0 +1,445 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/md5"  //nolint:gosec // only used for verifying checksums that dpkg-sig publishes in this format
+	"crypto/sha1" //nolint:gosec // same as above
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sapcc/swift-http-import/pkg/util"
+)
+
+// packageSignatureVerifier verifies the signatures that are embedded in
+// package files. It is used by YumSource and DebianSource when
+// `package_signing_keys` is configured.
+type packageSignatureVerifier interface {
+	// VerifyPackage reads the package from the given reader, and returns an
+	// error if the package is unsigned or not validly signed by a trusted key.
+	// The reader does not need to be read until EOF.
+	VerifyPackage(ctx context.Context, r io.Reader) error
+}
+
+// errPackageSignatureInvalid wraps all errors returned by signatureVerifyingReader.
+var errPackageSignatureInvalid = errors.New("package signature verification failed")
+
+// signatureVerifyingReader is an io.ReadCloser that passes all data read
+// through it to a packageSignatureVerifier (which runs in a separate
+// goroutine). When the underlying reader reaches EOF, the result of the
+// verification is returned instead of io.EOF if it failed. Like with
+// verifyingReader, this causes the upload to Swift to fail.
+type signatureVerifyingReader struct {
+	Base   io.ReadCloser
+	pipe   *io.PipeWriter
+	result chan error
+	err    error
+	done   bool
+}
+
+func newSignatureVerifyingReader(ctx context.Context, base io.ReadCloser, verifier packageSignatureVerifier) io.ReadCloser {
+	pr, pw := io.Pipe()
+	r := &signatureVerifyingReader{Base: base, pipe: pw, result: make(chan error, 1)}
+	go func() {
+		err := verifier.VerifyPackage(ctx, pr)
+		// consume the rest of the package, so that Read() does not block
+		io.Copy(io.Discard, pr) //nolint:errcheck // only fails when the transfer is aborted
+		r.result <- err
+	}()
+	return r
+}
+
+// Read implements the io.Reader interface.
+func (r *signatureVerifyingReader) Read(buf []byte) (int, error) {
+	if r.done {
+		return 0, r.err
+	}
+	n, err := r.Base.Read(buf)
+	if n > 0 {
+		r.pipe.Write(buf[:n]) //nolint:errcheck // the other side only fails when the transfer is aborted
+	}
+	if err != nil {
+		r.pipe.CloseWithError(err) // this is io.EOF when the download is complete
+		r.done, r.err = true, err
+		if errors.Is(err, io.EOF) {
+			verr := <-r.result
+			if verr != nil {
+				r.err = fmt.Errorf("%w: %w", errPackageSignatureInvalid, verr)
+				return n, r.err
+			}
+		}
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (r *signatureVerifyingReader) Close() error {
+	if !r.done {
+		r.pipe.CloseWithError(errors.New("transfer aborted"))
+	}
+	return r.Base.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RPM
+
+// rpmSignatureVerifier verifies the signature header of RPM packages.
+//
+// Reference: <https://rpm-software-management.github.io/rpm/manual/format_v4.html>
+type rpmSignatureVerifier struct {
+	KeyRing     *util.GPGKeyRing
+	TrustedKeys util.GPGTrustSet
+}
+
+// tags in the signature header and the main header of an RPM package
+const (
+	rpmSigTagDSA              = 267  // OpenPGP signature of the main header
+	rpmSigTagRSA              = 268  // same as above
+	rpmSigTagPGP              = 1002 // OpenPGP signature of the main header and payload
+	rpmSigTagGPG              = 1005 // same as above
+	rpmTagPayloadDigest       = 5092
+	rpmTagPayloadDigestAlgo   = 5093
+	rpmHeaderMaxIndexEntries  = 1 << 16
+	rpmHeaderMaxDataSizeBytes = 256 << 20
+)
+
+// VerifyPackage implements the packageSignatureVerifier interface.
+func (v rpmSignatureVerifier) VerifyPackage(ctx context.Context, r io.Reader) error {
+	r = bufio.NewReader(r)
+	lead := make([]byte, 96)
+	_, err := io.ReadFull(r, lead)
+	if err != nil {
+		return fmt.Errorf("cannot read RPM lead: %w", err)
+	}
+	if !bytes.HasPrefix(lead, []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return errors.New("not an RPM package")
+	}
+	sigHeader, err := readRPMHeader(r)
+	if err != nil {
+		return fmt.Errorf("cannot read RPM signature header: %w", err)
+	}
+	// the signature header is padded to a multiple of 8 bytes
+	_, err = io.CopyN(io.Discard, r, int64((8-len(sigHeader.Store)%8)%8))
+	if err != nil {
+		return fmt.Errorf("cannot read RPM signature header: %w", err)
+	}
+	header, err := readRPMHeader(r)
+	if err != nil {
+		return fmt.Errorf("cannot read RPM header: %w", err)
+	}
+
+	// prefer the header-only signature, since the payload can be verified more
+	// cheaply with the payload digest from the signed header (this is the only
+	// option for packages built with RPM 4.14 and newer)
+	headerSignature := sigHeader.Binary(rpmSigTagRSA, rpmSigTagDSA)
+	payloadDigest := header.String(rpmTagPayloadDigest)
+	if headerSignature != nil && payloadDigest != "" {
+		err := v.KeyRing.VerifyDetachedGPGSignatureFrom(ctx, v.TrustedKeys, bytes.NewReader(header.Raw), headerSignature)
+		if err != nil {
+			return fmt.Errorf("invalid RPM header signature: %w", err)
+		}
+		return verifyRPMPayloadDigest(r, header, payloadDigest)
+	}
+
+	// older packages have a signature of the header and payload
+	fullSignature := sigHeader.Binary(rpmSigTagPGP, rpmSigTagGPG)
+	if fullSignature != nil {
+		err := v.KeyRing.VerifyDetachedGPGSignatureFrom(ctx, v.TrustedKeys, io.MultiReader(bytes.NewReader(header.Raw), r), fullSignature)
+		if err != nil {
+			return fmt.Errorf("invalid RPM signature: %w", err)
+		}
+		return nil
+	}
+
+	if headerSignature != nil {
+		return errors.New("RPM header is signed, but does not contain a payload digest")
+	}
+	return errors.New("RPM package is not signed")
+}
+
+// Helper function for rpmSignatureVerifier.VerifyPackage().
+func verifyRPMPayloadDigest(payload io.Reader, header rpmHeader, payloadDigest string) error {
+	// the algorithm IDs are the same as in OpenPGP (RFC 4880, section 9.4)
+	var checksum Checksum
+	switch header.Int32(rpmTagPayloadDigestAlgo) {
+	case 2:
+		checksum = Checksum{Algorithm: "sha1", Value: payloadDigest}
+	case 8:
+		checksum = Checksum{Algorithm: "sha256", Value: payloadDigest}
+	case 10:
+		checksum = Checksum{Algorithm: "sha512", Value: payloadDigest}
+	default:
+		return fmt.Errorf("unsupported RPM payload digest algorithm: %d", header.Int32(rpmTagPayloadDigestAlgo))
+	}
+	h, err := checksum.newHash()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(h, payload)
+	if err != nil {
+		return err
+	}
+	err = checksum.compare(h.Sum(nil))
+	if err != nil {
+		return fmt.Errorf("invalid RPM payload: %w", err)
+	}
+	return nil
+}
+
+// rpmHeader is a header structure in an RPM package (either the signature
+// header or the main header).
+type rpmHeader struct {
+	// the whole header as it appears in the package
+	Raw     []byte
+	Entries map[uint32]rpmHeaderEntry
+	Store   []byte
+}
+
+// rpmHeaderEntry is an entry in the index of an rpmHeader.
+type rpmHeaderEntry struct {
+	Type   uint32
+	Offset uint32
+	Count  uint32
+}
+
+// Helper function for rpmSignatureVerifier.VerifyPackage().
+func readRPMHeader(r io.Reader) (rpmHeader, error) {
+	intro := make([]byte, 16)
+	_, err := io.ReadFull(r, intro)
+	if err != nil {
+		return rpmHeader{}, err
+	}
+	if !bytes.HasPrefix(intro, []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		return rpmHeader{}, errors.New("invalid header magic")
+	}
+	indexCount := binary.BigEndian.Uint32(intro[8:12])
+	storeSize := binary.BigEndian.Uint32(intro[12:16])
+	if indexCount > rpmHeaderMaxIndexEntries || storeSize > rpmHeaderMaxDataSizeBytes {
+		return rpmHeader{}, fmt.Errorf("header is too large (%d entries, %d bytes)", indexCount, storeSize)
+	}
+
+	raw := make([]byte, 16+16*int(indexCount)+int(storeSize))
+	copy(raw, intro)
+	_, err = io.ReadFull(r, raw[16:])
+	if err != nil {
+		return rpmHeader{}, err
+	}
+
+	h := rpmHeader{
+		Raw:     raw,
+		Entries: make(map[uint32]rpmHeaderEntry, indexCount),
+		Store:   raw[16+16*int(indexCount):],
+	}
+	for idx := range int(indexCount) {
+		entry := raw[16+16*idx : 32+16*idx]
+		h.Entries[binary.BigEndian.Uint32(entry[0:4])] = rpmHeaderEntry{
+			Type:   binary.BigEndian.Uint32(entry[4:8]),
+			Offset: binary.BigEndian.Uint32(entry[8:12]),
+			Count:  binary.BigEndian.Uint32(entry[12:16]),
+		}
+	}
+	return h, nil
+}
+
+// Binary returns the value of the first of the given tags that exists and has
+// type BIN, or nil if there is none.
+func (h rpmHeader) Binary(tags ...uint32) []byte {
+	for _, tag := range tags {
+		entry, exists := h.Entries[tag]
+		if !exists || entry.Type != 7 {
+			continue
+		}
+		if uint64(entry.Offset)+uint64(entry.Count) <= uint64(len(h.Store)) {
+			return h.Store[entry.Offset : entry.Offset+entry.Count]
+		}
+	}
+	return nil
+}
+
+// String returns the value of the given tag if it has type STRING, or the
+// first value if it has type STRING_ARRAY. Otherwise, "" is returned.
+func (h rpmHeader) String(tag uint32) string {
+	entry, exists := h.Entries[tag]
+	if !exists || (entry.Type != 6 && entry.Type != 8) || entry.Offset >= uint32(len(h.Store)) {
+		return ""
+	}
+	value, _, _ := bytes.Cut(h.Store[entry.Offset:], []byte{0})
+	return string(value)
+}
+
+// Int32 returns the value of the given tag if it has type INT32, or the first
+// value if it is an array. Otherwise, 0 is returned.
+func (h rpmHeader) Int32(tag uint32) uint32 {
+	entry, exists := h.Entries[tag]
+	if !exists || entry.Type != 4 || uint64(entry.Offset)+4 > uint64(len(h.Store)) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(h.Store[entry.Offset : entry.Offset+4])
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Debian
+
+// debSignatureVerifier verifies the signatures that are embedded in Debian
+// packages by either debsig ("_gpgorigin" member, a detached signature of the
+// other members) or dpkg-sig ("_gpgbuilder" etc. members, a clear-signed list
+// of checksums of the other members). At least one of these signatures must
+// be valid and made by a trusted key.
+type debSignatureVerifier struct {
+	KeyRing     *util.GPGKeyRing
+	TrustedKeys util.GPGTrustSet
+}
+
+// The hash algorithms that are accepted in debsig signatures. Since the
+// signature comes after the signed data, the data needs to be hashed with all
+// of these at once.
+var debsigHashes = map[crypto.Hash]func() hash.Hash{
+	crypto.SHA1:   sha1.New,
+	crypto.SHA256: sha256.New,
+	crypto.SHA384: sha512.New384,
+	crypto.SHA512: sha512.New,
+}
+
+// debMember contains the checksums of a member of a Debian package.
+type debMember struct {
+	Name      string
+	SizeBytes int64
+	MD5       string
+	SHA1      string
+}
+
+// VerifyPackage implements the packageSignatureVerifier interface.
+func (v debSignatureVerifier) VerifyPackage(ctx context.Context, r io.Reader) error {
+	r = bufio.NewReader(r)
+	magic := make([]byte, 8)
+	_, err := io.ReadFull(r, magic)
+	if err != nil || string(magic) != "!<arch>\n" {
+		return errors.New("not a Debian package")
+	}
+
+	prehashed := make(map[crypto.Hash]hash.Hash, len(debsigHashes))
+	for algo, newHash := range debsigHashes {
+		prehashed[algo] = newHash()
+	}
+	var (
+		members    []debMember
+		signatures = make(map[string][]byte)
+	)
+	for {
+		header := make([]byte, 60)
+		_, err := io.ReadFull(r, header)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil || string(header[58:60]) != "`\n" {
+			return errors.New("invalid ar member header")
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid size of ar member %q", name)
+		}
+
+		if strings.HasPrefix(name, "_gpg") {
+			if size > 1<<20 {
+				return fmt.Errorf("signature in ar member %q is too large", name)
+			}
+			signatures[name] = make([]byte, size)
+			_, err = io.ReadFull(r, signatures[name])
+		} else {
+			member := debMember{Name: name, SizeBytes: size}
+			md5Hash, sha1Hash := md5.New(), sha1.New() //nolint:gosec // see import
+			writers := []io.Writer{md5Hash, sha1Hash}
+			// debsig signs the concatenation of these members
+			if name == "debian-binary" || strings.HasPrefix(name, "control.tar") || strings.HasPrefix(name, "data.tar") {
+				for _, h := range prehashed {
+					writers = append(writers, h)
+				}
+			}
+			_, err = io.CopyN(io.MultiWriter(writers...), r, size)
+			member.MD5, member.SHA1 = hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha1Hash.Sum(nil))
+			members = append(members, member)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read ar member %q: %w", name, err)
+		}
+		// members are aligned to 2 bytes
+		if size%2 == 1 {
+			_, err = io.ReadFull(r, make([]byte, 1))
+			if err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("cannot read ar member %q: %w", name, err)
+			}
+		}
+	}
+	if len(signatures) == 0 {
+		return errors.New("Debian package is not signed")
+	}
+
+	var errs []string
+	for name, signature := range signatures {
+		if bytes.HasPrefix(signature, []byte("-----BEGIN PGP SIGNED MESSAGE-----")) {
+			err = v.verifyDpkgSig(ctx, signature, members)
+		} else {
+			err = v.KeyRing.VerifyPrehashedGPGSignatureFrom(ctx, v.TrustedKeys, prehashed, signature)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", name, err.Error()))
+	}
+	return fmt.Errorf("no valid signature by a trusted key: %s", strings.Join(errs, ", "))
+}
+
+// Helper function for debSignatureVerifier.VerifyPackage().
+//
+// Verifies a signature created by dpkg-sig, which looks like this (before
+// clear-signing):
+//
+//	Version: 4
+//	Signer:
+//	Date: Sat Jan  1 00:00:00 2022
+//	Role: builder
+//	Files:
+//		3cf918272ffa5de195752d73f3da3e5e 7959c969e092f2a5a8604e2287807ac5b1b384ad 4 debian-binary
+//		...
+func (v debSignatureVerifier) verifyDpkgSig(ctx context.Context, signature []byte, members []debMember) error {
+	plaintext, err := v.KeyRing.VerifyClearSignedGPGSignatureFrom(ctx, v.TrustedKeys, signature)
+	if err != nil {
+		return err
+	}
+
+	signed := make(map[string]debMember)
+	_, files, _ := strings.Cut(string(plaintext), "\nFiles:")
+	_, files, _ = strings.Cut(files, "\n") // the list starts on the next line
+	for line := range strings.Lines(files) {
+		fields := strings.Fields(line)
+		if len(fields) != 4 || (!strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ")) {
+			break // end of the "Files" field
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid size for %q: %q", fields[3], fields[2])
+		}
+		signed[fields[3]] = debMember{Name: fields[3], SizeBytes: size, MD5: fields[0], SHA1: fields[1]}
+	}
+
+	for _, member := range members {
+		if signed[member.Name] != member {
+			return fmt.Errorf("ar member %q does not match the signed checksums", member.Name)
+		}
+	}
+	return nil
+}
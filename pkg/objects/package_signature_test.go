@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"crypto/md5"  //nolint:gosec // dpkg-sig uses this
+	"crypto/sha1" //nolint:gosec // dpkg-sig uses this
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"go.xyrillian.de/gg/assert"
+
+	"github.com/sapcc/swift-http-import/pkg/util"
+)
+
+func TestRPMSignatureVerifier(t *testing.T) {
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	assert.ErrEqual(t, err, nil)
+	fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+	keyRing := &util.GPGKeyRing{EntityList: openpgp.EntityList{entity}}
+
+	payload := []byte("compressed cpio archive")
+	header := buildRPMHeader(false,
+		rpmTestEntry{Tag: rpmTagPayloadDigestAlgo, Type: 4, Count: 1, Data: binary.BigEndian.AppendUint32(nil, 8)},
+		rpmTestEntry{Tag: rpmTagPayloadDigest, Type: 8, Count: 1, Data: fmt.Appendf(nil, "%x\x00", sha256.Sum256(payload))},
+	)
+	var signature bytes.Buffer
+	assert.ErrEqual(t, openpgp.DetachSign(&signature, entity, bytes.NewReader(header), nil), nil)
+	signedSigHeader := buildRPMHeader(true, rpmTestEntry{Tag: rpmSigTagRSA, Type: 7, Count: uint32(signature.Len()), Data: signature.Bytes()}) //nolint:gosec // test data is small
+	unsignedSigHeader := buildRPMHeader(true)
+
+	verify := func(trustedKey string, packageParts ...[]byte) error {
+		t.Helper()
+		lead := make([]byte, 96)
+		copy(lead, []byte{0xed, 0xab, 0xee, 0xdb})
+		contents := bytes.Join(append([][]byte{lead}, packageParts...), nil)
+
+		v := rpmSignatureVerifier{KeyRing: keyRing, TrustedKeys: util.GPGTrustSet{trustedKey}}
+		r := newSignatureVerifyingReader(t.Context(), io.NopCloser(bytes.NewReader(contents)), v)
+		defer r.Close()
+		_, err := io.ReadAll(r)
+		return err
+	}
+
+	// signed package with trusted key (identified by fingerprint or long key ID)
+	assert.ErrEqual(t, verify(fingerprint, signedSigHeader, header, payload), nil)
+	assert.ErrEqual(t, verify(fingerprint[24:], signedSigHeader, header, payload), nil)
+
+	// signed package with untrusted key
+	assert.ErrEqual(t, verify(strings.Repeat("0", 40), signedSigHeader, header, payload),
+		"package signature verification failed: invalid RPM header signature: signed by untrusted key "+fingerprint)
+
+	// tampered payload
+	assert.ErrEqual(t, verify(fingerprint, signedSigHeader, header, []byte("something else")),
+		fmt.Sprintf("package signature verification failed: invalid RPM payload: sha256 checksum mismatch: expected %x, got %x",
+			sha256.Sum256(payload), sha256.Sum256([]byte("something else"))))
+
+	// unsigned package
+	assert.ErrEqual(t, verify(fingerprint, unsignedSigHeader, header, payload),
+		"package signature verification failed: RPM package is not signed")
+
+	// not an RPM at all
+	v := rpmSignatureVerifier{KeyRing: keyRing, TrustedKeys: util.GPGTrustSet{fingerprint}}
+	assert.ErrEqual(t, v.VerifyPackage(t.Context(), strings.NewReader(strings.Repeat("hello world\n", 10))), "not an RPM package")
+}
+
+type rpmTestEntry struct {
+	Tag, Type, Count uint32
+	Data             []byte
+}
+
+// Builds an RPM header structure. Signature headers are padded to 8 bytes.
+func buildRPMHeader(isSignatureHeader bool, entries ...rpmTestEntry) []byte {
+	var index, store []byte
+	for _, e := range entries {
+		index = binary.BigEndian.AppendUint32(index, e.Tag)
+		index = binary.BigEndian.AppendUint32(index, e.Type)
+		index = binary.BigEndian.AppendUint32(index, uint32(len(store))) //nolint:gosec // test data is small
+		index = binary.BigEndian.AppendUint32(index, e.Count)
+		store = append(store, e.Data...)
+	}
+	result := []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+	result = binary.BigEndian.AppendUint32(result, uint32(len(entries))) //nolint:gosec // test data is small
+	result = binary.BigEndian.AppendUint32(result, uint32(len(store)))   //nolint:gosec // test data is small
+	result = append(result, index...)
+	result = append(result, store...)
+	for isSignatureHeader && len(store)%8 != 0 {
+		result = append(result, 0)
+		store = append(store, 0)
+	}
+	return result
+}
+
+func TestDebSignatureVerifier(t *testing.T) {
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	assert.ErrEqual(t, err, nil)
+	fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+	keyRing := &util.GPGKeyRing{EntityList: openpgp.EntityList{entity}}
+
+	members := []struct{ Name, Contents string }{
+		{"debian-binary", "2.0\n"},
+		{"control.tar.xz", "control files"},
+		{"data.tar.xz", "data files (odd length)"},
+	}
+	buildPackage := func(tamper bool, signatures map[string][]byte) []byte {
+		var buf bytes.Buffer
+		buf.WriteString("!<arch>\n")
+		writeMember := func(name string, contents []byte) {
+			fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "100644", len(contents))
+			buf.Write(contents)
+			if len(contents)%2 == 1 {
+				buf.WriteString("\n")
+			}
+		}
+		for _, m := range members {
+			if tamper && m.Name == "data.tar.xz" {
+				m.Contents = strings.ToUpper(m.Contents)
+			}
+			writeMember(m.Name, []byte(m.Contents))
+		}
+		for name, signature := range signatures {
+			writeMember(name, signature)
+		}
+		return buf.Bytes()
+	}
+	verify := func(trustedKey string, contents []byte) error {
+		v := debSignatureVerifier{KeyRing: keyRing, TrustedKeys: util.GPGTrustSet{trustedKey}}
+		return v.VerifyPackage(t.Context(), bytes.NewReader(contents))
+	}
+
+	// debsig: detached signature of the concatenated members
+	var signedData bytes.Buffer
+	for _, m := range members {
+		signedData.WriteString(m.Contents)
+	}
+	var debsig bytes.Buffer
+	assert.ErrEqual(t, openpgp.ArmoredDetachSign(&debsig, entity, bytes.NewReader(signedData.Bytes()), nil), nil)
+	debsigPackage := map[string][]byte{"_gpgorigin": debsig.Bytes()}
+	assert.ErrEqual(t, verify(fingerprint, buildPackage(false, debsigPackage)), nil)
+	assert.ErrEqual(t, verify(strings.Repeat("0", 16), buildPackage(false, debsigPackage)),
+		"no valid signature by a trusted key: _gpgorigin: signed by untrusted key "+fingerprint)
+	assert.ErrEqual(t, verify(fingerprint, buildPackage(true, debsigPackage)),
+		"no valid signature by a trusted key: _gpgorigin: OpenPGP signature is invalid or was made by an unknown key")
+
+	// debsig by a key that has expired after signing the package
+	keyCreationTime := time.Now().Add(-48 * time.Hour)
+	expiredConfig := &packet.Config{
+		Time:            func() time.Time { return keyCreationTime },
+		KeyLifetimeSecs: 3600,
+	}
+	expiredEntity, err := openpgp.NewEntity("Expired", "", "expired@example.com", expiredConfig)
+	assert.ErrEqual(t, err, nil)
+	var expiredDebsig bytes.Buffer
+	assert.ErrEqual(t, openpgp.ArmoredDetachSign(&expiredDebsig, expiredEntity, bytes.NewReader(signedData.Bytes()), expiredConfig), nil)
+	v := debSignatureVerifier{
+		KeyRing:     &util.GPGKeyRing{EntityList: openpgp.EntityList{expiredEntity}},
+		TrustedKeys: util.GPGTrustSet{fmt.Sprintf("%X", expiredEntity.PrimaryKey.Fingerprint)},
+	}
+	err = v.VerifyPackage(t.Context(), bytes.NewReader(buildPackage(false, map[string][]byte{"_gpgorigin": expiredDebsig.Bytes()})))
+	assert.ErrEqual(t, err, "no valid signature by a trusted key: _gpgorigin: openpgp: key expired")
+
+	// dpkg-sig: clear-signed checksums of the members
+	var manifest strings.Builder
+	manifest.WriteString("Version: 4\nSigner: \nDate: Sat Oct 17 09:00:00 2026\nRole: builder\nFiles: \n")
+	for _, m := range members {
+		fmt.Fprintf(&manifest, "\t%x %x %d %s\n", md5.Sum([]byte(m.Contents)), sha1.Sum([]byte(m.Contents)), len(m.Contents), m.Name) //nolint:gosec // see import
+	}
+	var dpkgSig bytes.Buffer
+	w, err := clearsign.Encode(&dpkgSig, entity.PrivateKey, nil)
+	assert.ErrEqual(t, err, nil)
+	_, err = w.Write([]byte(manifest.String()))
+	assert.ErrEqual(t, err, nil)
+	assert.ErrEqual(t, w.Close(), nil)
+	dpkgSigPackage := map[string][]byte{"_gpgbuilder": dpkgSig.Bytes()}
+	assert.ErrEqual(t, verify(fingerprint, buildPackage(false, dpkgSigPackage)), nil)
+	assert.ErrEqual(t, verify(fingerprint, buildPackage(true, dpkgSigPackage)),
+		`no valid signature by a trusted key: _gpgbuilder: ar member "data.tar.xz" does not match the signed checksums`)
+
+	// unsigned package
+	assert.ErrEqual(t, verify(fingerprint, buildPackage(false, nil)), "Debian package is not signed")
+}
@@ -0,0 +1,262 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // the compact index uses MD5 to refer to info files
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/sapcc/go-bits/regexpext"
+	. "go.xyrillian.de/gg/option"
+	"go.xyrillian.de/schwift/v2"
+)
+
+// RubyGemsSource is a URLSource containing a RubyGems repository with a
+// compact index (as used by Bundler). This type reuses the Validate() and
+// Connect() logic of URLSource, but adds a custom scraping implementation that
+// reads the compact index instead of relying on directory listings.
+//
+// Only the configured gems are transferred, and the compact index files are
+// rewritten to only contain the transferred gems and versions.
+type RubyGemsSource struct {
+	// options from config file
+	URLString                string        `yaml:"url"`
+	ClientCertificatePath    string        `yaml:"cert"`
+	ClientCertificateKeyPath string        `yaml:"key"`
+	ServerCAPath             string        `yaml:"ca"`
+	Gems                     []PackageSpec `yaml:"gems"`
+	IncludePrerelease        bool          `yaml:"include_prerelease"`
+	// compiled configuration
+	urlSource *URLSource `yaml:"-"`
+}
+
+// PackageSpec appears in the configuration of source types for language
+// package registries. It selects all versions of the package with the given
+// name that match the optional version regex.
+type PackageSpec struct {
+	Name     string                          `yaml:"name"`
+	Versions Option[regexpext.BoundedRegexp] `yaml:"versions"`
+}
+
+// Validate implements the Source interface.
+func (s *RubyGemsSource) Validate(name string) []error {
+	s.urlSource = &URLSource{
+		URLString:                s.URLString,
+		ClientCertificatePath:    s.ClientCertificatePath,
+		ClientCertificateKeyPath: s.ClientCertificateKeyPath,
+		ServerCAPath:             s.ServerCAPath,
+	}
+	errs := s.urlSource.Validate(name)
+	errs = append(errs, validatePackageSpecs(s.Gems, name+".gems")...)
+	return errs
+}
+
+func validatePackageSpecs(specs []PackageSpec, name string) (errs []error) {
+	if len(specs) == 0 {
+		errs = append(errs, fmt.Errorf("missing value for %s", name))
+	}
+	for idx, spec := range specs {
+		if spec.Name == "" {
+			errs = append(errs, fmt.Errorf("missing value for %s[%d].name", name, idx))
+		}
+	}
+	return errs
+}
+
+// Connect implements the Source interface.
+func (s *RubyGemsSource) Connect(ctx context.Context, name string) error {
+	return s.urlSource.Connect(ctx, name)
+}
+
+// ListEntries implements the Source interface.
+func (s *RubyGemsSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+// GetFile implements the Source interface.
+func (s *RubyGemsSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	return s.urlSource.GetFile(ctx, path, requestHeaders)
+}
+
+// ListAllFiles implements the Source interface.
+func (s *RubyGemsSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	cache := make(map[string]FileSpec)
+
+	// parse the versions file to find which versions exist (and have not been
+	// yanked), and which checksum each info file has
+	versionsBuf, versionsURI, lerr := s.urlSource.getFileContents(ctx, "versions", cache)
+	if lerr != nil {
+		return lerr
+	}
+	versionsFile, err := parseRubyGemsVersionsFile(versionsBuf)
+	if err != nil {
+		return &ListEntriesError{Location: versionsURI, Message: "error while parsing compact index", Inner: err}
+	}
+
+	// the compact index files are transferred at the very end, when all gems
+	// have already been uploaded (to avoid situations where a client might see
+	// repository metadata without being able to see the referenced gems)
+	var metadataFiles []FileSpec
+	var versionsLines []string
+	var names []string
+
+	for _, gem := range s.Gems {
+		gemVersions, exists := versionsFile.Gems[gem.Name]
+		if !exists {
+			return &ListEntriesError{Location: versionsURI, Message: fmt.Sprintf("gem %q not found in compact index", gem.Name)}
+		}
+
+		infoPath := path.Join("info", gem.Name)
+		infoBuf, infoURI, lerr := s.urlSource.getFileContents(ctx, infoPath, cache)
+		if lerr != nil {
+			return lerr
+		}
+		err := (Checksum{Algorithm: "md5", Value: gemVersions.InfoChecksum}).Verify(infoBuf)
+		if err != nil {
+			return &ListEntriesError{Location: infoURI, Message: "info file does not match compact index", Inner: err}
+		}
+
+		// select versions and rewrite the info file accordingly
+		var (
+			selectedVersions []string
+			filteredInfo     bytes.Buffer
+		)
+		filteredInfo.WriteString("---\n")
+		for line := range strings.SplitSeq(string(infoBuf), "\n") {
+			entry, ok := parseRubyGemsInfoLine(line)
+			if !ok {
+				continue
+			}
+			if !gemVersions.Exists[entry.Version] {
+				continue // yanked
+			}
+			if !s.IncludePrerelease && rubyGemsPrereleaseRx.MatchString(entry.Version) {
+				continue
+			}
+			if rx, ok := gem.Versions.Unpack(); ok && !rx.MatchString(entry.Version) {
+				continue
+			}
+
+			spec := FileSpec{Path: path.Join("gems", gem.Name+"-"+entry.Version+".gem")}
+			if entry.SHA256 != "" {
+				spec.ExpectedChecksum = &Checksum{Algorithm: "sha256", Value: entry.SHA256}
+			}
+			out <- spec
+
+			selectedVersions = append(selectedVersions, entry.Version)
+			filteredInfo.WriteString(line)
+			filteredInfo.WriteString("\n")
+		}
+
+		infoContents := filteredInfo.Bytes()
+		metadataFiles = append(metadataFiles, generatedFileSpec(infoPath, infoContents, "text/plain; charset=utf-8"))
+		if len(selectedVersions) > 0 {
+			versionsLines = append(versionsLines, fmt.Sprintf("%s %s %x", gem.Name, strings.Join(selectedVersions, ","), md5.Sum(infoContents))) //nolint:gosec // see import
+			names = append(names, gem.Name)
+		}
+	}
+
+	namesContents := "---\n" + strings.Join(names, "\n") + "\n"
+	metadataFiles = append(metadataFiles, generatedFileSpec("names", []byte(namesContents), "text/plain; charset=utf-8"))
+	versionsContents := versionsFile.Header + strings.Join(versionsLines, "\n") + "\n"
+	metadataFiles = append(metadataFiles, generatedFileSpec("versions", []byte(versionsContents), "text/plain; charset=utf-8"))
+
+	for _, file := range metadataFiles {
+		out <- file
+	}
+	return nil
+}
+
+// Matches the version part of a gem version that may have a platform suffix,
+// e.g. "1.15.0" in "1.15.0-x86_64-linux", if it is a prerelease version
+// (i.e. contains a letter).
+var rubyGemsPrereleaseRx = regexp.MustCompile(`^[^-]*[a-zA-Z]`)
+
+type rubyGemsVersionsFile struct {
+	// everything up to and including the "---" line
+	Header string
+	Gems   map[string]rubyGemsVersions
+}
+
+type rubyGemsVersions struct {
+	Exists       map[string]bool
+	InfoChecksum string
+}
+
+// parseRubyGemsVersionsFile parses the "versions" file of a compact index.
+// Each line looks like "<name> <version>,<version>,... <md5 of info file>".
+// Versions with a "-" prefix have been yanked. Lines for the same gem can
+// appear multiple times, in which case later lines amend earlier ones.
+func parseRubyGemsVersionsFile(buf []byte) (rubyGemsVersionsFile, error) {
+	result := rubyGemsVersionsFile{Gems: make(map[string]rubyGemsVersions)}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Buffer(nil, 16<<20) // some lines are very long
+	inHeader := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inHeader {
+			result.Header += line + "\n"
+			if line == "---" {
+				inHeader = false
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return result, fmt.Errorf("malformed line in versions file: %q", line)
+		}
+		gem, exists := result.Gems[fields[0]]
+		if !exists {
+			gem.Exists = make(map[string]bool)
+		}
+		for version := range strings.SplitSeq(fields[1], ",") {
+			if yankedVersion, ok := strings.CutPrefix(version, "-"); ok {
+				delete(gem.Exists, yankedVersion)
+			} else {
+				gem.Exists[version] = true
+			}
+		}
+		gem.InfoChecksum = fields[2]
+		result.Gems[fields[0]] = gem
+	}
+	if inHeader {
+		return result, fmt.Errorf("missing %q line in versions file", "---")
+	}
+	return result, scanner.Err()
+}
+
+type rubyGemsInfoEntry struct {
+	Version string
+	SHA256  string
+}
+
+// parseRubyGemsInfoLine parses a line from an info file in a compact index,
+// e.g. "1.0.0 dep1:>= 1.0,dep2:~> 2.1|checksum:<sha256>,ruby:>= 2.7.0".
+// Returns false for lines that do not describe a version.
+func parseRubyGemsInfoLine(line string) (rubyGemsInfoEntry, bool) {
+	if line == "" || line == "---" {
+		return rubyGemsInfoEntry{}, false
+	}
+	version, rest, _ := strings.Cut(line, " ")
+	entry := rubyGemsInfoEntry{Version: version}
+
+	_, requirements, _ := strings.Cut(rest, "|")
+	for requirement := range strings.SplitSeq(requirements, ",") {
+		if value, ok := strings.CutPrefix(requirement, "checksum:"); ok {
+			entry.SHA256 = value
+		}
+	}
+	return entry, true
+}
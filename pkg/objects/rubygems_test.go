@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"testing"
+
+	"github.com/sapcc/go-bits/must"
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestParseRubyGemsVersionsFile(t *testing.T) {
+	input := "created_at: 2024-01-01T00:00:00Z\n---\n" +
+		"foo 1.0.0,1.1.0,2.0.0.rc1 0123456789abcdef0123456789abcdef\n" +
+		"bar 0.1.0 fedcba9876543210fedcba9876543210\n" +
+		"foo -1.1.0,1.2.0 00112233445566778899aabbccddeeff\n"
+
+	file := must.ReturnT(parseRubyGemsVersionsFile([]byte(input)))(t)
+	assert.Equal(t, file.Header, "created_at: 2024-01-01T00:00:00Z\n---\n")
+	assert.Equal(t, file.Gems["foo"].Exists, map[string]bool{"1.0.0": true, "2.0.0.rc1": true, "1.2.0": true})
+	assert.Equal(t, file.Gems["foo"].InfoChecksum, "00112233445566778899aabbccddeeff")
+	assert.Equal(t, file.Gems["bar"].Exists, map[string]bool{"0.1.0": true})
+}
+
+func TestParseRubyGemsInfoLine(t *testing.T) {
+	entry, ok := parseRubyGemsInfoLine("1.0.0 dep1:>= 1.0,dep2:~> 2.1|checksum:abcdef,ruby:>= 2.7.0")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, entry, rubyGemsInfoEntry{Version: "1.0.0", SHA256: "abcdef"})
+
+	entry, ok = parseRubyGemsInfoLine("1.0.0-x86_64-linux |checksum:abcdef")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, entry.Version, "1.0.0-x86_64-linux")
+
+	_, ok = parseRubyGemsInfoLine("---")
+	assert.Equal(t, ok, false)
+}
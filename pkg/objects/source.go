@@ -7,6 +7,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -48,6 +49,14 @@ type Source interface {
 	GetFile(ctx context.Context, path string, headers schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error)
 }
 
+// CompletedRunRecorder is an optional interface for Source implementations
+// that need to know whether the previous run of their job was complete.
+// RecordCompletedRun() is called once all files of the job have been
+// transferred without errors (and after the cleanup, if any).
+type CompletedRunRecorder interface {
+	RecordCompletedRun(ctx context.Context) error
+}
+
 // ListEntriesError is an error that occurs while scraping a directory.
 type ListEntriesError struct {
 	// the location of the directory (e.g. an URL)
@@ -74,8 +83,28 @@ func (e ListEntriesError) FullMessage() string {
 // by an Inner error.
 const (
 	ErrMessageGPGVerificationFailed = "error while verifying GPG signature"
+	ErrMessageStaleMetadata         = "refusing to use expired or outdated repository metadata"
+	ErrMessageRateLimited           = "deferring job until the API rate limit resets"
 )
 
+// HTTPStatusError appears as the Inner error of a ListEntriesError when a
+// request was answered with an error status.
+type HTTPStatusError struct {
+	Method     string
+	StatusCode int
+}
+
+// Error implements the builtin/error interface.
+func (e HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.Method, e.StatusCode)
+}
+
+// isNotFound returns whether this error was caused by a 404 response.
+func (e ListEntriesError) isNotFound() bool {
+	var herr HTTPStatusError
+	return errors.As(e.Inner, &herr) && herr.StatusCode == http.StatusNotFound
+}
+
 // ErrListAllFilesNotSupported is returned by ListAllFiles() for sources that
 // only support ListEntries().
 var ErrListAllFilesNotSupported = &ListEntriesError{
@@ -323,7 +352,13 @@ func (u URLSource) ListEntries(ctx context.Context, directoryPath string) ([]Fil
 
 // GetFile implements the Source interface.
 func (u URLSource) GetFile(ctx context.Context, filePath string, requestHeaders schwift.ObjectHeaders) (respBody io.ReadCloser, fileState FileState, err error) {
-	uri := u.getURLForPath(filePath).String()
+	return u.getFileFromURL(ctx, u.getURLForPath(filePath).String(), requestHeaders)
+}
+
+// Like GetFile, but takes a full URL instead of a path below this URLSource.
+// This is used by custom source types whose files are referenced by full URL
+// in the repository metadata.
+func (u URLSource) getFileFromURL(ctx context.Context, uri string, requestHeaders schwift.ObjectHeaders) (respBody io.ReadCloser, fileState FileState, err error) {
 	requestHeaders.Set("User-Agent", "swift-http-import/"+bininfo.VersionOr("dev"))
 
 	// retrieve file from source
@@ -375,33 +410,118 @@ func (u URLSource) getURLForPath(filePath string) *url.URL {
 
 // Helper function for custom source types.
 func (u URLSource) getFileContents(ctx context.Context, filePath string, cache map[string]FileSpec) (contents []byte, uri string, e *ListEntriesError) {
-	uri = u.getURLForPath(filePath).String()
+	reader, uri, lerr := u.openFileContents(ctx, filePath, FileSpec{}, cache)
+	if lerr != nil {
+		return nil, uri, lerr
+	}
+	defer reader.Close()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	contents, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, uri, &ListEntriesError{uri, "GET failed", err}
+		return nil, uri, &ListEntriesError{uri, "cannot read cached file", err}
 	}
+	return contents, uri, nil
+}
 
-	resp, err := u.HTTPClient.Do(req)
+// Helper function for custom source types. Like getFileContents, but returns
+// a reader for the contents instead of the contents themselves. Large files
+// are written to the spool directly from the response body, so that they are
+// never held in memory as a whole.
+//
+// If `expected` has a checksum or size, the contents are verified against it
+// while they are being downloaded.
+func (u URLSource) openFileContents(ctx context.Context, filePath string, expected FileSpec, cache map[string]FileSpec) (contents io.ReadCloser, uri string, e *ListEntriesError) {
+	uri = u.getURLForPath(filePath).String()
+	body, headers, lerr := u.openURL(ctx, uri)
+	if lerr != nil {
+		return nil, uri, lerr
+	}
+	defer body.Close()
+	verifier, err := newVerifyingReader(body, expected)
 	if err != nil {
 		return nil, uri, &ListEntriesError{uri, "GET failed", err}
 	}
-	defer resp.Body.Close()
 
-	result, err := io.ReadAll(resp.Body)
+	spec := FileSpec{
+		Path:    filePath,
+		Headers: headers,
+	}
+	if activeSpool == nil {
+		spec.Contents, err = io.ReadAll(verifier)
+	} else {
+		// large files are kept on disk until they are transferred
+		spec.Contents, spec.SpoolPath, err = activeSpool.StoreFrom(verifier)
+	}
 	if err != nil {
 		return nil, uri, &ListEntriesError{uri, "GET failed", err}
 	}
+	cache[filePath] = spec
+
+	reader, err := spec.openContents()
+	if err != nil {
+		return nil, uri, &ListEntriesError{uri, "cannot read cached file", err}
+	}
+	return reader, uri, nil
+}
+
+// Helper function for custom source types. Like getFileContents, but takes a
+// full URL instead of a path below this URLSource, and does not cache the result.
+func (u URLSource) getURLContents(ctx context.Context, uri string) (contents []byte, headers http.Header, e *ListEntriesError) {
+	body, headers, lerr := u.openURL(ctx, uri)
+	if lerr != nil {
+		return nil, nil, lerr
+	}
+	defer body.Close()
+
+	result, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, &ListEntriesError{uri, "GET failed", err}
+	}
+	return result, headers, nil
+}
+
+// Helper function for custom source types. Like getURLContents, but returns
+// the response body instead of reading it into memory. The caller must close
+// the body.
+func (u URLSource) openURL(ctx context.Context, uri string) (body io.ReadCloser, headers http.Header, e *ListEntriesError) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return nil, nil, &ListEntriesError{uri, "GET failed", err}
+	}
+
+	resp, err := u.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, &ListEntriesError{uri, "GET failed", err}
+	}
 	if resp.StatusCode >= http.StatusBadRequest {
-		//NOTE: do not change the error string as YumSource.ListAllFiles() has behavior that depends on it.
-		return nil, uri, &ListEntriesError{uri, fmt.Sprintf("GET returned status %d", resp.StatusCode), nil}
+		resp.Body.Close()
+		return nil, nil, &ListEntriesError{uri, "", HTTPStatusError{http.MethodGet, resp.StatusCode}}
 	}
 
-	cache[filePath] = FileSpec{
-		Path:     filePath,
-		Contents: result,
-		Headers:  resp.Header,
+	return resp.Body, resp.Header, nil
+}
+
+// Helper function for custom source types. Checks whether the given file
+// exists without downloading it.
+func (u URLSource) fileExists(ctx context.Context, filePath string) (bool, *ListEntriesError) {
+	uri := u.getURLForPath(filePath).String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uri, http.NoBody)
+	if err != nil {
+		return false, &ListEntriesError{uri, "HEAD failed", err}
 	}
 
-	return result, uri, nil
+	resp, err := u.HTTPClient.Do(req)
+	if err != nil {
+		return false, &ListEntriesError{uri, "HEAD failed", err}
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= http.StatusBadRequest:
+		return false, &ListEntriesError{uri, fmt.Sprintf("HEAD returned status %d", resp.StatusCode), nil}
+	default:
+		return true, nil
+	}
 }
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// SpoolConfiguration contains the configuration options relating to the
+// spooling of cached metadata files to disk.
+//
+// Custom source types download repository metadata during scraping, and hold
+// on to it until it is transferred, to ensure that the transferred metadata
+// is consistent with the transferred packages (see getFileSpec()). For large
+// repositories, this can add up to a lot of memory, so files above the
+// threshold are written to a temporary directory instead.
+type SpoolConfiguration struct {
+	// the directory in which the spool directory is created (default: os.TempDir())
+	Directory string `yaml:"directory"`
+	// files of at least this size are spooled to disk (default: 1 MiB)
+	ThresholdBytes *uint64 `yaml:"threshold_bytes"`
+}
+
+// spool is a temporary directory that holds the contents of cached files.
+type spool struct {
+	Path           string
+	ThresholdBytes uint64
+	fileCounter    atomic.Uint64
+}
+
+// activeSpool is set by ReadConfiguration(). While it is nil (e.g. in unit
+// tests), cached files are always held in memory.
+var activeSpool *spool
+
+// Helper function for ReadConfiguration().
+func (c SpoolConfiguration) open() error {
+	threshold := uint64(1 << 20)
+	if c.ThresholdBytes != nil {
+		threshold = *c.ThresholdBytes
+	}
+	dir := c.Directory
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	removeStaleSpools(dir)
+
+	// (the PID in the directory name is used by removeStaleSpools() to find
+	// out whether the directory is still in use)
+	path, err := os.MkdirTemp(dir, fmt.Sprintf("swift-http-import-spool-%d-", os.Getpid()))
+	if err != nil {
+		return fmt.Errorf("cannot create spool directory: %w", err)
+	}
+	logg.Debug("spooling cached files of at least %d bytes to %s", threshold, path)
+	activeSpool = &spool{Path: path, ThresholdBytes: threshold}
+	return nil
+}
+
+var spoolDirectoryNameRx = regexp.MustCompile(`^swift-http-import-spool-(\d+)-\d+$`)
+
+// Helper function for SpoolConfiguration.open().
+//
+// RemoveSpool() does not run when the process is killed or exits through
+// logg.Fatal(), so spool directories of processes that are no longer running
+// are removed on startup instead.
+func removeStaleSpools(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logg.Error("cannot look for stale spool directories in %s: %s", dir, err.Error())
+		return
+	}
+	for _, entry := range entries {
+		match := spoolDirectoryNameRx.FindStringSubmatch(entry.Name())
+		if !entry.IsDir() || match == nil {
+			continue
+		}
+		pid, err := strconv.Atoi(match[1])
+		// (a directory with our own PID is from a previous process with the same
+		// PID, which is common in containers)
+		if err != nil || (pid != os.Getpid() && isProcessRunning(pid)) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		logg.Info("removing stale spool directory %s", path)
+		err = os.RemoveAll(path)
+		if err != nil {
+			logg.Error("cannot remove stale spool directory: %s", err.Error())
+		}
+	}
+}
+
+// Helper function for removeStaleSpools(). If in doubt (e.g. when the process
+// belongs to another user), the process is assumed to be running.
+func isProcessRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// RemoveSpool removes the spool directory (if any) with all files in it. This
+// must be called before the process exits.
+func RemoveSpool() {
+	if activeSpool == nil {
+		return
+	}
+	err := os.RemoveAll(activeSpool.Path)
+	if err != nil {
+		logg.Error("cannot remove spool directory: %s", err.Error())
+	}
+	activeSpool = nil
+}
+
+// StoreFrom reads the given reader until EOF. If the contents are smaller than
+// the threshold, they are returned. Otherwise, they are copied into a new file
+// in this spool without holding them in memory, and the path to that file is
+// returned instead.
+func (s *spool) StoreFrom(r io.Reader) (contents []byte, path string, err error) {
+	contents, err = io.ReadAll(io.LimitReader(r, int64(min(s.ThresholdBytes, math.MaxInt64))))
+	if err != nil || uint64(len(contents)) < s.ThresholdBytes {
+		return contents, "", err
+	}
+
+	path = filepath.Join(s.Path, fmt.Sprintf("%08d", s.fileCounter.Add(1)))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot write to spool directory: %w", err)
+	}
+	_, err = file.Write(contents)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	cerr := file.Close()
+	if err == nil && cerr != nil {
+		err = fmt.Errorf("cannot write to spool directory: %w", cerr)
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, "", err
+	}
+	return nil, path, nil
+}
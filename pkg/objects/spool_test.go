@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.xyrillian.de/gg/assert"
+	"go.xyrillian.de/schwift/v2"
+)
+
+func TestSpooledFileSpec(t *testing.T) {
+	s := &spool{Path: t.TempDir()}
+	_, path, err := s.StoreFrom(strings.NewReader("Hello World\n"))
+	assert.ErrEqual(t, err, nil)
+
+	hdr := make(http.Header)
+	hdr.Set("Etag", `"abc"`)
+	spec := FileSpec{Path: "repodata/primary.xml.gz", Headers: hdr, SpoolPath: path}
+
+	// the contents are streamed from the spool file
+	body, sourceState, err := spec.toTransferFormat(schwift.NewObjectHeaders())
+	assert.ErrEqual(t, err, nil)
+	contents, err := io.ReadAll(body)
+	assert.ErrEqual(t, err, nil)
+	assert.ErrEqual(t, body.Close(), nil)
+	assert.Equal(t, string(contents), "Hello World\n")
+	assert.Equal(t, *sourceState.SizeBytes, uint64(12))
+	assert.Equal(t, sourceState.SkipTransfer, false)
+
+	// the spool file can be read again (e.g. when the same file is transferred
+	// to another path)
+	requestHeaders := schwift.NewObjectHeaders()
+	requestHeaders.Set("If-None-Match", `"abc"`)
+	body, sourceState, err = spec.toTransferFormat(requestHeaders)
+	assert.ErrEqual(t, err, nil)
+	assert.ErrEqual(t, body.Close(), nil)
+	assert.Equal(t, sourceState.SkipTransfer, true)
+}
+
+func TestSpoolStoreFrom(t *testing.T) {
+	s := &spool{Path: t.TempDir(), ThresholdBytes: 8}
+
+	// small files are returned as is
+	contents, path, err := s.StoreFrom(strings.NewReader("Hello"))
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, string(contents), "Hello")
+	assert.Equal(t, path, "")
+
+	// large files are copied into the spool
+	contents, path, err = s.StoreFrom(strings.NewReader("Hello World\n"))
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, len(contents), 0)
+	buf, err := os.ReadFile(path)
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, string(buf), "Hello World\n")
+}
+
+func TestRemoveStaleSpools(t *testing.T) {
+	// find the PID of a process that is not running anymore
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run a process: %s", err.Error())
+	}
+	dir := t.TempDir()
+	staleDir := filepath.Join(dir, fmt.Sprintf("swift-http-import-spool-%d-1234", cmd.Process.Pid))
+	activeDir := filepath.Join(dir, fmt.Sprintf("swift-http-import-spool-%d-1234", os.Getppid()))
+	otherDir := filepath.Join(dir, "swift-http-import-spool-1234")
+	for _, path := range []string{staleDir, activeDir, otherDir} {
+		assert.ErrEqual(t, os.MkdirAll(filepath.Join(path, "subdir"), 0o700), nil)
+	}
+
+	removeStaleSpools(dir)
+	_, err := os.Stat(staleDir)
+	assert.Equal(t, os.IsNotExist(err), true)
+	_, err = os.Stat(activeDir)
+	assert.ErrEqual(t, err, nil)
+	_, err = os.Stat(otherDir)
+	assert.ErrEqual(t, err, nil)
+}
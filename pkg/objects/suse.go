@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/regexpext"
+	"github.com/sapcc/go-bits/secrets"
+	"go.xyrillian.de/schwift/v2"
+)
+
+// SUSEServiceSource is a URLSource containing a SUSE repository index service
+// (as used by openSUSE and SLES), i.e. a repoindex.xml file that lists a
+// number of Yum repositories. Each of these repositories is transferred like
+// a YumSource (with the same options) into its own subdirectory of the
+// target, and the repoindex.xml is rewritten to refer to these
+// subdirectories.
+type SUSEServiceSource struct {
+	// options from config file (the options of YumSource apply to each repository)
+	YumSource    `yaml:",inline"`
+	Repositories []regexpext.BoundedRegexp `yaml:"repos"`
+	// the repositories of the service by the path of their subdirectory, for
+	// forwarding GetFile() to the right repository; filled during ListAllFiles()
+	repos      map[string]*YumSource `yaml:"-"`
+	reposMutex sync.RWMutex          `yaml:"-"`
+}
+
+// The location of the repository index, relative to the service URL.
+const suseRepoIndexPath = "repo/repoindex.xml"
+
+// Validate implements the Source interface.
+func (s *SUSEServiceSource) Validate(name string) []error {
+	errs := s.YumSource.Validate(name)
+	if s.Metalink != "" {
+		errs = append(errs, fmt.Errorf("invalid value for %s.metalink: not supported for SUSE services", name))
+	}
+	if s.Mirrorlist != "" {
+		errs = append(errs, fmt.Errorf("invalid value for %s.mirrorlist: not supported for SUSE services", name))
+	}
+	return errs
+}
+
+// Connect implements the Source interface.
+func (s *SUSEServiceSource) Connect(ctx context.Context, name string) error {
+	return s.YumSource.Connect(ctx, name)
+}
+
+// ListEntries implements the Source interface.
+func (s *SUSEServiceSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
+	return nil, ErrListEntriesNotSupported
+}
+
+// GetFile implements the Source interface.
+func (s *SUSEServiceSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	s.reposMutex.RLock()
+	defer s.reposMutex.RUnlock()
+
+	// if repositories are nested, the innermost repository is responsible
+	var (
+		repo     *YumSource
+		repoPath string
+	)
+	for dirPath, candidate := range s.repos {
+		if strings.HasPrefix(path, dirPath) && len(dirPath) > len(repoPath) {
+			repo, repoPath = candidate, dirPath
+		}
+	}
+	if repo == nil {
+		return s.urlSource.GetFile(ctx, path, requestHeaders)
+	}
+	return repo.GetFile(ctx, strings.TrimPrefix(path, repoPath), requestHeaders)
+}
+
+// RecordCompletedRun implements the CompletedRunRecorder interface.
+func (s *SUSEServiceSource) RecordCompletedRun(ctx context.Context) error {
+	s.reposMutex.RLock()
+	defer s.reposMutex.RUnlock()
+	for _, repo := range s.repos {
+		err := repo.RecordCompletedRun(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function for JobConfiguration.Compile().
+func (s *SUSEServiceSource) fingerprintOptions() any {
+	return []any{s.YumSource.fingerprintOptions(), s.Repositories}
+}
+
+// suseRepoIndex contains the attributes of the root element of a
+// repoindex.xml file. These can be referenced as variables like "%{disturl}"
+// in the attributes of the repositories.
+type suseRepoIndex struct {
+	Attributes []xml.Attr `xml:",any,attr"`
+}
+
+var suseRepoIndexVariableRx = regexp.MustCompile(`%\{(\w+)\}`)
+
+// Expand replaces references to variables in the given attribute value.
+func (i suseRepoIndex) Expand(value string) string {
+	return suseRepoIndexVariableRx.ReplaceAllStringFunc(value, func(match string) string {
+		name := match[2 : len(match)-1]
+		for _, attr := range i.Attributes {
+			if attr.Name.Local == name {
+				return attr.Value
+			}
+		}
+		return match
+	})
+}
+
+// ListAllFiles implements the Source interface.
+func (s *SUSEServiceSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *ListEntriesError {
+	cache := make(map[string]FileSpec)
+
+	var index suseRepoIndex
+	indexBytes, indexURI, lerr := s.downloadAndParseXML(ctx, s.urlSource, suseRepoIndexPath, &index, cache)
+	if lerr != nil {
+		return lerr
+	}
+	doc, err := parseRawXMLDocument(indexBytes)
+	if err != nil {
+		return &ListEntriesError{Location: indexURI, Message: "error while parsing XML", Inner: err}
+	}
+
+	s.reposMutex.Lock()
+	s.repos = make(map[string]*YumSource)
+	s.reposMutex.Unlock()
+
+	var selectedRepos []rawXMLElement
+	for _, child := range doc.Children {
+		if child.Start.Name.Local != "repo" || !s.selectsRepository(child) {
+			continue
+		}
+		repoURL, dirPath, err := s.resolveRepository(index, child)
+		if err != nil {
+			return &ListEntriesError{Location: indexURI, Message: "invalid repository entry", Inner: err}
+		}
+		lerr := s.listRepositoryFiles(ctx, repoURL, dirPath, out)
+		if lerr != nil {
+			return lerr
+		}
+		selectedRepos = append(selectedRepos, rewriteSUSERepoIndexEntry(child, dirPath))
+	}
+
+	// transfer repoindex.xml at the very end, when all repositories have
+	// already been uploaded (to avoid situations where a client might see
+	// repository metadata without being able to see the referenced packages)
+	out <- generatedFileSpec(suseRepoIndexPath, doc.Serialize(selectedRepos), "application/xml")
+	return nil
+}
+
+// Helper function for SUSEServiceSource.ListAllFiles().
+//
+// If `repos` is given, repositories are selected by their alias. Otherwise
+// all repositories are selected that are not explicitly disabled (e.g.
+// debuginfo and source repositories).
+func (s *SUSEServiceSource) selectsRepository(entry rawXMLElement) bool {
+	if len(s.Repositories) == 0 {
+		return entry.Attr("enabled") != "false"
+	}
+	alias := entry.Attr("alias")
+	return slices.ContainsFunc(s.Repositories, func(rx regexpext.BoundedRegexp) bool {
+		return rx.MatchString(alias)
+	})
+}
+
+// Helper function for SUSEServiceSource.ListAllFiles().
+//
+// Returns the URL of the given repository, and the path of the subdirectory
+// of the target into which it is transferred: Repositories below the service
+// URL keep their relative path, all others are placed in a subdirectory named
+// after their alias.
+func (s *SUSEServiceSource) resolveRepository(index suseRepoIndex, entry rawXMLElement) (repoURL, dirPath string, err error) {
+	alias := entry.Attr("alias")
+	switch {
+	case entry.Attr("url") != "":
+		repoURL = index.Expand(entry.Attr("url"))
+	case entry.Attr("path") != "":
+		repoURL = s.urlSource.getURLForPath(index.Expand(entry.Attr("path"))).String()
+	default:
+		return "", "", fmt.Errorf("repository %q has neither url nor path", alias)
+	}
+	if !strings.HasSuffix(repoURL, "/") {
+		repoURL += "/"
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", fmt.Errorf("repository %q has invalid URL: %w", alias, err)
+	}
+
+	dirPath, isBelowService := strings.CutPrefix(u.String(), s.urlSource.URL.String())
+	if !isBelowService || dirPath == "" || slices.Contains(strings.Split(dirPath, "/"), "..") {
+		if alias == "" || strings.ContainsAny(alias, "/%") {
+			return "", "", fmt.Errorf("repository URL %q is outside of the service, and alias %q is not usable as a directory name", repoURL, alias)
+		}
+		dirPath = alias + "/"
+	}
+	return u.String(), dirPath, nil
+}
+
+// Helper function for SUSEServiceSource.ListAllFiles().
+func (s *SUSEServiceSource) listRepositoryFiles(ctx context.Context, repoURL, dirPath string, out chan<- FileSpec) *ListEntriesError {
+	repo := s.YumSource
+	urlSource, err := repo.newMirror(repoURL)
+	if err != nil {
+		return &ListEntriesError{Location: repoURL, Message: "invalid repository URL", Inner: err}
+	}
+	repo.URLString = repoURL
+	repo.urlSource = urlSource
+	repo.mirrors = &yumMirrorSet{}
+	if s.target != nil {
+		target := *s.target
+		target.ObjectNamePrefix += secrets.FromEnv(dirPath)
+		repo.target = &target
+	}
+	s.reposMutex.Lock()
+	s.repos[dirPath] = &repo
+	s.reposMutex.Unlock()
+	logg.Debug("transferring repository %s into %s", repoURL, dirPath)
+
+	// the files of the repository are placed in its subdirectory
+	c := make(chan FileSpec, 10)
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for spec := range c {
+			spec.Path = dirPath + spec.Path
+			out <- spec
+		}
+	})
+	lerr := repo.ListAllFiles(ctx, c)
+	close(c)
+	wg.Wait()
+	return lerr
+}
+
+// Helper function for SUSEServiceSource.ListAllFiles().
+//
+// Returns a copy of the given <repo> element that refers to the repository
+// by its path relative to the service instead of by its URL.
+func rewriteSUSERepoIndexEntry(entry rawXMLElement, dirPath string) rawXMLElement {
+	var buf bytes.Buffer
+	buf.WriteString("<repo")
+	for _, attr := range entry.Start.Attr {
+		if attr.Name.Local == "url" || attr.Name.Local == "path" {
+			continue
+		}
+		fmt.Fprintf(&buf, ` %s="`, attr.Name.Local)
+		xml.EscapeText(&buf, []byte(attr.Value)) //nolint:errcheck // cannot fail when writing into bytes.Buffer
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(` path="`)
+	xml.EscapeText(&buf, []byte(dirPath)) //nolint:errcheck // cannot fail when writing into bytes.Buffer
+	buf.WriteString(`"/>`)
+
+	return rawXMLElement{Start: entry.Start, Raw: buf.Bytes()}
+}
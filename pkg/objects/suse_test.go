@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/sapcc/go-bits/regexpext"
+	"go.xyrillian.de/gg/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestSUSEServiceSource(t *testing.T) {
+	config := `
+url: https://example.com/service/
+type: suse-service
+arch: [x86_64, noarch]
+repos: ['Basesystem-Pool', '.*-Updates', 'Packman']
+`
+	var u SourceUnmarshaler
+	assert.ErrEqual(t, yaml.Unmarshal([]byte(config), &u), nil)
+	s, ok := u.Source.(*SUSEServiceSource)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, len(s.Validate("test")), 0)
+	// the options of YumSource are inlined
+	assert.Equal(t, s.Architectures, []string{"x86_64", "noarch"})
+	assert.Equal(t, s.Repositories, []regexpext.BoundedRegexp{"Basesystem-Pool", ".*-Updates", "Packman"})
+
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<repoindex disturl="https://example.com/service" ttl="86400">
+<repo url="%{disturl}/Products/Basesystem/x86_64/product/" alias="Basesystem-Pool" name="Basesystem" enabled="true" autorefresh="false"/>
+<repo url="%{disturl}/Products/Basesystem/x86_64/product_debug/" alias="Basesystem-Debuginfo-Pool" enabled="false"/>
+<repo path="Updates/Basesystem/x86_64/update" alias="Basesystem-Updates" name="Basesystem &amp; Updates" enabled="true"/>
+<repo url="https://packman.example.org/suse/" alias="Packman" enabled="true"/>
+<repo url="https://other.example.org/suse/" alias="Other" enabled="true"/>
+</repoindex>
+`
+	var index suseRepoIndex
+	assert.ErrEqual(t, xml.Unmarshal([]byte(input), &index), nil)
+	doc, err := parseRawXMLDocument([]byte(input))
+	assert.ErrEqual(t, err, nil)
+
+	var (
+		dirPaths []string
+		selected []rawXMLElement
+	)
+	for _, entry := range doc.Children {
+		if !s.selectsRepository(entry) {
+			continue
+		}
+		repoURL, dirPath, err := s.resolveRepository(index, entry)
+		assert.ErrEqual(t, err, nil)
+		dirPaths = append(dirPaths, repoURL+" -> "+dirPath)
+		selected = append(selected, rewriteSUSERepoIndexEntry(entry, dirPath))
+	}
+	// repositories below the service URL keep their path, others are placed
+	// below their alias
+	assert.Equal(t, dirPaths, []string{
+		"https://example.com/service/Products/Basesystem/x86_64/product/ -> Products/Basesystem/x86_64/product/",
+		"https://example.com/service/Updates/Basesystem/x86_64/update/ -> Updates/Basesystem/x86_64/update/",
+		"https://packman.example.org/suse/ -> Packman/",
+	})
+
+	assert.Equal(t, string(doc.Serialize(selected)), `<?xml version="1.0" encoding="UTF-8"?>
+<repoindex disturl="https://example.com/service" ttl="86400">
+  <repo alias="Basesystem-Pool" name="Basesystem" enabled="true" autorefresh="false" path="Products/Basesystem/x86_64/product/"/>
+  <repo alias="Basesystem-Updates" name="Basesystem &amp; Updates" enabled="true" path="Updates/Basesystem/x86_64/update/"/>
+  <repo alias="Packman" enabled="true" path="Packman/"/>
+</repoindex>
+`)
+
+	// without `repos`, all repositories are selected that are not disabled
+	s.Repositories = nil
+	var aliases []string
+	for _, entry := range doc.Children {
+		if s.selectsRepository(entry) {
+			aliases = append(aliases, entry.Attr("alias"))
+		}
+	}
+	assert.Equal(t, aliases, []string{"Basesystem-Pool", "Basesystem-Updates", "Packman", "Other"})
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -270,6 +271,121 @@ func (s *SwiftLocation) ListAllFiles(ctx context.Context, out chan<- FileSpec) *
 	return nil
 }
 
+// listObjectsBelow lists all objects below the given path (relative to the
+// ObjectNamePrefix). This is used by sources that need to know what already
+// exists in their target.
+func (s *SwiftLocation) listObjectsBelow(ctx context.Context, path string) ([]FileSpec, error) {
+	iter := s.Container.Objects()
+	iter.Prefix = string(s.ObjectNamePrefix)
+	if path = strings.Trim(path, "/"); path != "" {
+		iter.Prefix += path + "/"
+	}
+	var result []FileSpec
+	err := iter.ForeachDetailed(ctx, func(info schwift.ObjectInfo) error {
+		result = append(result, s.getFileSpec(info))
+		return nil
+	})
+	return result, err
+}
+
+// hasObjectWithContents checks whether the object at the given path (below
+// the ObjectNamePrefix) exists and has exactly the given contents. This is
+// used by sources to find out whether repository metadata has changed since
+// the previous run.
+func (s *SwiftLocation) hasObjectWithContents(ctx context.Context, path string, contents []byte) (bool, error) {
+	if s.Container == nil {
+		return false, nil
+	}
+	hdr, err := s.ObjectAtPath(path).Headers(ctx)
+	if err != nil {
+		if schwift.Is(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	// the Etag of a regular object is the MD5 digest of its contents (large
+	// objects have a different Etag and thus never match, which is fine)
+	etag := Checksum{Algorithm: "md5", Value: hdr.Etag().Get()}
+	return etag.Verify(contents) == nil, nil
+}
+
+// retainExistingFiles returns a FileSpec with RetainOnly for each object that
+// was found by DiscoverExistingFiles(). Sources use this when they find that
+// the previous run already transferred everything, to prevent the cleanup
+// from removing objects that are still referenced.
+func (s *SwiftLocation) retainExistingFiles() []FileSpec {
+	result := make([]FileSpec, 0, len(s.FileExists))
+	for objectName := range s.FileExists {
+		path, ok := strings.CutPrefix(objectName, string(s.ObjectNamePrefix))
+		if ok {
+			result = append(result, FileSpec{Path: path, RetainOnly: true})
+		}
+	}
+	// make the order of files deterministic
+	slices.SortFunc(result, func(lhs, rhs FileSpec) int {
+		return strings.Compare(lhs.Path, rhs.Path)
+	})
+	return result
+}
+
+// The object metadata key in which recordCompletedRun() stores the run
+// fingerprint.
+const completedRunMetadataKey = "Completed-Run"
+
+// getCompletedRun returns the run fingerprint that recordCompletedRun() stored
+// in the metadata of the object at the given path (below the
+// ObjectNamePrefix), or "" if there is none.
+func (s *SwiftLocation) getCompletedRun(ctx context.Context, path string) (string, error) {
+	if s.Container == nil {
+		return "", nil
+	}
+	hdr, err := s.ObjectAtPath(path).Headers(ctx)
+	if err != nil {
+		if schwift.Is(err, http.StatusNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return hdr.Metadata().Get(completedRunMetadataKey), nil
+}
+
+// recordCompletedRun stores the given run fingerprint in the metadata of the
+// object at the given path (below the ObjectNamePrefix), or removes it if the
+// fingerprint is empty. Sources use this to remember that a run of their job
+// has completed, and for which configuration.
+func (s *SwiftLocation) recordCompletedRun(ctx context.Context, path, fingerprint string) error {
+	if s.Container == nil {
+		return nil
+	}
+	object := s.ObjectAtPath(path)
+	hdr, err := object.Headers(ctx)
+	if err != nil {
+		return err
+	}
+	if hdr.Metadata().Get(completedRunMetadataKey) == fingerprint {
+		return nil
+	}
+
+	// a POST replaces all metadata, so the existing metadata (esp. the
+	// Source-Etag and Source-Last-Modified) needs to be sent along
+	newHdr := schwift.NewObjectHeaders()
+	for key, value := range hdr.Headers {
+		if strings.HasPrefix(strings.ToLower(key), "x-object-meta-") {
+			newHdr.Set(key, value)
+		}
+	}
+	newHdr.ContentType().Set(hdr.ContentType().Get())
+	if hdr.ExpiresAt().Exists() {
+		newHdr.ExpiresAt().Set(hdr.ExpiresAt().Get())
+	}
+	if fingerprint == "" {
+		newHdr.Metadata().Del(completedRunMetadataKey)
+	} else {
+		newHdr.Metadata().Set(completedRunMetadataKey, fingerprint)
+	}
+	return object.Update(ctx, newHdr, nil)
+}
+
 // ListEntries implements the Source interface.
 func (s *SwiftLocation) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
 	return nil, ErrListEntriesNotSupported
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"testing"
+
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestRetainExistingFiles(t *testing.T) {
+	s := &SwiftLocation{
+		ObjectNamePrefix: "mirror/",
+		FileExists: map[string]bool{
+			"mirror/repodata/repomd.xml":  true,
+			"mirror/Packages/foo-1.0.rpm": true,
+			"mirror/Packages/bar-1.0.rpm": true,
+			"other/Packages/baz-1.0.rpm":  true,
+			"mirror/repodata/primary.xml": true,
+		},
+	}
+	assert.Equal(t, s.retainExistingFiles(), []FileSpec{
+		{Path: "Packages/bar-1.0.rpm", RetainOnly: true},
+		{Path: "Packages/foo-1.0.rpm", RetainOnly: true},
+		{Path: "repodata/primary.xml", RetainOnly: true},
+		{Path: "repodata/repomd.xml", RetainOnly: true},
+	})
+}
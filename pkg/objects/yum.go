@@ -4,15 +4,19 @@
 package objects
 
 import (
-	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/regexpext"
+	"github.com/sapcc/go-bits/secrets"
 	"go.xyrillian.de/schwift/v2"
 
 	"github.com/sapcc/swift-http-import/pkg/util"
@@ -30,10 +34,29 @@ type YumSource struct {
 	ServerCAPath             string   `yaml:"ca"`
 	Architectures            []string `yaml:"arch"`
 	VerifySignature          *bool    `yaml:"verify_signature"`
+	SkipUnchanged            *bool    `yaml:"skip_unchanged"`
+	PackageSigningKeys       []string `yaml:"package_signing_keys"`
+	// options for repositories that are distributed over a set of mirrors
+	Metalink   string `yaml:"metalink"`
+	Mirrorlist string `yaml:"mirrorlist"`
+	// options for partial mirrors
+	Packages             []regexpext.BoundedRegexp `yaml:"packages"`
+	KeepVersions         uint                      `yaml:"keep_versions"`
+	SigningKeyPath       string                    `yaml:"signing_key"`
+	SigningKeyPassphrase secrets.FromEnv           `yaml:"signing_key_passphrase"`
 	// compiled configuration
-	urlSource       *URLSource       `yaml:"-"`
-	gpgVerification bool             `yaml:"-"`
-	gpgKeyRing      *util.GPGKeyRing `yaml:"-"`
+	urlSource       *URLSource          `yaml:"-"`
+	gpgVerification bool                `yaml:"-"`
+	gpgKeyRing      *util.GPGKeyRing    `yaml:"-"`
+	signingKey      *util.GPGSigningKey `yaml:"-"`
+	skipUnchanged   bool                `yaml:"-"`
+	trustedKeys     util.GPGTrustSet    `yaml:"-"`
+	runFingerprint  string              `yaml:"-"`
+	// the mirrors from the metalink or mirrorlist (filled during ListAllFiles)
+	mirrors *yumMirrorSet `yaml:"-"`
+	// the target of the job, to find out whether the repository has changed
+	// since the previous run
+	target *SwiftLocation `yaml:"-"`
 }
 
 // Validate implements the Source interface.
@@ -48,14 +71,50 @@ func (s *YumSource) Validate(name string) []error {
 	if s.VerifySignature != nil {
 		s.gpgVerification = *s.VerifySignature
 	}
-	return s.urlSource.Validate(name)
+	s.skipUnchanged = true
+	if s.SkipUnchanged != nil {
+		s.skipUnchanged = *s.SkipUnchanged
+	}
+	s.mirrors = &yumMirrorSet{}
+	errs := s.urlSource.Validate(name)
+	if s.Metalink != "" && s.Mirrorlist != "" {
+		errs = append(errs, fmt.Errorf("invalid value for %s.mirrorlist: cannot be combined with %s.metalink", name, name))
+	}
+	if s.URLString == "" && (s.Metalink != "" || s.Mirrorlist != "") {
+		// the repository URL is discovered from the metalink or mirrorlist
+		errs = slices.DeleteFunc(errs, func(err error) bool {
+			return err.Error() == fmt.Sprintf("missing value for %s.url", name)
+		})
+	}
+	if s.SigningKeyPath != "" && !s.isPartialMirror() {
+		errs = append(errs, fmt.Errorf("invalid value for %s.signing_key: this option requires %s.packages or %s.keep_versions", name, name, name))
+	}
+	var err error
+	s.trustedKeys, err = util.ParseGPGTrustSet(s.PackageSigningKeys)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid value for %s.package_signing_keys: %w", name, err))
+	}
+	return errs
 }
 
 // Connect implements the Source interface.
 func (s *YumSource) Connect(ctx context.Context, name string) error {
+	if s.SigningKeyPath != "" {
+		var err error
+		s.signingKey, err = util.LoadGPGSigningKey(s.SigningKeyPath, string(s.SigningKeyPassphrase))
+		if err != nil {
+			return fmt.Errorf("cannot load signing key: %w", err)
+		}
+		logg.Debug("signing key %s loaded from %s", s.signingKey.KeyID(), s.SigningKeyPath)
+	}
 	return s.urlSource.Connect(ctx, name)
 }
 
+// Helper function for YumSource.ListAllFiles().
+func (s *YumSource) isPartialMirror() bool {
+	return len(s.Packages) > 0 || s.KeepVersions > 0
+}
+
 // ListEntries implements the Source interface.
 func (s *YumSource) ListEntries(_ context.Context, directoryPath string) ([]FileSpec, *ListEntriesError) {
 	return nil, ErrListEntriesNotSupported
@@ -63,6 +122,9 @@ func (s *YumSource) ListEntries(_ context.Context, directoryPath string) ([]File
 
 // GetFile implements the Source interface.
 func (s *YumSource) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	if s.Metalink != "" || s.Mirrorlist != "" {
+		return s.mirrors.GetFile(ctx, path, requestHeaders)
+	}
 	return s.urlSource.GetFile(ctx, path, requestHeaders)
 }
 
@@ -73,14 +135,19 @@ func (s *YumSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *List
 	repomdPath := "repodata/repomd.xml"
 	// parse repomd.xml to find paths of all other metadata files
 	var repomd struct {
-		Entries []struct {
-			Type     string `xml:"type,attr"`
-			Location struct {
-				Href string `xml:"href,attr"`
-			} `xml:"location"`
-		} `xml:"data"`
-	}
-	repomdBytes, repomdURL, lerr := s.downloadAndParseXML(ctx, repomdPath, &repomd, cache)
+		Entries []yumRepomdEntry `xml:"data"`
+	}
+	var (
+		repo        = s.urlSource
+		repomdBytes []byte
+		repomdURL   string
+		lerr        *ListEntriesError
+	)
+	if s.Metalink == "" && s.Mirrorlist == "" {
+		repomdBytes, repomdURL, lerr = s.downloadAndParseXML(ctx, repo, repomdPath, &repomd, cache)
+	} else {
+		repo, repomdBytes, repomdURL, lerr = s.downloadRepomdFromMirrors(ctx, repomdPath, &repomd, cache)
+	}
 	if lerr != nil {
 		return lerr
 	}
@@ -88,86 +155,96 @@ func (s *YumSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *List
 	// we transfer the signature and it's key file (down below) regardless of
 	// whether GPG verification is enabled because some packages need it
 	signaturePath := repomdPath + ".asc"
-	signatureBytes, signatureURI, lerr := s.urlSource.getFileContents(ctx, signaturePath, cache)
+	signatureBytes, signatureURI, lerr := repo.getFileContents(ctx, signaturePath, cache)
 	if lerr == nil {
-		out <- getFileSpec(signaturePath, cache)
+		// in partial mirrors, the signature does not match the rewritten repomd.xml
+		if !s.isPartialMirror() {
+			out <- getFileSpec(signaturePath, cache)
+		}
 		// verify repomd's GPG signature
 		if s.gpgVerification {
 			err := s.gpgKeyRing.VerifyDetachedGPGSignature(ctx, repomdBytes, signatureBytes)
 			if err != nil {
 				logg.Debug("could not verify GPG signature at %s for file %s", signatureURI, "-"+filepath.Base(repomdPath))
 				return &ListEntriesError{
-					Location: s.urlSource.getURLForPath("/").String(),
+					Location: repo.getURLForPath("/").String(),
 					Message:  ErrMessageGPGVerificationFailed,
 					Inner:    err,
 				}
 			}
 			logg.Debug("successfully verified GPG signature at %s for file %s", signatureURI, "-"+filepath.Base(repomdPath))
 		}
-	} else if !strings.Contains(lerr.Message, "GET returned status 404") {
+	} else if !lerr.isNotFound() {
 		// not all repos have signature files therefore we only return an err if
 		// not 404.
 		return lerr
 	}
 
+	// if repomd.xml is identical to the one in the target, and the previous
+	// run with the same configuration was completed without errors, there is
+	// no need to parse any further metadata (this does not apply to partial
+	// mirrors since the repomd.xml in the target is rewritten and thus never
+	// identical)
+	if s.skipUnchanged && !s.isPartialMirror() && s.target != nil {
+		isUnchanged, lerr := s.isUnchangedSinceCompletedRun(ctx, repomdPath, repomdBytes)
+		if lerr != nil {
+			return lerr
+		}
+		if isUnchanged {
+			logg.Info("skipping %s: repository metadata has not changed since the previous run", repomdURL)
+			for _, spec := range s.target.retainExistingFiles() {
+				out <- spec
+			}
+			return nil
+		}
+	}
+
+	if s.isPartialMirror() {
+		return s.listFilteredFiles(ctx, repo, repomdPath, repomdBytes, cache, out)
+	}
+
 	// note metadata files for transfer
-	hrefsByType := make(map[string]string)
+	entriesByType := make(map[string]yumRepomdEntry)
 	for _, entry := range repomd.Entries {
 		out <- getFileSpec(entry.Location.Href, cache)
-		hrefsByType[entry.Type] = entry.Location.Href
+		entriesByType[entry.Type] = entry
 	}
 
 	// parse primary.xml.gz to find paths of RPMs
-	href, exists := hrefsByType["primary"]
+	entry, exists := entriesByType["primary"]
 	if !exists {
 		return &ListEntriesError{
 			Location: repomdURL,
 			Message:  "cannot find link to primary.xml.gz in repomd.xml",
 		}
 	}
-	var primary struct {
-		Packages []struct {
-			Architecture string `xml:"arch"`
-			Location     struct {
-				Href string `xml:"href,attr"`
-			} `xml:"location"`
-		} `xml:"package"`
-	}
-	_, _, lerr = s.downloadAndParseXML(ctx, href, &primary, cache)
-	if lerr != nil {
-		return lerr
-	}
-	for _, pkg := range primary.Packages {
+	lerr = streamXMLElements(ctx, repo, entry, "package", cache, func(pkg yumPackage) {
 		if s.handlesArchitecture(pkg.Architecture) {
-			out <- getFileSpec(pkg.Location.Href, cache)
+			out <- pkg.FileSpec(cache, s.packageVerifier())
 		}
+	})
+	if lerr != nil {
+		return lerr
 	}
 
-	// parse prestodelta.xml.gz (if present) to find paths of DRPMs
-	// (NOTE: this is called "deltainfo.xml.gz" on Suse)
-	href, exists = hrefsByType["prestodelta"]
-	if !exists {
-		href, exists = hrefsByType["deltainfo"]
-	}
-	if exists {
-		var prestodelta struct {
-			Packages []struct {
-				Architecture string `xml:"arch,attr"`
-				Deltas       []struct {
-					Href string `xml:"filename"`
-				} `xml:"delta"`
-			} `xml:"newpackage"`
-		}
-		_, _, lerr = s.downloadAndParseXML(ctx, href, &prestodelta, cache)
-		if lerr != nil {
-			return lerr
+	// parse prestodelta.xml.gz (if present) to find paths of DRPMs (SUSE
+	// repositories have the same format under the name "deltainfo")
+	for _, dataType := range []string{"prestodelta", "deltainfo"} {
+		entry, exists := entriesByType[dataType]
+		if !exists {
+			continue
 		}
-		for _, pkg := range prestodelta.Packages {
+		lerr = streamXMLElements(ctx, repo, entry, "newpackage", cache, func(pkg yumDeltaPackage) {
 			if s.handlesArchitecture(pkg.Architecture) {
 				for _, d := range pkg.Deltas {
-					out <- getFileSpec(d.Href, cache)
+					spec := getFileSpec(d.Href, cache)
+					spec.ExpectedChecksum, spec.ExpectedSizeBytes = d.Checksum.Checksum(), parseYumSize(d.Size)
+					out <- spec
 				}
 			}
+		})
+		if lerr != nil {
+			return lerr
 		}
 	}
 
@@ -175,10 +252,10 @@ func (s *YumSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *List
 	// uploaded (to avoid situations where a client might see repository metadata
 	// without being able to see the referenced packages)
 	repomdKeyPath := repomdPath + ".key"
-	_, _, lerr = s.urlSource.getFileContents(ctx, repomdKeyPath, cache)
+	_, _, lerr = repo.getFileContents(ctx, repomdKeyPath, cache)
 	if lerr == nil {
 		out <- getFileSpec(repomdKeyPath, cache)
-	} else if !strings.Contains(lerr.Message, "GET returned status 404") {
+	} else if !lerr.isNotFound() {
 		return lerr
 	}
 	out <- getFileSpec(repomdPath, cache)
@@ -186,6 +263,52 @@ func (s *YumSource) ListAllFiles(ctx context.Context, out chan<- FileSpec) *List
 	return nil
 }
 
+// Helper function for YumSource.ListAllFiles().
+//
+// If this returns false, the record of the previous completed run is removed
+// from the target, since the target is not known to be complete until this
+// run has completed.
+func (s *YumSource) isUnchangedSinceCompletedRun(ctx context.Context, repomdPath string, repomdBytes []byte) (bool, *ListEntriesError) {
+	location := s.target.ObjectAtPath(repomdPath).FullName()
+	completedRun, err := s.target.getCompletedRun(ctx, repomdPath)
+	if err != nil {
+		return false, &ListEntriesError{Location: location, Message: "HEAD failed", Inner: err}
+	}
+	if completedRun == "" {
+		return false, nil
+	}
+	if completedRun == s.runFingerprint {
+		isUnchanged, err := s.target.hasObjectWithContents(ctx, repomdPath, repomdBytes)
+		if err != nil {
+			return false, &ListEntriesError{Location: location, Message: "HEAD failed", Inner: err}
+		}
+		if isUnchanged {
+			return true, nil
+		}
+	}
+	err = s.target.recordCompletedRun(ctx, repomdPath, "")
+	if err != nil {
+		return false, &ListEntriesError{Location: location, Message: "POST failed", Inner: err}
+	}
+	return false, nil
+}
+
+// RecordCompletedRun implements the CompletedRunRecorder interface.
+func (s *YumSource) RecordCompletedRun(ctx context.Context) error {
+	if !s.skipUnchanged || s.isPartialMirror() || s.target == nil {
+		return nil
+	}
+	return s.target.recordCompletedRun(ctx, "repodata/repomd.xml", s.runFingerprint)
+}
+
+// Helper function for JobConfiguration.Compile().
+//
+// Returns the options that affect which files are transferred, for the run
+// fingerprint.
+func (s *YumSource) fingerprintOptions() any {
+	return []any{s.URLString, s.Metalink, s.Mirrorlist, s.Architectures, s.PackageSigningKeys}
+}
+
 // getFileSpec returns a FileSpec for a given path.
 //
 // It checks the cache for a existing FileSpec for the given path to avoid
@@ -202,6 +325,98 @@ func getFileSpec(path string, cache map[string]FileSpec) FileSpec {
 	return f
 }
 
+// yumPackage is a <package> element in primary.xml.
+type yumPackage struct {
+	Name         string `xml:"name"`
+	Architecture string `xml:"arch"`
+	Version      struct {
+		Epoch   string `xml:"epoch,attr"`
+		Version string `xml:"ver,attr"`
+		Release string `xml:"rel,attr"`
+	} `xml:"version"`
+	Checksum yumChecksum `xml:"checksum"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Size struct {
+		Package string `xml:"package,attr"`
+	} `xml:"size"`
+}
+
+// FileSpec returns the FileSpec for this package. The checksum and size of the
+// package (and its signature, if a verifier is given) are verified during the
+// transfer.
+func (p yumPackage) FileSpec(cache map[string]FileSpec, verifier packageSignatureVerifier) FileSpec {
+	spec := getFileSpec(p.Location.Href, cache)
+	spec.ExpectedChecksum = p.Checksum.Checksum()
+	spec.ExpectedSizeBytes = parseYumSize(p.Size.Package)
+	spec.SignatureVerifier = verifier
+	return spec
+}
+
+// yumDeltaPackage is a <newpackage> element in prestodelta.xml.
+type yumDeltaPackage struct {
+	Architecture string `xml:"arch,attr"`
+	Deltas       []struct {
+		Href     string      `xml:"filename"`
+		Checksum yumChecksum `xml:"checksum"`
+		Size     string      `xml:"size"`
+	} `xml:"delta"`
+}
+
+// yumRepomdEntry is a <data> element in repomd.xml.
+type yumRepomdEntry struct {
+	Type     string `xml:"type,attr"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Checksum  yumChecksum `xml:"checksum"`
+	Size      string      `xml:"size"`
+	Timestamp string      `xml:"timestamp"`
+}
+
+// Expected returns a FileSpec with the checksum and size that repomd.xml
+// lists for this metadata file.
+func (e yumRepomdEntry) Expected() FileSpec {
+	return FileSpec{
+		ExpectedChecksum:  e.Checksum.Checksum(),
+		ExpectedSizeBytes: parseYumSize(e.Size),
+	}
+}
+
+// yumChecksum is a <checksum> element in the repository metadata.
+type yumChecksum struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Checksum converts this into a Checksum, or returns nil if there is no checksum.
+func (c yumChecksum) Checksum() *Checksum {
+	if c.Type == "" || c.Value == "" {
+		return nil
+	}
+	return &Checksum{Algorithm: c.Type, Value: strings.TrimSpace(c.Value)}
+}
+
+// Helper function for YumSource.ListAllFiles().
+func parseYumSize(value string) *uint64 {
+	size, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &size
+}
+
+// Helper function for YumSource.ListAllFiles().
+//
+// Returns nil if the signatures of packages shall not be verified.
+func (s *YumSource) packageVerifier() packageSignatureVerifier {
+	if len(s.trustedKeys) == 0 {
+		return nil
+	}
+	return rpmSignatureVerifier{KeyRing: s.gpgKeyRing, TrustedKeys: s.trustedKeys}
+}
+
 // Helper function for YumSource.ListAllFiles().
 func (s *YumSource) handlesArchitecture(arch string) bool {
 	if len(s.Architectures) == 0 || arch == "" {
@@ -211,47 +426,88 @@ func (s *YumSource) handlesArchitecture(arch string) bool {
 }
 
 // Helper function for YumSource.ListAllFiles().
-func (s *YumSource) downloadAndParseXML(ctx context.Context, path string, data any, cache map[string]FileSpec) (contents []byte, uri string, e *ListEntriesError) {
-	buf, uri, lerr := s.urlSource.getFileContents(ctx, path, cache)
+func (s *YumSource) downloadAndParseXML(ctx context.Context, repo *URLSource, path string, data any, cache map[string]FileSpec) (contents []byte, uri string, e *ListEntriesError) {
+	buf, uri, lerr := repo.getFileContents(ctx, path, cache)
 	if lerr != nil {
 		return nil, uri, lerr
 	}
 
-	// if `buf` has the magic number for GZip, decompress before parsing as XML
-	if bytes.HasPrefix(buf, gzipMagicNumber) {
-		var err error
-		buf, err = decompressGZipArchive(buf)
-		if err != nil {
-			return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress gzip stream", Inner: err}
-		}
+	buf, err := decompressArchive(buf)
+	if err != nil {
+		return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress file", Inner: err}
 	}
 
-	// if `buf` has the magic number for XZ, decompress before parsing as XML
-	if bytes.HasPrefix(buf, xzMagicNumber) {
-		var err error
-		buf, err = decompressXZArchive(buf)
-		if err != nil {
-			return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress xz stream", Inner: err}
+	if data == nil {
+		return buf, uri, nil
+	}
+	err = xml.Unmarshal(buf, data)
+	if err != nil {
+		return nil, uri, &ListEntriesError{
+			Location: uri,
+			Message:  "error while parsing XML",
+			Inner:    err,
 		}
 	}
 
-	// if `buf` has the magic number for zstd, decompress before parsing as XML
-	if bytes.HasPrefix(buf, zstdMagicNumber) {
-		var err error
-		buf, err = decompressZSTDArchive(buf)
-		if err != nil {
-			return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress zstd stream", Inner: err}
+	return buf, uri, nil
+}
+
+// Helper function for YumSource.ListAllFiles().
+//
+// Like YumSource.downloadAndParseXML(), but instead of unmarshaling the whole
+// file at once, each element with the given name is decoded and passed to
+// `handle` on its own. This keeps the memory usage flat for huge metadata
+// files like the primary.xml of EPEL, since the compressed file is only held
+// in memory (in the cache, for the transfer) if it is too small to be spooled
+// to disk. The file is verified against the checksum and size from its entry
+// in repomd.xml before it is parsed.
+func streamXMLElements[T any](ctx context.Context, s *URLSource, entry yumRepomdEntry, elementName string, cache map[string]FileSpec, handle func(T)) *ListEntriesError {
+	contents, uri, lerr := s.openFileContents(ctx, entry.Location.Href, entry.Expected(), cache)
+	if lerr != nil {
+		if errors.Is(lerr.Inner, errChecksumMismatch) {
+			lerr.Message = "file does not match repomd.xml"
 		}
+		return lerr
 	}
+	defer contents.Close()
+	reader, err := newDecompressingStream(contents)
+	if err != nil {
+		return &ListEntriesError{Location: uri, Message: "cannot decompress file", Inner: err}
+	}
+	defer reader.Close()
 
-	err := xml.Unmarshal(buf, data)
+	err = decodeXMLElements(reader, elementName, handle)
 	if err != nil {
-		return nil, uri, &ListEntriesError{
+		return &ListEntriesError{
 			Location: uri,
 			Message:  "error while parsing XML",
 			Inner:    err,
 		}
 	}
+	return nil
+}
 
-	return buf, uri, nil
+// decodeXMLElements decodes each element with the given name (at any depth)
+// from the given XML document into a fresh T, and passes it to `handle`.
+func decodeXMLElements[T any](r io.Reader, elementName string, handle func(T)) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != elementName {
+			continue
+		}
+		var element T
+		err = decoder.DecodeElement(&element, &start)
+		if err != nil {
+			return err
+		}
+		handle(element)
+	}
 }
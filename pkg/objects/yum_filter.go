@@ -0,0 +1,599 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/regexpext"
+)
+
+// This file contains the implementation of partial Yum mirrors: When
+// `packages` or `keep_versions` is given in the YumSource configuration, only
+// the selected packages are transferred, and the primary, filelists and other
+// metadata as well as repomd.xml are rewritten to only reference these
+// packages. Since the rewritten repomd.xml cannot carry the upstream
+// signature, it is signed with the configured signing key (if any) instead.
+
+// These metadata types describe the full set of packages in a format that we
+// cannot rewrite (SQLite databases, zchunk files, or deltas for packages that
+// we might not keep), so they are dropped in partial mirrors.
+var yumDroppedMetadataTypeRx = regexp.MustCompile(`_db$|_zck$|^prestodelta$|^deltainfo$`)
+
+// These metadata types are rewritten in partial mirrors. The former are
+// required, the latter are only rewritten if present (SUSE repositories have
+// per-package `susedata`, and translations thereof like `susedata.de`).
+var (
+	yumRewrittenMetadataTypes          = []string{"primary", "filelists", "other"}
+	yumOptionalRewrittenMetadataTypeRx = regexp.MustCompile(`^susedata(?:\.[\w-]+)?$`)
+)
+
+// EVR returns the epoch, version and release of this package.
+func (p yumPackage) EVR() rpmEVR {
+	return rpmEVR{p.Version.Epoch, p.Version.Version, p.Version.Release}
+}
+
+// rpmEVR is the epoch, version and release of an RPM package.
+type rpmEVR struct {
+	Epoch   string
+	Version string
+	Release string
+}
+
+// compareRPMEVR compares two EVRs in the same way as RPM does. The result is
+// negative if lhs is older than rhs, positive if it is newer, and 0 if both
+// are the same.
+func compareRPMEVR(lhs, rhs rpmEVR) int {
+	lhsEpoch, _ := strconv.ParseUint(lhs.Epoch, 10, 64) //nolint:errcheck // missing epoch is 0
+	rhsEpoch, _ := strconv.ParseUint(rhs.Epoch, 10, 64) //nolint:errcheck // missing epoch is 0
+	if lhsEpoch != rhsEpoch {
+		if lhsEpoch < rhsEpoch {
+			return -1
+		}
+		return 1
+	}
+	if c := compareRPMVersions(lhs.Version, rhs.Version); c != 0 {
+		return c
+	}
+	return compareRPMVersions(lhs.Release, rhs.Release)
+}
+
+// compareRPMVersions compares two version or release strings with the same
+// algorithm as rpmvercmp() in RPM. The result is negative if lhs is older than
+// rhs, positive if it is newer, and 0 if both are the same.
+func compareRPMVersions(lhs, rhs string) int {
+	if lhs == rhs {
+		return 0
+	}
+	isAlpha := func(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	isSeparator := func(c byte) bool { return !isAlpha(c) && !isDigit(c) && c != '~' && c != '^' }
+
+	for len(lhs) > 0 || len(rhs) > 0 {
+		for len(lhs) > 0 && isSeparator(lhs[0]) {
+			lhs = lhs[1:]
+		}
+		for len(rhs) > 0 && isSeparator(rhs[0]) {
+			rhs = rhs[1:]
+		}
+
+		// a tilde sorts before everything else, even the end of the string
+		if strings.HasPrefix(lhs, "~") || strings.HasPrefix(rhs, "~") {
+			if !strings.HasPrefix(lhs, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(rhs, "~") {
+				return -1
+			}
+			lhs, rhs = lhs[1:], rhs[1:]
+			continue
+		}
+		// a caret sorts before everything else, except for the end of the string
+		if strings.HasPrefix(lhs, "^") || strings.HasPrefix(rhs, "^") {
+			switch {
+			case lhs == "":
+				return -1
+			case rhs == "":
+				return 1
+			case !strings.HasPrefix(lhs, "^"):
+				return 1
+			case !strings.HasPrefix(rhs, "^"):
+				return -1
+			}
+			lhs, rhs = lhs[1:], rhs[1:]
+			continue
+		}
+		if lhs == "" || rhs == "" {
+			break
+		}
+
+		// compare the next segment (either all digits or all letters)
+		isSegmentChar := isAlpha
+		isNumeric := isDigit(lhs[0])
+		if isNumeric {
+			isSegmentChar = isDigit
+		}
+		lhsLen, rhsLen := 0, 0
+		for lhsLen < len(lhs) && isSegmentChar(lhs[lhsLen]) {
+			lhsLen++
+		}
+		for rhsLen < len(rhs) && isSegmentChar(rhs[rhsLen]) {
+			rhsLen++
+		}
+		lhsSegment, rhsSegment := lhs[:lhsLen], rhs[:rhsLen]
+		lhs, rhs = lhs[lhsLen:], rhs[rhsLen:]
+
+		// numeric segments are always newer than alphabetic segments
+		if rhsSegment == "" {
+			if isNumeric {
+				return 1
+			}
+			return -1
+		}
+		if isNumeric {
+			lhsSegment = strings.TrimLeft(lhsSegment, "0")
+			rhsSegment = strings.TrimLeft(rhsSegment, "0")
+			if len(lhsSegment) != len(rhsSegment) {
+				if len(lhsSegment) < len(rhsSegment) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := strings.Compare(lhsSegment, rhsSegment); c != 0 {
+			return c
+		}
+	}
+
+	// whichever version still has characters left over wins
+	switch {
+	case lhs == "" && rhs == "":
+		return 0
+	case lhs == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// yumPackageSelector selects packages from primary.xml while it is being
+// read. Packages are kept if they match the name patterns and the
+// architectures (if any), and if they are among the latest `keepVersions`
+// versions (if not 0) of all packages with the same name and architecture.
+// Packages that drop out of the selection are discarded right away, so that
+// huge metadata files do not need to be held in memory.
+type yumPackageSelector struct {
+	source         *YumSource
+	packagesByName map[yumNameAndArch][]yumSelectedPackage
+	// the number of packages passed to Add()
+	Count int
+}
+
+type yumNameAndArch struct{ Name, Arch string }
+
+// yumSelectedPackage is a package from primary.xml, together with its
+// <package> element.
+type yumSelectedPackage struct {
+	yumPackage
+	Element rawXMLElement
+	// the position in primary.xml, to keep the original order
+	index int
+}
+
+func (s *YumSource) newYumPackageSelector() *yumPackageSelector {
+	return &yumPackageSelector{
+		source:         s,
+		packagesByName: make(map[yumNameAndArch][]yumSelectedPackage),
+	}
+}
+
+// Add considers the given package for selection.
+func (sel *yumPackageSelector) Add(pkg yumPackage, element rawXMLElement) {
+	sel.Count++
+	s := sel.source
+	if !s.handlesArchitecture(pkg.Architecture) {
+		return
+	}
+	if len(s.Packages) > 0 && !slices.ContainsFunc(s.Packages, func(rx regexpext.BoundedRegexp) bool { return rx.MatchString(pkg.Name) }) {
+		return
+	}
+
+	key := yumNameAndArch{pkg.Name, pkg.Architecture}
+	pkgs := append(sel.packagesByName[key], yumSelectedPackage{pkg, element, sel.Count})
+	if s.KeepVersions > 0 && uint(len(pkgs)) > s.KeepVersions {
+		// newest versions first
+		slices.SortStableFunc(pkgs, func(lhs, rhs yumSelectedPackage) int {
+			return compareRPMEVR(rhs.EVR(), lhs.EVR())
+		})
+		clear(pkgs[s.KeepVersions:])
+		pkgs = pkgs[:s.KeepVersions]
+	}
+	sel.packagesByName[key] = pkgs
+}
+
+// Selected returns the selected packages in the order of primary.xml.
+func (sel *yumPackageSelector) Selected() []yumSelectedPackage {
+	var result []yumSelectedPackage
+	for _, pkgs := range sel.packagesByName {
+		result = append(result, pkgs...)
+	}
+	slices.SortFunc(result, func(lhs, rhs yumSelectedPackage) int {
+		return lhs.index - rhs.index
+	})
+	return result
+}
+
+// rawXMLDocument is an XML document whose top-level child elements have been
+// split, so that the document can be written back with a subset of them.
+type rawXMLDocument struct {
+	// the start tag of the root element, exactly as it appears in the document
+	RootStart string
+	RootName  string
+	Children  []rawXMLElement
+}
+
+// rawXMLElement is a top-level child element of a rawXMLDocument.
+type rawXMLElement struct {
+	Start xml.StartElement
+	// the element exactly as it appears in the document
+	Raw []byte
+}
+
+// Attr returns the value of the attribute with the given name, or "" if
+// there is no such attribute.
+func (e rawXMLElement) Attr(name string) string {
+	for _, attr := range e.Start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+var xmlStartTagNameRx = regexp.MustCompile(`^<([^\s/>]+)`)
+
+func parseRawXMLDocument(buf []byte) (*rawXMLDocument, error) {
+	var children []rawXMLElement
+	doc, err := streamRawXMLDocument(bytes.NewReader(buf), func(child rawXMLElement) error {
+		children = append(children, child)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc.Children = children
+	return doc, nil
+}
+
+// streamRawXMLDocument is like parseRawXMLDocument, but reads the document
+// from the given reader and passes each child element to `handle` instead of
+// collecting them in doc.Children, so that huge documents do not need to be
+// held in memory.
+func streamRawXMLDocument(r io.Reader, handle func(rawXMLElement) error) (*rawXMLDocument, error) {
+	var doc rawXMLDocument
+	recorder := &rawXMLRecorder{reader: bufio.NewReader(r)}
+	d := xml.NewDecoder(recorder)
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("missing root element")
+			}
+			return nil, err
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			doc.RootStart = string(recorder.Take(offset, d.InputOffset()))
+			break
+		}
+	}
+	match := xmlStartTagNameRx.FindStringSubmatch(doc.RootStart)
+	if match == nil {
+		return nil, fmt.Errorf("malformed start tag: %q", doc.RootStart)
+	}
+	doc.RootName = match[1]
+
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			err := d.Skip()
+			if err != nil {
+				return nil, err
+			}
+			err = handle(rawXMLElement{
+				Start: token.Copy(),
+				Raw:   recorder.Take(offset, d.InputOffset()),
+			})
+			if err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			// end of root element
+			return &doc, nil
+		}
+	}
+}
+
+// rawXMLRecorder is the reader for the xml.Decoder in streamRawXMLDocument().
+// Since it implements io.ByteReader, the decoder does not do its own
+// buffering, so all input up to the decoder's InputOffset() has been read
+// through the recorder. The recorder retains this input until it is taken.
+type rawXMLRecorder struct {
+	reader *bufio.Reader
+	buf    []byte
+	// the input offset of buf[0]
+	offset int64
+}
+
+// ReadByte implements the io.ByteReader interface.
+func (r *rawXMLRecorder) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.buf = append(r.buf, b)
+	}
+	return b, err
+}
+
+// Read implements the io.Reader interface.
+func (r *rawXMLRecorder) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	return n, err
+}
+
+// Take returns a copy of the input between the given offsets, and discards
+// all input before `end`.
+func (r *rawXMLRecorder) Take(start, end int64) []byte {
+	result := bytes.Clone(r.buf[start-r.offset : end-r.offset])
+	r.buf = append(r.buf[:0], r.buf[end-r.offset:]...)
+	r.offset = end
+	return result
+}
+
+var xmlPackagesAttrRx = regexp.MustCompile(`\bpackages="\d+"`)
+
+// Serialize returns the document with the given children. If the root element
+// has a "packages" attribute (as in primary.xml etc.), it is updated to match
+// the number of children.
+func (doc rawXMLDocument) Serialize(children []rawXMLElement) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(xmlPackagesAttrRx.ReplaceAllLiteralString(doc.RootStart, fmt.Sprintf(`packages="%d"`, len(children))))
+	buf.WriteString("\n")
+	for _, child := range children {
+		buf.WriteString("  ")
+		buf.Write(child.Raw)
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "</%s>\n", doc.RootName)
+	return buf.Bytes()
+}
+
+// Helper function for YumSource.ListAllFiles().
+func (s *YumSource) listFilteredFiles(ctx context.Context, repo *URLSource, repomdPath string, repomdBytes []byte, cache map[string]FileSpec, out chan<- FileSpec) *ListEntriesError {
+	repomdURI := repo.getURLForPath(repomdPath).String()
+	repomd, err := parseRawXMLDocument(repomdBytes)
+	if err != nil {
+		return &ListEntriesError{Location: repomdURI, Message: "error while parsing XML", Inner: err}
+	}
+
+	// sort the metadata files into the ones that we rewrite, transfer
+	// unchanged, or drop
+	var (
+		keptEntries        []rawXMLElement
+		metadataFiles      []FileSpec
+		rewrittenEntries   = make(map[string]yumRepomdEntry)
+		optionalTypes      []string
+		otherRepomdEntries []rawXMLElement
+	)
+	for _, child := range repomd.Children {
+		if child.Start.Name.Local != "data" {
+			// e.g. <revision> or <tags>
+			otherRepomdEntries = append(otherRepomdEntries, child)
+			continue
+		}
+		var entry yumRepomdEntry
+		err := xml.Unmarshal(child.Raw, &entry)
+		if err != nil {
+			return &ListEntriesError{Location: repomdURI, Message: "error while parsing XML", Inner: err}
+		}
+
+		dataType := child.Attr("type")
+		switch {
+		case slices.Contains(yumRewrittenMetadataTypes, dataType):
+			rewrittenEntries[dataType] = entry
+		case yumOptionalRewrittenMetadataTypeRx.MatchString(dataType):
+			rewrittenEntries[dataType] = entry
+			optionalTypes = append(optionalTypes, dataType)
+		case yumDroppedMetadataTypeRx.MatchString(dataType):
+			logg.Debug("not transferring %s metadata from %s in partial mirror", dataType, repomdURI)
+		default:
+			keptEntries = append(keptEntries, child)
+			metadataFiles = append(metadataFiles, getFileSpec(entry.Location.Href, cache))
+		}
+	}
+	for _, dataType := range yumRewrittenMetadataTypes {
+		if _, exists := rewrittenEntries[dataType]; !exists {
+			return &ListEntriesError{
+				Location: repomdURI,
+				Message:  fmt.Sprintf("cannot find link to %s metadata in repomd.xml", dataType),
+			}
+		}
+	}
+
+	// select packages from primary.xml
+	selector := s.newYumPackageSelector()
+	primary, primaryURI, lerr := streamYumMetadata(ctx, repo, rewrittenEntries["primary"], func(child rawXMLElement) error {
+		var pkg yumPackage
+		err := xml.Unmarshal(child.Raw, &pkg)
+		if err == nil {
+			selector.Add(pkg, child)
+		}
+		return err
+	})
+	if lerr != nil {
+		return lerr
+	}
+	packages := selector.Selected()
+	selected := make(map[string]bool, len(packages))
+	for _, pkg := range packages {
+		selected[pkg.Checksum.Value] = true
+		out <- pkg.FileSpec(cache, s.packageVerifier())
+	}
+	logg.Debug("selected %d of %d packages from %s", len(selected), selector.Count, s.URLString)
+
+	// rewrite primary.xml, filelists.xml and other.xml (in the latter two, and
+	// in susedata.xml, the checksum of the package is in the "pkgid" attribute)
+	var generatedEntries []rawXMLElement
+	for _, dataType := range slices.Concat(yumRewrittenMetadataTypes, optionalTypes) {
+		doc, uri := primary, primaryURI
+		var children []rawXMLElement
+		if dataType == "primary" {
+			for _, pkg := range packages {
+				children = append(children, pkg.Element)
+			}
+		} else {
+			doc, uri, lerr = streamYumMetadata(ctx, repo, rewrittenEntries[dataType], func(child rawXMLElement) error {
+				if selected[child.Attr("pkgid")] {
+					children = append(children, child)
+				}
+				return nil
+			})
+			if lerr != nil {
+				return lerr
+			}
+		}
+
+		file, entry, err := generateYumMetadataFile(dataType, doc.Serialize(children), rewrittenEntries[dataType].Timestamp)
+		if err != nil {
+			return &ListEntriesError{Location: uri, Message: "cannot generate metadata", Inner: err}
+		}
+		metadataFiles = append(metadataFiles, file)
+		generatedEntries = append(generatedEntries, entry)
+	}
+
+	// transfer metadata at the very end, when all packages have already been
+	// uploaded (to avoid situations where a client might see repository
+	// metadata without being able to see the referenced packages)
+	for _, file := range metadataFiles {
+		out <- file
+	}
+
+	repomdChildren := slices.Concat(otherRepomdEntries, generatedEntries, keptEntries)
+	newRepomd := repomd.Serialize(repomdChildren)
+	if s.signingKey != nil {
+		publicKey, err := s.signingKey.ArmoredPublicKey()
+		if err != nil {
+			return &ListEntriesError{Location: repomdURI, Message: "cannot export public key", Inner: err}
+		}
+		signature, err := s.signingKey.DetachSign(newRepomd)
+		if err != nil {
+			return &ListEntriesError{Location: repomdURI, Message: "cannot sign repomd.xml", Inner: err}
+		}
+		out <- generatedFileSpec(repomdPath+".key", publicKey, "application/pgp-keys")
+		out <- generatedFileSpec(repomdPath+".asc", signature, "application/pgp-signature")
+	}
+	out <- generatedFileSpec(repomdPath, newRepomd, "application/xml")
+
+	return nil
+}
+
+// Helper function for YumSource.listFilteredFiles().
+//
+// Like streamXMLElements(), but passes the raw child elements of the root
+// element to `handle`. Since only the rewritten metadata is transferred, the
+// original file is not put in the cache: It is streamed from the HTTP response
+// through the decompressor. The file is verified against the checksum and size
+// from its entry in repomd.xml, so the result must not be used if an error is
+// returned.
+func streamYumMetadata(ctx context.Context, repo *URLSource, entry yumRepomdEntry, handle func(rawXMLElement) error) (doc *rawXMLDocument, uri string, e *ListEntriesError) {
+	uri = repo.getURLForPath(entry.Location.Href).String()
+	body, _, lerr := repo.openURL(ctx, uri)
+	if lerr != nil {
+		return nil, uri, lerr
+	}
+	defer body.Close()
+	verifier, err := newVerifyingReader(body, entry.Expected())
+	if err != nil {
+		return nil, uri, &ListEntriesError{Location: uri, Message: "file does not match repomd.xml", Inner: err}
+	}
+
+	var parseErr error
+	reader, err := newDecompressingStream(verifier)
+	if err == nil {
+		defer reader.Close()
+		doc, err = streamRawXMLDocument(reader, handle)
+		parseErr = err
+	}
+	if err == nil {
+		// the checksum covers the whole file, even if the decompressor does not
+		// read it until the end
+		_, err = io.Copy(io.Discard, verifier)
+	}
+
+	switch {
+	case err == nil:
+		return doc, uri, nil
+	case errors.Is(err, errChecksumMismatch):
+		return nil, uri, &ListEntriesError{Location: uri, Message: "file does not match repomd.xml", Inner: err}
+	case parseErr != nil:
+		return nil, uri, &ListEntriesError{Location: uri, Message: "error while parsing XML", Inner: err}
+	default:
+		return nil, uri, &ListEntriesError{Location: uri, Message: "cannot decompress file", Inner: err}
+	}
+}
+
+// Helper function for YumSource.ListAllFiles().
+//
+// Returns the compressed metadata file, and its <data> entry for repomd.xml.
+func generateYumMetadataFile(dataType string, contents []byte, timestamp string) (FileSpec, rawXMLElement, error) {
+	compressed, err := compressGZipArchive(contents)
+	if err != nil {
+		return FileSpec{}, rawXMLElement{}, err
+	}
+
+	// as with createrepo's default settings, the file name contains the
+	// checksum to avoid races between updates of the metadata files and
+	// repomd.xml
+	checksum := fmt.Sprintf("%x", sha256.Sum256(compressed))
+	href := fmt.Sprintf("repodata/%s-%s.xml.gz", checksum, dataType)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<data type=\"%s\">\n", dataType)
+	fmt.Fprintf(&buf, "    <checksum type=\"sha256\">%s</checksum>\n", checksum)
+	fmt.Fprintf(&buf, "    <open-checksum type=\"sha256\">%x</open-checksum>\n", sha256.Sum256(contents))
+	fmt.Fprintf(&buf, "    <location href=\"%s\"/>\n", href)
+	if timestamp != "" {
+		fmt.Fprintf(&buf, "    <timestamp>%s</timestamp>\n", timestamp)
+	}
+	fmt.Fprintf(&buf, "    <size>%d</size>\n", len(compressed))
+	fmt.Fprintf(&buf, "    <open-size>%d</open-size>\n", len(contents))
+	buf.WriteString("  </data>")
+
+	entry := rawXMLElement{
+		Start: xml.StartElement{
+			Name: xml.Name{Local: "data"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "type"}, Value: dataType}},
+		},
+		Raw: buf.Bytes(),
+	}
+	return generatedFileSpec(href, compressed, "application/gzip"), entry, nil
+}
@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/go-bits/regexpext"
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestCompareRPMVersions(t *testing.T) {
+	// test cases from RPM's rpmvercmp.at
+	tt := []struct {
+		lhs, rhs string
+		result   int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0", "1.0", 1},
+		{"2.0.1", "2.0.1", 0},
+		{"2.0", "2.0.1", -1},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"xyz.4", "8", -1},
+		{"8", "xyz.4", 1},
+		{"5.5p1", "5.5.p1", 0},
+		{"10b2", "10a1", 1},
+		{"1.0aa", "1.0a", 1},
+		{"10.0001", "10.1", 0},
+		{"10.0001", "10.0039", -1},
+		{"4.999.9", "5.0", -1},
+		{"20101121", "20101122", -1},
+		{"2_0", "2_0", 0},
+		{"2.0", "2_0", 0},
+		{"a+", "a_", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0^git1", "1.01", -1},
+		{"1.0^20160101", "1.0.1", -1},
+		{"1.0~rc1^git1", "1.0~rc1", 1},
+		{"1.0^git1~pre", "1.0^git1", -1},
+	}
+	for _, tc := range tt {
+		assert.Equal(t, compareRPMVersions(tc.lhs, tc.rhs), tc.result)
+		assert.Equal(t, compareRPMVersions(tc.rhs, tc.lhs), -tc.result)
+	}
+
+	// the epoch takes precedence over the version
+	assert.Equal(t, compareRPMEVR(rpmEVR{"1", "1.0", "1"}, rpmEVR{"0", "2.0", "1"}), 1)
+	assert.Equal(t, compareRPMEVR(rpmEVR{"", "1.0", "1"}, rpmEVR{"0", "1.0", "1"}), 0)
+	assert.Equal(t, compareRPMEVR(rpmEVR{"0", "1.0", "2.el9"}, rpmEVR{"0", "1.0", "10.el9"}), -1)
+}
+
+func TestSelectYumPackages(t *testing.T) {
+	makePackage := func(name, arch, version string) yumPackage {
+		var pkg yumPackage
+		pkg.Name = name
+		pkg.Architecture = arch
+		pkg.Version.Epoch = "0"
+		pkg.Version.Version = version
+		pkg.Version.Release = "1"
+		pkg.Checksum.Value = name + "-" + version + "." + arch
+		return pkg
+	}
+	packages := []yumPackage{
+		makePackage("kernel", "x86_64", "5.14.0"),
+		makePackage("kernel", "x86_64", "5.14.10"),
+		makePackage("kernel", "x86_64", "5.14.2"),
+		makePackage("kernel", "aarch64", "5.14.0"),
+		makePackage("kernel-headers", "x86_64", "5.14.0"),
+		makePackage("bash", "x86_64", "5.1"),
+	}
+	selectedChecksums := func(s *YumSource) []string {
+		selector := s.newYumPackageSelector()
+		for _, pkg := range packages {
+			selector.Add(pkg, rawXMLElement{})
+		}
+		var result []string
+		for _, pkg := range selector.Selected() {
+			result = append(result, pkg.Checksum.Value)
+		}
+		slices.Sort(result)
+		return result
+	}
+
+	s := &YumSource{KeepVersions: 2}
+	assert.Equal(t, selectedChecksums(s), []string{
+		"bash-5.1.x86_64",
+		"kernel-5.14.0.aarch64",
+		"kernel-5.14.10.x86_64",
+		"kernel-5.14.2.x86_64",
+		"kernel-headers-5.14.0.x86_64",
+	})
+
+	s = &YumSource{Packages: []regexpext.BoundedRegexp{"kernel"}, Architectures: []string{"x86_64"}, KeepVersions: 1}
+	assert.Equal(t, selectedChecksums(s), []string{"kernel-5.14.10.x86_64"})
+}
+
+func TestRawXMLDocument(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- comment -->
+<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="3">
+<package pkgid="aaa" name="foo" arch="x86_64">
+  <version epoch="0" ver="1.0" rel="1"/>
+  <file>/usr/bin/foo</file>
+</package>
+<package pkgid="bbb" name="bar" arch="x86_64"><version epoch="0" ver="1.0" rel="1"/></package>
+<package pkgid="ccc" name="baz" arch="x86_64"/>
+</filelists>
+`
+	doc, err := parseRawXMLDocument([]byte(input))
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, doc.RootName, "filelists")
+	assert.Equal(t, len(doc.Children), 3)
+	assert.Equal(t, doc.Children[1].Attr("pkgid"), "bbb")
+
+	output := string(doc.Serialize([]rawXMLElement{doc.Children[0], doc.Children[2]}))
+	assert.Equal(t, output, `<?xml version="1.0" encoding="UTF-8"?>
+<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="2">
+  <package pkgid="aaa" name="foo" arch="x86_64">
+  <version epoch="0" ver="1.0" rel="1"/>
+  <file>/usr/bin/foo</file>
+</package>
+  <package pkgid="ccc" name="baz" arch="x86_64"/>
+</filelists>
+`)
+
+	// the output is still valid XML
+	var parsed struct {
+		Packages []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"package"`
+	}
+	assert.ErrEqual(t, xml.Unmarshal([]byte(output), &parsed), nil)
+	assert.Equal(t, len(parsed.Packages), 2)
+}
+
+const (
+	testYumPrimaryXML = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" packages="1">
+<package type="rpm">
+  <name>foo</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="1.0" rel="1"/>
+  <checksum type="sha256" pkgid="YES">aaa</checksum>
+  <location href="Packages/f/foo-1.0-1.x86_64.rpm"/>
+  <size package="1234"/>
+</package>
+</metadata>
+`
+	testYumFilelistsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="1">
+<package pkgid="aaa" name="foo" arch="x86_64"><version epoch="0" ver="1.0" rel="1"/></package>
+</filelists>
+`
+	testYumOtherXML = `<?xml version="1.0" encoding="UTF-8"?>
+<otherdata xmlns="http://linux.duke.edu/metadata/other" packages="1">
+<package pkgid="aaa" name="foo" arch="x86_64"><version epoch="0" ver="1.0" rel="1"/></package>
+</otherdata>
+`
+)
+
+// newTestYumRepo serves a Yum repository with the given metadata files. The
+// repomd.xml lists the checksums of `listed`, but `served` is what is actually
+// returned for each path.
+func newTestYumRepo(t *testing.T, listed, served map[string]string) *URLSource {
+	t.Helper()
+	var repomd strings.Builder
+	repomd.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<repomd xmlns="http://linux.duke.edu/metadata/repo">` + "\n")
+	for _, dataType := range slices.Sorted(maps.Keys(listed)) {
+		digest := sha256.Sum256([]byte(listed[dataType]))
+		fmt.Fprintf(&repomd, `<data type="%[1]s"><checksum type="sha256">%[2]s</checksum><location href="repodata/%[1]s.xml"/><timestamp>1760000000</timestamp><size>%[3]d</size></data>`+"\n",
+			dataType, hex.EncodeToString(digest[:]), len(listed[dataType]))
+	}
+	repomd.WriteString("</repomd>\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repodata/repomd.xml" {
+			w.Write([]byte(repomd.String())) //nolint:errcheck // not relevant for this test
+			return
+		}
+		dataType, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/repodata/"), ".xml")
+		contents, exists := served[dataType]
+		if !ok || !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(contents)) //nolint:errcheck // not relevant for this test
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL + "/")
+	assert.ErrEqual(t, err, nil)
+	return &URLSource{URLString: u.String(), URL: u, HTTPClient: http.DefaultClient}
+}
+
+func TestYumPartialMirrorVerifiesMetadata(t *testing.T) {
+	listed := map[string]string{
+		"primary":   testYumPrimaryXML,
+		"filelists": testYumFilelistsXML,
+		"other":     testYumOtherXML,
+	}
+	listFiles := func(served map[string]string) *ListEntriesError {
+		s := &YumSource{Packages: []regexpext.BoundedRegexp{"foo"}, urlSource: newTestYumRepo(t, listed, served)}
+		out := make(chan FileSpec, 100)
+		return s.ListAllFiles(t.Context(), out)
+	}
+
+	// with the metadata from repomd.xml, the partial mirror is generated
+	lerr := listFiles(listed)
+	if lerr != nil {
+		t.Fatalf("unexpected error: %s", lerr.Message)
+	}
+
+	// if primary.xml does not match the checksum in repomd.xml, the job fails
+	// instead of signing a repomd.xml that refers to the tampered packages
+	tampered := maps.Clone(listed)
+	tampered["primary"] = strings.Replace(testYumPrimaryXML, "Packages/f/foo-1.0-1.x86_64.rpm", "Packages/f/evil-1.0-1.x86_64.rpm", 1)
+	lerr = listFiles(tampered)
+	if lerr == nil {
+		t.Fatal("expected error for tampered primary.xml, got none")
+	}
+	assert.Equal(t, lerr.Message, "file does not match repomd.xml")
+
+	// the same applies to the other rewritten metadata
+	tampered = maps.Clone(listed)
+	tampered["other"] = strings.Replace(testYumOtherXML, `packages="1"`, `packages="2"`, 1)
+	lerr = listFiles(tampered)
+	if lerr == nil {
+		t.Fatal("expected error for tampered other.xml, got none")
+	}
+	assert.Equal(t, lerr.Message, "file does not match repomd.xml")
+}
@@ -0,0 +1,307 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sapcc/go-bits/logg"
+	"go.xyrillian.de/schwift/v2"
+)
+
+// This file contains the support for Yum repositories that are distributed
+// over a set of mirrors (e.g. Fedora and EPEL), which are discovered through
+// a metalink or mirrorlist URL.
+
+// yumMetalink is the format of a metalink file, as served by Fedora's
+// MirrorManager. Only the entry for repomd.xml is relevant.
+type yumMetalink struct {
+	Files []yumMetalinkFile `xml:"files>file"`
+}
+
+type yumMetalinkFile struct {
+	Name   string            `xml:"name,attr"`
+	Hashes []yumMetalinkHash `xml:"verification>hash"`
+	// previous versions of the file that are still acceptable (since mirrors
+	// are not updated at the same time)
+	Alternates []struct {
+		Hashes []yumMetalinkHash `xml:"verification>hash"`
+	} `xml:"alternates>alternate"`
+	URLs []yumMetalinkURL `xml:"resources>url"`
+}
+
+type yumMetalinkURL struct {
+	Protocol   string `xml:"protocol,attr"`
+	Preference int    `xml:"preference,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type yumMetalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// The hash algorithms in metalinks, from most to least preferred.
+var yumMetalinkHashTypes = []string{"sha512", "sha256", "sha1", "md5"}
+
+// parseYumMetalink returns the base URLs of all mirrors listed in the given
+// metalink (in order of preference), and the checksums of all acceptable
+// versions of repomd.xml.
+func parseYumMetalink(buf []byte) (baseURLs []string, checksums []Checksum, err error) {
+	var metalink yumMetalink
+	err = xml.Unmarshal(buf, &metalink)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx := slices.IndexFunc(metalink.Files, func(f yumMetalinkFile) bool {
+		return f.Name == "repomd.xml"
+	})
+	if idx == -1 {
+		return nil, nil, errors.New("no entry for repomd.xml found")
+	}
+	file := metalink.Files[idx]
+
+	// for each version of repomd.xml, use the strongest hash
+	hashSets := [][]yumMetalinkHash{file.Hashes}
+	for _, alternate := range file.Alternates {
+		hashSets = append(hashSets, alternate.Hashes)
+	}
+	for _, hashes := range hashSets {
+	typeLoop:
+		for _, hashType := range yumMetalinkHashTypes {
+			for _, hash := range hashes {
+				if hash.Type == hashType {
+					checksums = append(checksums, Checksum{Algorithm: hashType, Value: strings.TrimSpace(hash.Value)})
+					break typeLoop
+				}
+			}
+		}
+	}
+	if len(checksums) == 0 {
+		return nil, nil, errors.New("no supported hash for repomd.xml found")
+	}
+
+	urls := file.URLs
+	slices.SortStableFunc(urls, func(lhs, rhs yumMetalinkURL) int {
+		return rhs.Preference - lhs.Preference
+	})
+	for _, u := range urls {
+		if u.Protocol != "http" && u.Protocol != "https" {
+			continue // e.g. rsync
+		}
+		baseURL, found := strings.CutSuffix(strings.TrimSpace(u.Value), "repodata/repomd.xml")
+		if found {
+			baseURLs = append(baseURLs, baseURL)
+		}
+	}
+	return baseURLs, checksums, nil
+}
+
+// parseYumMirrorlist returns the base URLs of all mirrors listed in the
+// given mirrorlist (in order of preference).
+func parseYumMirrorlist(buf []byte) []string {
+	var result []string
+	for line := range strings.SplitSeq(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// Helper function for YumSource.ListAllFiles().
+//
+// Like downloadAndParseXML, but tries all mirrors from the metalink or
+// mirrorlist (after the configured URL, if any) until one of them serves a
+// repomd.xml that matches the metalink. This mirror is returned and shall be
+// used for all further downloads, and the other mirrors are used as fallback
+// in GetFile().
+func (s *YumSource) downloadRepomdFromMirrors(ctx context.Context, repomdPath string, data any, cache map[string]FileSpec) (repo *URLSource, contents []byte, uri string, e *ListEntriesError) {
+	listURL := s.Metalink
+	if listURL == "" {
+		listURL = s.Mirrorlist
+	}
+	buf, _, lerr := s.urlSource.getURLContents(ctx, listURL)
+	if lerr != nil {
+		return nil, nil, listURL, lerr
+	}
+
+	var (
+		baseURLs  []string
+		checksums []Checksum
+	)
+	if s.Metalink != "" {
+		var err error
+		baseURLs, checksums, err = parseYumMetalink(buf)
+		if err != nil {
+			return nil, nil, listURL, &ListEntriesError{Location: listURL, Message: "error while parsing metalink", Inner: err}
+		}
+	} else {
+		baseURLs = parseYumMirrorlist(buf)
+	}
+	if s.URLString != "" {
+		baseURLs = append([]string{s.URLString}, baseURLs...)
+	}
+
+	var mirrors []*URLSource
+	for _, baseURL := range baseURLs {
+		mirror, err := s.newMirror(baseURL)
+		if err != nil {
+			logg.Error("ignoring mirror %q from %s: %s", baseURL, listURL, err.Error())
+			continue
+		}
+		mirrors = append(mirrors, mirror)
+	}
+
+	lerr = &ListEntriesError{Location: listURL, Message: "no mirrors found"}
+	for idx, mirror := range mirrors {
+		var err error
+		contents, uri, lerr = mirror.getFileContents(ctx, repomdPath, cache)
+		if lerr == nil && len(checksums) > 0 {
+			if !slices.ContainsFunc(checksums, func(c Checksum) bool { return c.Verify(contents) == nil }) {
+				lerr = &ListEntriesError{Location: uri, Message: "repomd.xml does not match the metalink (the mirror might be outdated)"}
+			}
+		}
+		if lerr == nil {
+			err = xml.Unmarshal(contents, data)
+			if err != nil {
+				lerr = &ListEntriesError{Location: uri, Message: "error while parsing XML", Inner: err}
+			}
+		}
+		if lerr != nil {
+			logg.Info("skipping mirror %s: %s", mirror.URL.String(), lerr.FullMessage())
+			continue
+		}
+
+		// use this mirror first, and the others (in order) as fallback
+		s.mirrors.Set(append([]*URLSource{mirror}, slices.Delete(mirrors, idx, idx+1)...))
+		logg.Debug("using mirror %s for %s", mirror.URL.String(), listURL)
+		return mirror, contents, uri, nil
+	}
+	return nil, nil, listURL, &ListEntriesError{
+		Location: listURL,
+		Message:  "no usable mirror found",
+		Inner:    errors.New(lerr.FullMessage()),
+	}
+}
+
+// Helper function for YumSource.ListAllFiles().
+func (s *YumSource) newMirror(baseURL string) (*URLSource, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+		if u.RawPath != "" {
+			u.RawPath += "/"
+		}
+	}
+	// inherit HTTP client and segmenting options
+	mirror := *s.urlSource
+	mirror.URLString = u.String()
+	mirror.URL = u
+	return &mirror, nil
+}
+
+// yumMirrorSet contains the mirrors that YumSource.GetFile() downloads from.
+// It is filled by YumSource.ListAllFiles(), which can run again (when the
+// scraper retries) while transfers from the previous listing are running.
+type yumMirrorSet struct {
+	mutex sync.Mutex
+	// starting with the mirror that was used for the repository metadata
+	mirrors []*URLSource
+	// for each file path, the mirrors that served contents which did not match
+	// the repository metadata
+	mismatches map[string][]*URLSource
+}
+
+// Set replaces the list of mirrors.
+func (m *yumMirrorSet) Set(mirrors []*URLSource) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.mirrors = mirrors
+	m.mismatches = make(map[string][]*URLSource)
+}
+
+// Helper function for YumSource.GetFile().
+//
+// Returns the mirrors to try for the given file, in order. Mirrors that
+// previously served contents for this file that did not match the repository
+// metadata (e.g. because they are outdated) are tried last.
+func (m *yumMirrorSet) candidatesFor(path string) []*URLSource {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var good, bad []*URLSource
+	for _, mirror := range m.mirrors {
+		if slices.Contains(m.mismatches[path], mirror) {
+			bad = append(bad, mirror)
+		} else {
+			good = append(good, mirror)
+		}
+	}
+	return append(good, bad...)
+}
+
+// Helper function for yumMirrorBody.
+func (m *yumMirrorSet) reportMismatch(path string, mirror *URLSource) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.mismatches != nil && !slices.Contains(m.mismatches[path], mirror) {
+		m.mismatches[path] = append(m.mismatches[path], mirror)
+	}
+}
+
+// GetFile downloads the given file from the first mirror that serves it.
+//
+// Transport errors and error responses cause the next mirror to be tried
+// immediately. When the contents of a file do not match the repository
+// metadata, the transfer fails, but the mirror is remembered so that the
+// retry of the failed transfer downloads the file from a different mirror.
+func (m *yumMirrorSet) GetFile(ctx context.Context, path string, requestHeaders schwift.ObjectHeaders) (body io.ReadCloser, sourceState FileState, err error) {
+	mirrors := m.candidatesFor(path)
+	if len(mirrors) == 0 {
+		return nil, FileState{}, fmt.Errorf("skipping %s: no usable mirror found", path)
+	}
+	for idx, mirror := range mirrors {
+		body, sourceState, err = mirror.GetFile(ctx, path, requestHeaders)
+		if err == nil {
+			if body != nil {
+				body = yumMirrorBody{body, m, mirror, path}
+			}
+			return body, sourceState, nil
+		}
+		if idx < len(mirrors)-1 {
+			logg.Info("could not download %s from mirror %s (will try next mirror): %s", path, mirror.URL.String(), err.Error())
+		}
+	}
+	return body, sourceState, err
+}
+
+// yumMirrorBody is the body returned by yumMirrorSet.GetFile(). It implements
+// checksumMismatchReporter to find out which mirrors serve bad contents.
+type yumMirrorBody struct {
+	io.ReadCloser
+	set    *yumMirrorSet
+	mirror *URLSource
+	path   string
+}
+
+// reportChecksumMismatch implements the checksumMismatchReporter interface.
+func (b yumMirrorBody) reportChecksumMismatch() {
+	logg.Info("mirror %s served contents for %s that do not match the repository metadata (will try other mirrors first on retry)", b.mirror.URL.String(), b.path)
+	b.set.reportMismatch(b.path, b.mirror)
+}
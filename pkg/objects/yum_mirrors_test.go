@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go.xyrillian.de/gg/assert"
+	"go.xyrillian.de/schwift/v2"
+)
+
+func TestParseYumMetalink(t *testing.T) {
+	input := `<?xml version="1.0" encoding="utf-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/" type="dynamic" xmlns:mm0="http://fedorahosted.org/mirrormanager">
+ <files>
+  <file name="repomd.xml">
+   <mm0:timestamp>1760000000</mm0:timestamp>
+   <size>5678</size>
+   <verification>
+    <hash type="md5">d41d8cd98f00b204e9800998ecf8427e</hash>
+    <hash type="sha256">e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855</hash>
+   </verification>
+   <mm0:alternates>
+    <mm0:alternate>
+     <mm0:timestamp>1759990000</mm0:timestamp>
+     <size>5670</size>
+     <verification>
+      <hash type="sha1">da39a3ee5e6b4b0d3255bfef95601890afd80709</hash>
+     </verification>
+    </mm0:alternate>
+   </mm0:alternates>
+   <resources maxconnections="1">
+    <url protocol="rsync" type="rsync" location="DE" preference="100">rsync://mirror1.example.org/epel/9/Everything/x86_64/repodata/repomd.xml</url>
+    <url protocol="https" type="https" location="DE" preference="99">https://mirror2.example.org/epel/9/Everything/x86_64/repodata/repomd.xml</url>
+    <url protocol="https" type="https" location="FR" preference="100">https://mirror1.example.org/epel/9/Everything/x86_64/repodata/repomd.xml</url>
+   </resources>
+  </file>
+ </files>
+</metalink>`
+
+	baseURLs, checksums, err := parseYumMetalink([]byte(input))
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, baseURLs, []string{
+		"https://mirror1.example.org/epel/9/Everything/x86_64/",
+		"https://mirror2.example.org/epel/9/Everything/x86_64/",
+	})
+	assert.Equal(t, checksums, []Checksum{
+		{Algorithm: "sha256", Value: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{Algorithm: "sha1", Value: "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+	})
+
+	_, _, err = parseYumMetalink([]byte(`<metalink><files><file name="other.xml"/></files></metalink>`))
+	assert.ErrEqual(t, err, "no entry for repomd.xml found")
+}
+
+func TestParseYumMirrorlist(t *testing.T) {
+	input := "# repo = epel-9 arch = x86_64 country = DE\nhttps://mirror1.example.org/epel/9/Everything/x86_64/\n\nhttps://mirror2.example.org/epel/9/Everything/x86_64/\n"
+	assert.Equal(t, parseYumMirrorlist([]byte(input)), []string{
+		"https://mirror1.example.org/epel/9/Everything/x86_64/",
+		"https://mirror2.example.org/epel/9/Everything/x86_64/",
+	})
+}
+
+func TestYumMirrorFailoverOnChecksumMismatch(t *testing.T) {
+	newMirror := func(contents string) *URLSource {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(contents)) //nolint:errcheck // not relevant for this test
+		}))
+		t.Cleanup(server.Close)
+		u, err := url.Parse(server.URL + "/")
+		assert.ErrEqual(t, err, nil)
+		return &URLSource{URLString: u.String(), URL: u, HTTPClient: http.DefaultClient}
+	}
+	outdated := newMirror("old contents")
+	current := newMirror("new contents")
+	var m yumMirrorSet
+	m.Set([]*URLSource{outdated, current})
+
+	digest := sha256.Sum256([]byte("new contents"))
+	spec := FileSpec{
+		Path:             "Packages/f/foo.rpm",
+		ExpectedChecksum: &Checksum{Algorithm: "sha256", Value: hex.EncodeToString(digest[:])},
+	}
+	download := func() (string, error) {
+		body, _, err := m.GetFile(t.Context(), spec.Path, schwift.NewObjectHeaders())
+		assert.ErrEqual(t, err, nil)
+		body, err = newVerifyingReader(body, spec)
+		assert.ErrEqual(t, err, nil)
+		defer body.Close()
+		buf, err := io.ReadAll(body)
+		return string(buf), err
+	}
+
+	// the first attempt uses the preferred mirror, which is outdated...
+	_, err := download()
+	if !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	// ...so the retry uses the other mirror
+	contents, err := download()
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, contents, "new contents")
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package objects
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.xyrillian.de/gg/assert"
+)
+
+func TestYumPackageFileSpec(t *testing.T) {
+	input := `<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="2">
+<package type="rpm">
+  <name>foo</name>
+  <arch>x86_64</arch>
+  <version epoch="0" ver="1.0" rel="1.el9"/>
+  <checksum type="sha256" pkgid="YES">0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef</checksum>
+  <size package="12345" installed="23456" archive="34567"/>
+  <location href="Packages/f/foo-1.0-1.el9.x86_64.rpm"/>
+  <format><rpm:license>MIT</rpm:license></format>
+</package>
+<package type="rpm">
+  <name>bar</name>
+  <arch>noarch</arch>
+  <location href="Packages/b/bar-2.0-1.el9.noarch.rpm"/>
+</package>
+</metadata>`
+
+	// the packages are decoded one by one while the file is being decompressed
+	compressed, err := compressGZipArchive([]byte(input))
+	assert.ErrEqual(t, err, nil)
+	reader, err := newDecompressingReader(compressed)
+	assert.ErrEqual(t, err, nil)
+	var packages []yumPackage
+	err = decodeXMLElements(reader, "package", func(pkg yumPackage) {
+		packages = append(packages, pkg)
+	})
+	assert.ErrEqual(t, err, nil)
+	assert.Equal(t, len(packages), 2)
+
+	spec := packages[0].FileSpec(nil, nil)
+	assert.Equal(t, spec.Path, "Packages/f/foo-1.0-1.el9.x86_64.rpm")
+	assert.Equal(t, spec.ExpectedChecksum.String(), "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	assert.Equal(t, *spec.ExpectedSizeBytes, uint64(12345))
+
+	// packages without checksum or size are transferred without verification
+	spec = packages[1].FileSpec(nil, nil)
+	assert.Equal(t, spec.ExpectedChecksum == nil, true)
+	assert.Equal(t, spec.ExpectedSizeBytes == nil, true)
+}
+
+func TestYumVerifiesMetadata(t *testing.T) {
+	prestodelta := `<?xml version="1.0" encoding="UTF-8"?>
+<prestodelta>
+<newpackage name="foo" epoch="0" version="1.0" release="1" arch="x86_64">
+  <delta oldepoch="0" oldversion="0.9" oldrelease="1">
+    <filename>drpms/foo-0.9-1_1.0-1.x86_64.drpm</filename>
+    <checksum type="sha256">bbb</checksum>
+    <size>123</size>
+  </delta>
+</newpackage>
+</prestodelta>
+`
+	listed := map[string]string{
+		"primary":     testYumPrimaryXML,
+		"filelists":   testYumFilelistsXML,
+		"other":       testYumOtherXML,
+		"prestodelta": prestodelta,
+	}
+	listFiles := func(served map[string]string) ([]string, *ListEntriesError) {
+		s := &YumSource{urlSource: newTestYumRepo(t, listed, served)}
+		out := make(chan FileSpec, 100)
+		lerr := s.ListAllFiles(t.Context(), out)
+		close(out)
+		var paths []string
+		for spec := range out {
+			paths = append(paths, spec.Path)
+		}
+		return paths, lerr
+	}
+
+	paths, lerr := listFiles(listed)
+	if lerr != nil {
+		t.Fatalf("unexpected error: %s", lerr.Message)
+	}
+	assert.Equal(t, slices.Contains(paths, "Packages/f/foo-1.0-1.x86_64.rpm"), true)
+	assert.Equal(t, slices.Contains(paths, "drpms/foo-0.9-1_1.0-1.x86_64.drpm"), true)
+
+	// the expected checksums of packages are only trustworthy if the metadata
+	// listing them matches repomd.xml
+	for _, dataType := range []string{"primary", "prestodelta"} {
+		tampered := maps.Clone(listed)
+		tampered[dataType] = strings.ReplaceAll(listed[dataType], "foo-", "evil-")
+		_, lerr := listFiles(tampered)
+		if lerr == nil {
+			t.Fatalf("expected error for tampered %s.xml, got none", dataType)
+		}
+		assert.Equal(t, lerr.Message, "file does not match repomd.xml")
+	}
+}
@@ -6,16 +6,20 @@ package util
 import (
 	"bytes"
 	"context"
+	"crypto"
 
 	//nolint:depguard
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sapcc/go-bits/logg"
 	"go.xyrillian.de/schwift/v2"
@@ -23,6 +27,7 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
@@ -109,12 +114,162 @@ func (k *GPGKeyRing) verifyGPGSignature(ctx context.Context, message []byte, sig
 	if signature.Type != openpgp.SignatureType {
 		return fmt.Errorf("invalid OpenPGP armored structure: expected %q, got %q", openpgp.SignatureType, signature.Type)
 	}
-
-	var publicKeyBytes []byte
 	signatureBytes, err := io.ReadAll(signature.Body)
 	if err != nil {
 		return err
 	}
+	_, err = k.checkDetachedSignature(ctx, bytes.NewReader(message), signatureBytes)
+	return err
+}
+
+// VerifyClearSignedGPGSignatureFrom is like VerifyClearSignedGPGSignature, but
+// the signature must have been made by a key in the given trust set. On
+// success, the signed part of the message is returned.
+func (k *GPGKeyRing) VerifyClearSignedGPGSignatureFrom(ctx context.Context, trusted GPGTrustSet, messageWithSignature []byte) ([]byte, error) {
+	block, _ := clearsign.Decode(messageWithSignature)
+	if block == nil {
+		return nil, errors.New("no clear-signed message found")
+	}
+	signatureBytes, err := io.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := k.checkDetachedSignature(ctx, bytes.NewReader(block.Bytes), signatureBytes)
+	if err != nil {
+		return nil, err
+	}
+	return block.Plaintext, trusted.check(signer)
+}
+
+// VerifyDetachedGPGSignatureFrom is like VerifyDetachedGPGSignature, but the
+// message is streamed from a reader, the signature may be armored or binary,
+// and the signature must have been made by a key in the given trust set.
+func (k *GPGKeyRing) VerifyDetachedGPGSignatureFrom(ctx context.Context, trusted GPGTrustSet, message io.Reader, signature []byte) error {
+	signatureBytes, err := dearmorSignature(signature)
+	if err != nil {
+		return err
+	}
+	signer, err := k.checkDetachedSignature(ctx, message, signatureBytes)
+	if err != nil {
+		return err
+	}
+	return trusted.check(signer)
+}
+
+// VerifyPrehashedGPGSignatureFrom is like VerifyDetachedGPGSignatureFrom, but
+// instead of the message itself, it takes hashes that have already consumed
+// the message. This is useful for formats where the signature comes after the
+// message, such that the message can be streamed without knowing which hash
+// algorithm the signature uses. If the signature uses a hash algorithm that
+// is not in the given map, verification fails.
+func (k *GPGKeyRing) VerifyPrehashedGPGSignatureFrom(ctx context.Context, trusted GPGTrustSet, hashes map[crypto.Hash]hash.Hash, signature []byte) error {
+	signatureBytes, err := dearmorSignature(signature)
+	if err != nil {
+		return err
+	}
+	sigs, err := k.fetchPublicKeys(ctx, signatureBytes)
+	if err != nil {
+		return err
+	}
+	if len(sigs) != 1 {
+		return fmt.Errorf("expected exactly one signature, but found %d", len(sigs))
+	}
+	sig := sigs[0]
+	if sig.Version > 4 {
+		return fmt.Errorf("unsupported OpenPGP signature version: %d", sig.Version)
+	}
+	h, exists := hashes[sig.Hash]
+	if !exists {
+		return fmt.Errorf("unsupported hash function in OpenPGP signature: %s", sig.Hash.String())
+	}
+	if sig.SigExpired(time.Now()) {
+		return errors.New("OpenPGP signature has expired")
+	}
+
+	k.Mux.RLock()
+	keys := k.EntityList.KeysByIdUsage(*sig.IssuerKeyId, packet.KeyFlagSign)
+	k.Mux.RUnlock()
+	for _, key := range keys {
+		// VerifySignature() consumes the hash, so each attempt needs a fresh copy
+		hashCopy, err := h.(hash.Cloner).Clone()
+		if err != nil {
+			return err
+		}
+		if key.PublicKey.VerifySignature(hashCopy, sig) == nil {
+			err := checkSigningKeyValidity(key, time.Now())
+			if err != nil {
+				return err
+			}
+			return trusted.check(key.Entity)
+		}
+	}
+	return errors.New("OpenPGP signature is invalid or was made by an unknown key")
+}
+
+// Checks that the key that made a signature was valid at the given time, i.e.
+// neither the key nor its primary key are revoked or expired. This is the same
+// check that openpgp.CheckDetachedSignature() performs after verifying the
+// signature itself.
+func checkSigningKeyValidity(key openpgp.Key, now time.Time) error {
+	primarySelfSignature, primaryIdentity := key.Entity.PrimarySelfSignature()
+	signedBySubKey := key.PublicKey != key.Entity.PrimaryKey
+	if key.Entity.Revoked(now) ||
+		(signedBySubKey && key.Revoked(now)) ||
+		(primaryIdentity != nil && primaryIdentity.Revoked(now)) {
+		return pgperrors.ErrKeyRevoked
+	}
+	if key.Entity.PrimaryKey.KeyExpired(primarySelfSignature, now) {
+		return pgperrors.ErrKeyExpired
+	}
+	if signedBySubKey && key.PublicKey.KeyExpired(key.SelfSignature, now) {
+		return pgperrors.ErrKeyExpired
+	}
+
+	bindingSignatures := []*packet.Signature{primarySelfSignature}
+	if signedBySubKey && key.SelfSignature != nil {
+		bindingSignatures = append(bindingSignatures, key.SelfSignature, key.SelfSignature.EmbeddedSignature)
+	}
+	for _, sig := range bindingSignatures {
+		if sig != nil && sig.SigExpired(now) {
+			return pgperrors.ErrSignatureExpired
+		}
+	}
+	return nil
+}
+
+// Returns the binary form of a detached signature that may or may not be armored.
+func dearmorSignature(signature []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN ")) {
+		return signature, nil
+	}
+	block, err := armor.Decode(bytes.NewReader(signature))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != openpgp.SignatureType {
+		return nil, fmt.Errorf("invalid OpenPGP armored structure: expected %q, got %q", openpgp.SignatureType, block.Type)
+	}
+	return io.ReadAll(block.Body)
+}
+
+func (k *GPGKeyRing) checkDetachedSignature(ctx context.Context, message io.Reader, signatureBytes []byte) (*openpgp.Entity, error) {
+	_, err := k.fetchPublicKeys(ctx, signatureBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	k.Mux.RLock()
+	defer k.Mux.RUnlock()
+	return openpgp.CheckDetachedSignature(k.EntityList, message, bytes.NewReader(signatureBytes), nil)
+}
+
+// Parses the given signature packets, and ensures that the public keys of
+// their issuers are in the key ring (if they can be found on the keyservers).
+func (k *GPGKeyRing) fetchPublicKeys(ctx context.Context, signatureBytes []byte) ([]*packet.Signature, error) {
+	var (
+		sigs           []*packet.Signature
+		publicKeyBytes []byte
+	)
 	r := packet.NewReader(bytes.NewReader(signatureBytes))
 	for {
 		p, err := r.Next()
@@ -122,25 +277,26 @@ func (k *GPGKeyRing) verifyGPGSignature(ctx context.Context, message []byte, sig
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return err
+			return nil, err
 		}
 
-		var issuerKeyID uint64
-		switch sig := p.(type) {
-		case *packet.Signature:
-			issuerKeyID = *sig.IssuerKeyId
-		default:
-			return fmt.Errorf("invalid OpenPGP packet type: expected %q, got %T", "*packet.Signature", p)
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			return nil, fmt.Errorf("invalid OpenPGP packet type: expected %q, got %T", "*packet.Signature", p)
 		}
+		if sig.IssuerKeyId == nil {
+			return nil, errors.New("OpenPGP signature does not identify its issuer")
+		}
+		sigs = append(sigs, sig)
 
 		// only download the public key if not found in the existing key ring
 		k.Mux.RLock()
-		foundKeys := k.EntityList.KeysById(issuerKeyID)
+		foundKeys := k.EntityList.KeysById(*sig.IssuerKeyId)
 		k.Mux.RUnlock()
 		if len(foundKeys) == 0 {
-			b, err := k.getPublicKey(ctx, fmt.Sprintf("%016X", issuerKeyID))
+			b, err := k.getPublicKey(ctx, fmt.Sprintf("%016X", *sig.IssuerKeyId))
 			if err != nil {
-				return err
+				return nil, err
 			}
 			publicKeyBytes = append(publicKeyBytes, b...)
 		}
@@ -150,18 +306,47 @@ func (k *GPGKeyRing) verifyGPGSignature(ctx context.Context, message []byte, sig
 	if len(publicKeyBytes) != 0 {
 		el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKeyBytes))
 		if err != nil {
-			return err
+			return nil, err
 		}
 		k.Mux.Lock()
 		k.EntityList = append(k.EntityList, el...)
 		k.Mux.Unlock()
 	}
 
-	k.Mux.RLock()
-	_, err = openpgp.CheckDetachedSignature(k.EntityList, bytes.NewReader(message), bytes.NewReader(signatureBytes), nil)
-	k.Mux.RUnlock()
+	return sigs, nil
+}
 
-	return err
+// GPGTrustSet is a set of public keys whose signatures are accepted, e.g. for
+// the packages in a repository. Keys are identified by the fingerprint of
+// their primary key, or by their long key ID (the last 16 hex digits of the
+// fingerprint), in hexadecimal notation.
+type GPGTrustSet []string
+
+var gpgKeyIdentifierRx = regexp.MustCompile(`^(?:[0-9A-F]{16}|[0-9A-F]{40}|[0-9A-F]{64})$`)
+
+// ParseGPGTrustSet normalizes the given key identifiers (in the format
+// described on type GPGTrustSet, optionally with spaces and a "0x" prefix).
+func ParseGPGTrustSet(identifiers []string) (GPGTrustSet, error) {
+	result := make(GPGTrustSet, len(identifiers))
+	for idx, id := range identifiers {
+		normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(id, "0x"), " ", ""))
+		if !gpgKeyIdentifierRx.MatchString(normalized) {
+			return nil, fmt.Errorf("%q is neither a key fingerprint nor a long key ID", id)
+		}
+		result[idx] = normalized
+	}
+	return result, nil
+}
+
+// Returns an error if the given key is not in this trust set.
+func (t GPGTrustSet) check(signer *openpgp.Entity) error {
+	fingerprint := fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+	for _, id := range t {
+		if strings.HasSuffix(fingerprint, id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signed by untrusted key %s", fingerprint)
 }
 
 func (k *GPGKeyRing) getPublicKey(ctx context.Context, id string) ([]byte, error) {
@@ -223,3 +408,103 @@ func uploadPublicKey(ctx context.Context, cntr *schwift.Container, b []byte) ([]
 	}
 	return b, err
 }
+
+// GPGSigningKey is a private key that is used to sign repository metadata
+// that is generated by swift-http-import.
+type GPGSigningKey struct {
+	entity *openpgp.Entity
+}
+
+// LoadGPGSigningKey reads an armored private key from the given file. If the
+// private key is encrypted, it is decrypted with the given passphrase.
+func LoadGPGSigningKey(path string, passphrase string) (*GPGSigningKey, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(buf))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key in %s: %w", path, err)
+	}
+	if len(el) != 1 {
+		return nil, fmt.Errorf("expected exactly one key in %s, but found %d", path, len(el))
+	}
+	entity := el[0]
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("%s does not contain a private key", path)
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key in %s is encrypted, but no passphrase was given", path)
+		}
+		err = entity.DecryptPrivateKeys([]byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt private key in %s: %w", path, err)
+		}
+	}
+
+	if _, ok := entity.SigningKey(time.Now()); !ok {
+		return nil, fmt.Errorf("%s does not contain a valid signing key", path)
+	}
+	return &GPGSigningKey{entity}, nil
+}
+
+// KeyID returns the ID of the primary key in the usual hexadecimal format.
+func (k *GPGSigningKey) KeyID() string {
+	return fmt.Sprintf("%016X", k.entity.PrimaryKey.KeyId)
+}
+
+// ClearSign returns the given message with an in-line signature, in the format
+// used by Debian's InRelease files.
+func (k *GPGSigningKey) ClearSign(message []byte) ([]byte, error) {
+	key, ok := k.entity.SigningKey(time.Now())
+	if !ok {
+		return nil, errors.New("no valid signing key")
+	}
+
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, key.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	return buf.Bytes(), err
+}
+
+// DetachSign returns an armored detached signature for the given message, in
+// the format used by Debian's Release.gpg files and Yum's repomd.xml.asc files.
+func (k *GPGSigningKey) DetachSign(message []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := openpgp.ArmoredDetachSign(&buf, k.entity, bytes.NewReader(message), nil)
+	if err != nil {
+		return nil, err
+	}
+	// armor.Encode does not end the output with a newline
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// ArmoredPublicKey returns the public part of this key in armored form, so
+// that it can be published alongside the signed files.
+func (k *GPGSigningKey) ArmoredPublicKey() ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = k.entity.Serialize(w)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}